@@ -1,39 +1,440 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/assaidy/goblog/graph"
+	"github.com/assaidy/goblog/grpcapi"
+	"github.com/assaidy/goblog/health"
+	"github.com/assaidy/goblog/lifecycle"
+	"github.com/assaidy/goblog/metrics"
+	"github.com/assaidy/goblog/ratelimit"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/cache_repo"
+	"github.com/assaidy/goblog/repo/instrumented_repo"
 	"github.com/assaidy/goblog/repo/postgres_repo"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
 	"github.com/assaidy/goblog/router"
+	"github.com/assaidy/goblog/tlsconfig"
+	"github.com/assaidy/goblog/tracing"
 	"github.com/assaidy/goblog/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	config, err := utils.LoadConfig()
+	var err error
+	if args := os.Args[1:]; len(args) > 0 && args[0] == "config" {
+		err = configCommand(args[1:])
+	} else {
+		err = run(args)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("Exiting", "err", err.Error())
+		os.Exit(1)
+	}
+}
+
+// configCommand runs "goblog config print [flags]", which prints the configuration the flags and
+// the environment make up, with secrets redacted, and fails if it is invalid.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("unknown config command, expected goblog config print [flags]")
+	}
+	config, err := utils.LoadConfig(args[1:])
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := config.Print(os.Stdout); err != nil {
+		return err
 	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
 
-	dbConn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		config.DBHost,
-		config.DBPort,
-		config.DBUser,
-		config.DBPassword,
-		config.DBName,
-	)
-	repo, err := postgres_repo.NewPostgresRepo(dbConn)
+// run serves the application, configured by the flags in args and the environment, until SIGINT
+// or SIGTERM, then shuts it down gracefully. A second signal kills the process right away.
+func run(args []string) error {
+	config, err := utils.LoadConfig(args)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	if err := postgres_repo.Migrate(repo.DB); err != nil {
-		log.Fatalf("Failed to apply migrations: %v", err)
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger, err := utils.NewLogger(os.Stderr, config.LogFormat, config.LogLevel)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	slog.SetDefault(logger)
+	for _, problem := range config.InsecureSettings() {
+		slog.Warn("Insecure configuration, refused in production", "problem", problem, "environment", config.Environment)
+	}
+
+	lc := lifecycle.New()
+	if err := register(lc, config); err != nil {
+		lc.Stop(context.Background())
+		return err
 	}
-    defer repo.DB.Close()
 
-	router := router.NewRouter(repo)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	return lc.Run(ctx, config.ShutdownTimeout)
+}
+
+// register sets up the components of the application and registers them with lc. They are stopped
+// in reverse order: the servers first, so requests in flight can finish, the database last.
+func register(lc *lifecycle.Lifecycle, config *utils.Config) error {
+	// Stopped last, so the spans of the requests drained on shutdown are exported.
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    config.TraceExporter,
+		File:        config.TraceFile,
+		Endpoint:    config.TraceEndpoint,
+		SampleRatio: config.TraceSampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	lc.Append(lifecycle.Hook{Name: "tracing", Stop: shutdownTracing})
+
+	checker := health.NewChecker(config.HealthCheckTimeout)
+	checker.Add("components", lc.Check)
+
+	store, closer, err := openStore(config, checker)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+	lc.Append(lifecycle.Hook{Name: "database", Stop: func(context.Context) error { return closer.Close() }})
+
+	// Measured and traced below the cache, so the store metrics and spans tell how the database performs.
+	store = instrumented_repo.NewInstrumentedRepo(store)
+	store, err = wrapWithCache(lc, store, config)
+	if err != nil {
+		return fmt.Errorf("failed to set up cache: %w", err)
+	}
+
+	idempotencyStore, err := newIdempotencyStore(lc, config)
+	if err != nil {
+		return fmt.Errorf("failed to set up idempotency store: %w", err)
+	}
+
+	rateLimitStore, lockout, accountLockout, err := newRateLimiting(lc, config)
+	if err != nil {
+		return fmt.Errorf("failed to set up rate limiting: %w", err)
+	}
+	apiLimit, err := ratelimit.ParseLimit(config.RateLimitAPI)
+	if err != nil {
+		return fmt.Errorf("invalid RATE_LIMIT_API: %w", err)
+	}
+	authLimit, err := ratelimit.ParseLimit(config.RateLimitAuth)
+	if err != nil {
+		return fmt.Errorf("invalid RATE_LIMIT_AUTH: %w", err)
+	}
+	trustedProxies, err := utils.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
 
-	log.Println("Running server on port %s", config.Port)
-	log.Fatal(http.ListenAndServe(config.Port, router))
+	auth := utils.NewAuth(config.JWTSecret, time.Duration(config.JWTExpirationHours)*time.Hour, lockout, accountLockout)
+	router := router.NewRouter(store, router.Options{
+		Auth:             auth,
+		IdempotencyStore: idempotencyStore,
+		IdempotencyTTL:   config.IdempotencyTTL,
+		GraphQLLimits: graph.Limits{
+			MaxDepth:      config.GraphQLMaxDepth,
+			MaxComplexity: config.GraphQLMaxCost,
+		},
+		Health:         checker,
+		RateLimitStore: rateLimitStore,
+		RateLimitAPI:   apiLimit,
+		RateLimitAuth:  authLimit,
+		TrustedProxies: trustedProxies,
+		CORS: utils.CORSOptions{
+			AllowedOrigins:   config.CORSOrigins,
+			AllowedMethods:   config.CORSMethods,
+			AllowedHeaders:   config.CORSHeaders,
+			AllowCredentials: config.CORSCredentials,
+			MaxAge:           config.CORSMaxAge,
+		},
+		SecurityHeaders: config.SecurityHeaders(),
+	})
+
+	tlsConfig, err := newTLSConfig(lc, config)
+	if err != nil {
+		return fmt.Errorf("failed to set up TLS: %w", err)
+	}
+	var grpcOpts []grpc.ServerOption
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig.TLS)))
+	}
+
+	grpcServer := grpcapi.NewServer(store, auth, grpcOpts...)
+	lc.Append(lc.Server("grpc", ":"+config.GRPCPort, grpcServer.Serve, func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			grpcServer.Stop()
+			return ctx.Err()
+		}
+	}))
+
+	srv := &http.Server{
+		Addr:              ":" + config.Port,
+		Handler:           router,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig.TLS
+	}
+	lc.Append(lc.HTTPServer("http", srv))
+
+	// Redirects plain HTTP requests to the server, and answers the challenges of the ACME server.
+	// Validate made sure TLS is set up along with it.
+	if config.HTTPRedirectPort != "" {
+		lc.Append(lc.HTTPServer("http redirect", &http.Server{
+			Addr:              ":" + config.HTTPRedirectPort,
+			Handler:           tlsConfig.HTTPHandler(":" + config.Port),
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		}))
+	}
+
+	// Stopped first: /readyz fails while the servers still serve, so load balancers drain them.
+	lc.Append(lifecycle.Delay("drain delay", config.ShutdownDelay))
+
+	return nil
+}
+
+// openStore connects to the database backend selected by config.DBDriver, applies its migrations,
+// adds checks of both to checker and exports the statistics of its connection pools.
+// The returned io.Closer releases the database connections and must be closed on shutdown.
+func openStore(config *utils.Config, checker *health.Checker) (repo.Storer, io.Closer, error) {
+	switch config.DBDriver {
+	case "postgres":
+		dbConn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			config.DBHost,
+			config.DBPort,
+			config.DBUser,
+			config.DBPassword,
+			config.DBName,
+		)
+		pg, err := postgres_repo.NewPostgresRepo(dbConn, postgres_repo.Options{
+			MaxOpenConns:        config.DBMaxOpenConns,
+			MaxIdleConns:        config.DBMaxIdleConns,
+			ConnMaxLifetime:     config.DBConnMaxLifetime,
+			ReplicaDSNs:         config.DBReplicaDSNs,
+			HealthCheckInterval: config.DBReplicaCheck,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		if err := postgres_repo.Migrate(pg.DB); err != nil {
+			pg.Close()
+			return nil, nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		addDatabaseChecks(checker, pg.DB, postgres_repo.PendingMigrations)
+		for name, db := range pg.Pools() {
+			if err := metrics.RegisterDB(name, db); err != nil {
+				pg.Close()
+				return nil, nil, fmt.Errorf("failed to register pool metrics: %w", err)
+			}
+		}
+		return pg, pg, nil
+	case "sqlite":
+		lite, err := sqlite_repo.NewSqliteRepo(config.DBPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		if err := sqlite_repo.Migrate(lite.DB); err != nil {
+			lite.Close()
+			return nil, nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		addDatabaseChecks(checker, lite.DB, sqlite_repo.PendingMigrations)
+		if err := metrics.RegisterDB("sqlite", lite.DB); err != nil {
+			lite.Close()
+			return nil, nil, fmt.Errorf("failed to register pool metrics: %w", err)
+		}
+		return lite, lite, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_DRIVER %q, expected postgres or sqlite", config.DBDriver)
+	}
+}
+
+// addDatabaseChecks adds checks that db answers and that none of its migrations is pending.
+func addDatabaseChecks(checker *health.Checker, db *sql.DB, pendingMigrations func(context.Context, *sql.DB) ([]string, error)) {
+	checker.Add("database", db.PingContext)
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := pendingMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("migrations not applied: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	})
+}
+
+// wrapWithCache puts the read-through cache selected by config.CacheBackend in front of store.
+// Connections to an external cache are closed by lc.
+func wrapWithCache(lc *lifecycle.Lifecycle, store repo.Storer, config *utils.Config) (repo.Storer, error) {
+	switch config.CacheBackend {
+	case "", "none":
+		return store, nil
+	case "memory":
+		return cache_repo.NewCacheRepo(store, cache_repo.NewMemoryCache(config.CacheSize), config.CacheTTL), nil
+	case "redis":
+		cache, err := cache_repo.NewRedisCache(cache_repo.RedisOptions{
+			Addr:     config.RedisAddr,
+			Password: config.RedisPassword,
+			DB:       config.RedisDB,
+			Prefix:   "goblog:",
+		})
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(lifecycle.Hook{Name: "redis cache", Stop: func(context.Context) error { return cache.Close() }})
+		return cache_repo.NewCacheRepo(store, cache, config.CacheTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q, expected none, memory or redis", config.CacheBackend)
+	}
+}
+
+// newIdempotencyStore creates the store selected by config.IdempotencyBackend for the responses of idempotent requests.
+// Connections to an external store are closed by lc.
+func newIdempotencyStore(lc *lifecycle.Lifecycle, config *utils.Config) (utils.IdempotencyStore, error) {
+	switch config.IdempotencyBackend {
+	case "", "memory":
+		return cache_repo.NewExpiringCache(), nil
+	case "redis":
+		cache, err := cache_repo.NewRedisCache(cache_repo.RedisOptions{
+			Addr:     config.RedisAddr,
+			Password: config.RedisPassword,
+			DB:       config.RedisDB,
+			Prefix:   "goblog:",
+		})
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(lifecycle.Hook{Name: "redis idempotency store", Stop: func(context.Context) error { return cache.Close() }})
+		return cache, nil
+	default:
+		return nil, fmt.Errorf("unknown IDEMPOTENCY_BACKEND %q, expected memory or redis", config.IdempotencyBackend)
+	}
+}
+
+// newRateLimiting creates the store of the rate limits and the login lockouts, per client address and per
+// account, selected by config.RateLimitBackend. The store is nil if rate limits are disabled, the lockouts if
+// config.LoginMaxFailures or config.AccountMaxFailures is 0.
+// Connections to an external store are closed by lc.
+func newRateLimiting(lc *lifecycle.Lifecycle, config *utils.Config) (ratelimit.Store, *ratelimit.Lockout, *ratelimit.Lockout, error) {
+	var store ratelimit.Store
+	var lockoutStore ratelimit.KV
+	switch config.RateLimitBackend {
+	case "none":
+		lockoutStore = cache_repo.NewExpiringCache()
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+		lockoutStore = cache_repo.NewExpiringCache()
+	case "redis":
+		cache, err := cache_repo.NewRedisCache(cache_repo.RedisOptions{
+			Addr:     config.RedisAddr,
+			Password: config.RedisPassword,
+			DB:       config.RedisDB,
+			Prefix:   "goblog:",
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		lc.Append(lifecycle.Hook{Name: "redis rate limit store", Stop: func(context.Context) error { return cache.Close() }})
+		store, lockoutStore = cache, cache
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown RATE_LIMIT_BACKEND %q, expected none, memory or redis", config.RateLimitBackend)
+	}
+
+	return store, newLockout(lockoutStore, config.LoginMaxFailures, config),
+		newLockout(lockoutStore, config.AccountMaxFailures, config), nil
+}
+
+// newLockout creates a login lockout after maxFailures, or returns nil if maxFailures is 0.
+func newLockout(store ratelimit.KV, maxFailures int, config *utils.Config) *ratelimit.Lockout {
+	if maxFailures < 1 {
+		return nil
+	}
+	return ratelimit.NewLockout(store, ratelimit.LockoutPolicy{
+		MaxFailures: maxFailures,
+		Duration:    config.LoginLockout,
+		MaxDuration: config.LoginMaxLockout,
+	})
+}
+
+// newTLSConfig builds the TLS configuration of the servers, or returns nil if TLS is not configured.
+// Certificate files are watched for changes until lc stops.
+func newTLSConfig(lc *lifecycle.Lifecycle, config *utils.Config) (*tlsconfig.Config, error) {
+	opts := tlsconfig.Options{
+		CertFile:     config.TLSCertFile,
+		KeyFile:      config.TLSKeyFile,
+		MinVersion:   config.TLSMinVersion,
+		CipherSuites: config.TLSCipherSuites,
+		ACME: tlsconfig.ACMEOptions{
+			Domains:      config.ACMEDomains,
+			Email:        config.ACMEEmail,
+			DirectoryURL: config.ACMEDirectory,
+			CacheDir:     config.ACMECacheDir,
+			CARootFile:   config.ACMECARoot,
+		},
+	}
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	tlsConfig, err := tlsconfig.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig.Reloader != nil && config.TLSReloadInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		lc.Append(lifecycle.Hook{
+			Name: "certificate reloader",
+			Start: func(context.Context) error {
+				go tlsConfig.Reloader.Watch(ctx, config.TLSReloadInterval)
+				return nil
+			},
+			Stop: func(context.Context) error {
+				cancel()
+				return nil
+			},
+		})
+	}
+	return tlsConfig, nil
 }
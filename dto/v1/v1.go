@@ -0,0 +1,127 @@
+// Package v1 defines the response bodies of version 1 of the API.
+//
+// These shapes are frozen: clients of v1 rely on every field as it is, so never rename,
+// remove or retype one. Changes go into a new version instead.
+package v1
+
+import (
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/utils"
+)
+
+// User is a user as returned by v1. Password was never filled in responses
+// but is kept, since v1 clients may expect the key.
+type User struct {
+	Id        int       `json:"id"`
+	FullName  string    `json:"fullName"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	Bio       string    `json:"bio"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
+}
+
+// Post is a post as returned by v1.
+type Post struct {
+	Id        int       `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	AuthorId  int       `json:"authorId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
+}
+
+// PostResult is the outcome of one item of a batch request: the post, or the problem it failed with.
+// Status is the HTTP status the item would have been answered with as a request of its own.
+type PostResult struct {
+	Status int             `json:"status"`
+	Post   *Post           `json:"post,omitempty"`
+	Error  *utils.ApiError `json:"error,omitempty"`
+}
+
+// LoginResponse is the body of a successful login.
+type LoginResponse struct {
+	User  *User  `json:"user"`
+	Token string `json:"token"`
+}
+
+// Presenter renders models as v1 response bodies; it implements handlers.Presenter.
+// Lists are plain JSON arrays.
+type Presenter struct{}
+
+func (Presenter) User(u *models.User) any { return newUser(u) }
+
+func (Presenter) Users(users []*models.User) any {
+	out := make([]*User, len(users))
+	for i, u := range users {
+		out[i] = newUser(u)
+	}
+	return out
+}
+
+func (Presenter) Login(l *models.UserLoginResponse) any {
+	return &LoginResponse{User: newUser(l.User), Token: l.Token}
+}
+
+func (Presenter) Post(p *models.Post) any { return newPost(p) }
+
+func (Presenter) Posts(posts []*models.Post) any {
+	out := make([]*Post, len(posts))
+	for i, p := range posts {
+		out[i] = newPost(p)
+	}
+	return out
+}
+
+func (Presenter) PostResults(results []models.PostResult) any {
+	out := make([]*PostResult, len(results))
+	for i, r := range results {
+		out[i] = newPostResult(r)
+	}
+	return out
+}
+
+func newUser(u *models.User) *User {
+	if u == nil {
+		return nil
+	}
+	return &User{
+		Id:        u.Id,
+		FullName:  u.FullName,
+		Username:  u.Username,
+		Email:     u.Email,
+		Bio:       u.Bio,
+		JoinedAt:  u.JoinedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+func newPost(p *models.Post) *Post {
+	if p == nil {
+		return nil
+	}
+	return &Post{
+		Id:        p.Id,
+		Title:     p.Title,
+		Content:   p.Content,
+		AuthorId:  p.AuthorId,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		Version:   p.Version,
+	}
+}
+
+func newPostResult(r models.PostResult) *PostResult {
+	out := &PostResult{Status: r.Status, Post: newPost(r.Post)}
+	if r.Err != nil {
+		apiErr := utils.ToApiError(r.Err)
+		out.Error = &apiErr
+	}
+	return out
+}
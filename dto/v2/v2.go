@@ -0,0 +1,144 @@
+// Package v2 defines the response bodies of version 2 of the API.
+//
+// Compared to v1, users have no password field and lists are wrapped in an object,
+// so fields such as pagination links can be added next to the items without breaking clients.
+// Once v2 is released these shapes are frozen like those of v1.
+package v2
+
+import (
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/utils"
+)
+
+// User is a user as returned by v2.
+type User struct {
+	Id        int       `json:"id"`
+	FullName  string    `json:"fullName"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Bio       string    `json:"bio"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
+}
+
+// UserList is a list of users.
+type UserList struct {
+	Data []*User `json:"data"`
+}
+
+// Post is a post as returned by v2.
+type Post struct {
+	Id        int       `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	AuthorId  int       `json:"authorId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
+}
+
+// PostList is a list of posts.
+type PostList struct {
+	Data []*Post `json:"data"`
+}
+
+// PostResult is the outcome of one item of a batch request: the post, or the problem it failed with.
+// Status is the HTTP status the item would have been answered with as a request of its own.
+type PostResult struct {
+	Status int             `json:"status"`
+	Post   *Post           `json:"post,omitempty"`
+	Error  *utils.ApiError `json:"error,omitempty"`
+}
+
+// PostResultList lists the outcomes of a batch request in the order of its items.
+type PostResultList struct {
+	Data   []*PostResult `json:"data"`
+	Failed int           `json:"failed"`
+}
+
+// LoginResponse is the body of a successful login.
+type LoginResponse struct {
+	User  *User  `json:"user"`
+	Token string `json:"token"`
+}
+
+// Presenter renders models as v2 response bodies; it implements handlers.Presenter.
+type Presenter struct{}
+
+func (Presenter) User(u *models.User) any { return newUser(u) }
+
+func (Presenter) Users(users []*models.User) any {
+	out := &UserList{Data: make([]*User, len(users))}
+	for i, u := range users {
+		out.Data[i] = newUser(u)
+	}
+	return out
+}
+
+func (Presenter) Login(l *models.UserLoginResponse) any {
+	return &LoginResponse{User: newUser(l.User), Token: l.Token}
+}
+
+func (Presenter) Post(p *models.Post) any { return newPost(p) }
+
+func (Presenter) Posts(posts []*models.Post) any {
+	out := &PostList{Data: make([]*Post, len(posts))}
+	for i, p := range posts {
+		out.Data[i] = newPost(p)
+	}
+	return out
+}
+
+func (Presenter) PostResults(results []models.PostResult) any {
+	out := &PostResultList{Data: make([]*PostResult, len(results))}
+	for i, r := range results {
+		out.Data[i] = newPostResult(r)
+		if r.Err != nil {
+			out.Failed++
+		}
+	}
+	return out
+}
+
+func newUser(u *models.User) *User {
+	if u == nil {
+		return nil
+	}
+	return &User{
+		Id:        u.Id,
+		FullName:  u.FullName,
+		Username:  u.Username,
+		Email:     u.Email,
+		Bio:       u.Bio,
+		JoinedAt:  u.JoinedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+func newPost(p *models.Post) *Post {
+	if p == nil {
+		return nil
+	}
+	return &Post{
+		Id:        p.Id,
+		Title:     p.Title,
+		Content:   p.Content,
+		AuthorId:  p.AuthorId,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		Version:   p.Version,
+	}
+}
+
+func newPostResult(r models.PostResult) *PostResult {
+	out := &PostResult{Status: r.Status, Post: newPost(r.Post)}
+	if r.Err != nil {
+		apiErr := utils.ToApiError(r.Err)
+		out.Error = &apiErr
+	}
+	return out
+}
@@ -0,0 +1,354 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
+	"github.com/assaidy/goblog/utils"
+)
+
+// countingStore counts the batch reads made through it.
+type countingStore struct {
+	repo.Storer
+	usersByIds, postsByAuthorIds     atomic.Int32
+	commentsByPostIds, tagsByPostIds atomic.Int32
+}
+
+func (s *countingStore) GetUsersByIds(ctx context.Context, ids []int) ([]*models.User, error) {
+	s.usersByIds.Add(1)
+	return s.Storer.GetUsersByIds(ctx, ids)
+}
+
+func (s *countingStore) GetPostsByAuthorIds(ctx context.Context, authorIds []int) ([]*models.Post, error) {
+	s.postsByAuthorIds.Add(1)
+	return s.Storer.GetPostsByAuthorIds(ctx, authorIds)
+}
+
+func (s *countingStore) GetCommentsByPostIds(ctx context.Context, postIds []int) ([]*models.Comment, error) {
+	s.commentsByPostIds.Add(1)
+	return s.Storer.GetCommentsByPostIds(ctx, postIds)
+}
+
+func (s *countingStore) GetTagsByPostIds(ctx context.Context, postIds []int) (map[int][]*models.Tag, error) {
+	s.tagsByPostIds.Add(1)
+	return s.Storer.GetTagsByPostIds(ctx, postIds)
+}
+
+// testAuth signs the tokens of the tests.
+var testAuth = utils.NewAuth("graph-test-secret", time.Hour, nil, nil)
+
+// newTestServer serves GraphQL over a SQLite store holding three users with two posts each.
+// Every post but the last has a comment by the next user, and alice's posts are tagged.
+func newTestServer(t *testing.T, limits Limits) (http.Handler, *countingStore) {
+	t.Helper()
+	lite, err := sqlite_repo.NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	t.Cleanup(func() { lite.Close() })
+	if err := sqlite_repo.Migrate(lite.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user, err := lite.CreateUser(ctx, &models.User{
+			FullName: name, Username: name, Email: name + "@example.com", Password: "secret",
+		})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		for i := range 2 {
+			post := &models.Post{Title: fmt.Sprintf("%s %d", name, i), Content: "content", AuthorId: user.Id}
+			if _, err := lite.CreatePost(ctx, post); err != nil {
+				t.Fatalf("CreatePost: %v", err)
+			}
+		}
+	}
+
+	for postId := 1; postId < 6; postId++ {
+		comment := &models.Comment{
+			Content: fmt.Sprintf("comment on %d", postId), PostId: postId, AuthorId: (postId+1)/2%3 + 1,
+		}
+		if _, err := lite.CreateComment(ctx, comment); err != nil {
+			t.Fatalf("CreateComment: %v", err)
+		}
+	}
+	for postId, names := range map[int][]string{1: {"go", "apis"}, 2: {"go"}} {
+		if err := lite.TagPost(ctx, postId, names); err != nil {
+			t.Fatalf("TagPost: %v", err)
+		}
+	}
+
+	store := &countingStore{Storer: lite}
+	h, err := NewHandler(store, limits)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	return testAuth.OptionalJWTAuthMiddleware(utils.MakeHandlerFunc(h.HandleQuery)), store
+}
+
+type result struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func query(t *testing.T, h http.Handler, q, token string) result {
+	t.Helper()
+	body, _ := json.Marshal(Request{Query: q})
+	r := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body)))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var res result
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body, err)
+	}
+	return res
+}
+
+func TestNestedQueriesAreBatched(t *testing.T) {
+	h, store := newTestServer(t, Limits{})
+
+	res := query(t, h, `{ users { username posts { title author { username posts { id } } } } }`, "")
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+
+	var users []struct {
+		Username string
+		Posts    []struct {
+			Title  string
+			Author struct {
+				Username string
+				Posts    []struct{ Id int }
+			}
+		}
+	}
+	if err := json.Unmarshal(res.Data["users"], &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("got %d users, want 3", len(users))
+	}
+	for _, user := range users {
+		if len(user.Posts) != 2 {
+			t.Fatalf("%s has %d posts, want 2", user.Username, len(user.Posts))
+		}
+		for _, post := range user.Posts {
+			if post.Author.Username != user.Username || len(post.Author.Posts) != 2 {
+				t.Errorf("post %q: author %+v, want %s with 2 posts", post.Title, post.Author, user.Username)
+			}
+		}
+	}
+
+	// One query per level, however many users and posts there are.
+	if n := store.usersByIds.Load(); n != 1 {
+		t.Errorf("GetUsersByIds called %d times, want 1", n)
+	}
+	if n := store.postsByAuthorIds.Load(); n != 1 {
+		t.Errorf("GetPostsByAuthorIds called %d times, want 1", n)
+	}
+}
+
+func TestCommentsAndTagsAreBatched(t *testing.T) {
+	h, store := newTestServer(t, Limits{})
+
+	res := query(t, h, `{ posts { id comments { content author { username } } tags { name } } }`, "")
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+
+	var posts []struct {
+		Id       int
+		Comments []struct {
+			Content string
+			Author  struct{ Username string }
+		}
+		Tags []struct{ Name string }
+	}
+	if err := json.Unmarshal(res.Data["posts"], &posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 6 {
+		t.Fatalf("got %d posts, want 6", len(posts))
+	}
+	commenters := []string{"bob", "bob", "carol", "carol", "alice"}
+	for _, post := range posts {
+		var wantComments []string
+		if post.Id < 6 {
+			wantComments = []string{fmt.Sprintf("comment on %d by %s", post.Id, commenters[post.Id-1])}
+		}
+		var gotComments []string
+		for _, comment := range post.Comments {
+			gotComments = append(gotComments, comment.Content+" by "+comment.Author.Username)
+		}
+		if !reflect.DeepEqual(gotComments, wantComments) || post.Comments == nil {
+			t.Errorf("post %d: comments %+v, want %v", post.Id, post.Comments, wantComments)
+		}
+
+		var wantTags []string
+		switch post.Id {
+		case 1:
+			wantTags = []string{"apis", "go"}
+		case 2:
+			wantTags = []string{"go"}
+		}
+		var gotTags []string
+		for _, tag := range post.Tags {
+			gotTags = append(gotTags, tag.Name)
+		}
+		if !reflect.DeepEqual(gotTags, wantTags) || post.Tags == nil {
+			t.Errorf("post %d: tags %+v, want %v", post.Id, post.Tags, wantTags)
+		}
+	}
+
+	if n := store.commentsByPostIds.Load(); n != 1 {
+		t.Errorf("GetCommentsByPostIds called %d times, want 1", n)
+	}
+	if n := store.tagsByPostIds.Load(); n != 1 {
+		t.Errorf("GetTagsByPostIds called %d times, want 1", n)
+	}
+	if n := store.usersByIds.Load(); n != 1 {
+		t.Errorf("GetUsersByIds called %d times, want 1", n)
+	}
+}
+
+func TestLookups(t *testing.T) {
+	h, _ := newTestServer(t, Limits{})
+
+	res := query(t, h, `{ byId: user(id: 2) { username } byName: user(username: "carol") { id }
+		missing: user(id: 99) { id } post(id: 1) { title author { username } } nope: post(id: 99) { id } }`, "")
+	if len(res.Errors) > 0 {
+		t.Fatalf("errors: %+v", res.Errors)
+	}
+
+	want := map[string]string{
+		"byId":    `{"username":"bob"}`,
+		"byName":  `{"id":3}`,
+		"missing": `null`,
+		"post":    `{"title":"alice 0","author":{"username":"alice"}}`,
+		"nope":    `null`,
+	}
+	for field, w := range want {
+		var got, wanted any
+		json.Unmarshal(res.Data[field], &got)
+		json.Unmarshal([]byte(w), &wanted)
+		if !reflect.DeepEqual(got, wanted) {
+			t.Errorf("%s = %s, want %s", field, res.Data[field], w)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	h, _ := newTestServer(t, Limits{MaxDepth: 3, MaxComplexity: 150})
+
+	tests := []struct {
+		name, query, code string
+	}{
+		{"shallow", `{ users { username posts { title } } }`, ""},
+		{"too deep", `{ users { posts { author { username } } } }`, CodeQueryTooDeep},
+		{"too deep in a fragment", `{ post(id: 1) { ...deep } } fragment deep on Post { author { posts { id } } }`, CodeQueryTooDeep},
+		// users: 1 + 10 * (id + posts: 1 + 10 * 2) = 221
+		{"too complex", `{ users { id posts { id title } } }`, CodeQueryTooComplex},
+		// post: 1 + comments: (1 + 10 * 2) + tags: (1 + 10 * 1) = 33
+		{"comments and tags", `{ post(id: 1) { comments { id content } tags { name } } }`, ""},
+		// posts: 1 + 10 * (comments: (1 + 10 * 2) + tags: (1 + 10 * 1)) = 321
+		{"too complex with comments and tags", `{ posts { comments { id content } tags { name } } }`, CodeQueryTooComplex},
+		{"introspection", `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := query(t, h, tt.query, "")
+			if tt.code == "" {
+				if len(res.Errors) > 0 {
+					t.Fatalf("errors: %+v", res.Errors)
+				}
+				return
+			}
+			if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != tt.code {
+				t.Fatalf("errors = %+v, want one with code %s", res.Errors, tt.code)
+			}
+			if res.Data != nil {
+				t.Errorf("data = %v, want none, as the query must not run", res.Data)
+			}
+		})
+	}
+}
+
+func TestMe(t *testing.T) {
+	h, store := newTestServer(t, Limits{})
+
+	login, err := testAuth.AuthenticateUser(context.Background(),
+		models.UserLoginRequest{Username: "bob", Password: "secret"}, store)
+	if err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+
+	res := query(t, h, `{ me { username } }`, login.Token)
+	if got := string(res.Data["me"]); got != `{"username":"bob"}` {
+		t.Errorf("me = %s, want bob", got)
+	}
+
+	res = query(t, h, `{ me { username } }`, "")
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeUnauthenticated {
+		t.Errorf("errors = %+v, want one with code %s", res.Errors, CodeUnauthenticated)
+	}
+
+	// Invalid tokens are rejected rather than treated as anonymous.
+	r := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query":"{ users { id } }"}`))
+	r.Header.Set("Authorization", "Bearer nope")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token: status %d, want 401", w.Code)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	h, _ := newTestServer(t, Limits{})
+
+	res := query(t, h, `{ users { password } }`, "")
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeValidationFailed {
+		t.Errorf("errors = %+v, want one with code %s", res.Errors, CodeValidationFailed)
+	}
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodPost, "/api/graphql", `{"query":`, http.StatusBadRequest},
+		{http.MethodPost, "/api/graphql", `{}`, http.StatusUnprocessableEntity},
+		{http.MethodGet, "/api/graphql?query=%7B+users+%7B+id+%7D+%7D", "", http.StatusOK},
+		{http.MethodGet, "/api/graphql?query=%7B+users+%7B+id+%7D+%7D&variables=nope", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s %s: status %d, want %d", tt.method, tt.target, tt.body, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package graph serves a GraphQL API over the same repo.Storer as the REST handlers.
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is a GraphQL request, sent as a JSON body with POST or as query parameters with GET.
+type Request struct {
+	Query         string         `json:"query" validate:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	// Extensions is accepted for compatibility with clients that send it, and ignored.
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Response is the result of a GraphQL request. Errors in the query are reported in Errors
+// with status 200, and a code in the extensions of each error.
+type Response struct {
+	Data   any                        `json:"data,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+type Handler struct {
+	store  repo.Storer
+	schema graphql.Schema
+	limits Limits
+}
+
+func NewHandler(store repo.Storer, limits Limits) (*Handler, error) {
+	schema, err := NewSchema(store)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{store: store, schema: schema, limits: limits}, nil
+}
+
+// HandleQuery executes a query. The user authenticated by utils.Auth.OptionalJWTAuthMiddleware, if any,
+// is available to resolvers.
+func (h *Handler) HandleQuery(w http.ResponseWriter, r *http.Request) error {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "variables must be a JSON object")
+			}
+		}
+		if err := utils.ValidateRequest(&req); err != nil {
+			return err
+		}
+	default:
+		if err := utils.DecodeAndValidateJSON(r, &req); err != nil {
+			return err
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, h.execute(r, req))
+}
+
+func (h *Handler) execute(r *http.Request, req Request) Response {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return Response{Errors: withCode(gqlerrors.FormatErrors(err), CodeValidationFailed)}
+	}
+
+	if result := graphql.ValidateDocument(&h.schema, doc, nil); !result.IsValid {
+		return Response{Errors: withCode(result.Errors, CodeValidationFailed)}
+	}
+
+	if err := checkLimits(h.schema, doc, req.OperationName, h.limits); err != nil {
+		return Response{Errors: []gqlerrors.FormattedError{{Message: err.Error(), Extensions: err.Extensions()}}}
+	}
+
+	// Loaders live for one request, so their values never outlive a write.
+	ctx := withLoaders(r.Context(), newLoaders(h.store))
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	return Response{Data: result.Data, Errors: result.Errors}
+}
+
+// withCode sets code in the extensions of errs that have none.
+func withCode(errs []gqlerrors.FormattedError, code string) []gqlerrors.FormattedError {
+	for i := range errs {
+		if errs[i].Extensions == nil {
+			errs[i].Extensions = map[string]any{"code": code}
+		}
+	}
+	return errs
+}
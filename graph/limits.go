@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound the cost of a query before it is executed. Zero disables a limit.
+type Limits struct {
+	// MaxDepth is the deepest allowed nesting of fields, counting the fields of the query itself as 1.
+	MaxDepth int
+	// MaxComplexity is the highest allowed complexity: every field costs 1, and the fields selected
+	// on the items of a list cost listFactor times as much, as lists return many items.
+	MaxComplexity int
+}
+
+// listFactor is the assumed number of items of a list in complexity calculations.
+const listFactor = 10
+
+// checkLimits returns an error if the operation of doc that would be executed exceeds limits.
+// doc must be valid, so fragments do not form cycles.
+// Introspection fields are not counted, so tools can always load the schema.
+func checkLimits(schema graphql.Schema, doc *ast.Document, operationName string, limits Limits) *resolverError {
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				if op != nil && operationName == "" {
+					// Several operations without a name to pick one: the executor rejects the request.
+					return nil
+				}
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	if op == nil || op.Operation != ast.OperationTypeQuery {
+		return nil
+	}
+
+	m := measurer{schema: schema, fragments: fragments}
+	depth, complexity := m.measure(schema.QueryType(), op.SelectionSet)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &resolverError{
+			message: fmt.Sprintf("query depth %d exceeds the limit of %d", depth, limits.MaxDepth),
+			code:    CodeQueryTooDeep,
+		}
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return &resolverError{
+			message: fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, limits.MaxComplexity),
+			code:    CodeQueryTooComplex,
+		}
+	}
+	return nil
+}
+
+type measurer struct {
+	schema    graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+}
+
+// measure returns the depth and the complexity of a selection set on parent.
+func (m measurer) measure(parent graphql.Type, set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = m.measureField(parent, selection)
+		case *ast.InlineFragment:
+			on := parent
+			if selection.TypeCondition != nil {
+				on = m.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			d, c = m.measure(on, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment := m.fragments[selection.Name.Value]; fragment != nil {
+				d, c = m.measure(m.schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (m measurer) measureField(parent graphql.Type, field *ast.Field) (depth, complexity int) {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") {
+		return 0, 0
+	}
+
+	object, ok := parent.(*graphql.Object)
+	if !ok {
+		return 1, 1
+	}
+	def := object.Fields()[name]
+	if def == nil {
+		return 1, 1
+	}
+
+	factor := 1
+	t := graphql.Type(def.Type)
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	if _, ok := t.(*graphql.List); ok {
+		factor = listFactor
+	}
+
+	d, c := m.measure(graphql.GetNamed(def.Type).(graphql.Type), field.SelectionSet)
+	return 1 + d, 1 + factor*c
+}
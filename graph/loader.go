@@ -0,0 +1,141 @@
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+)
+
+// loader batches the keys requested while resolving one level of a query into a single fetch.
+//
+// Resolvers call load, which only records the key and returns a thunk. The executor resolves the
+// thunks of a level after all of its fields were visited, and the first thunk to run fetches every
+// key recorded so far. Values are kept for the rest of the request, so each key is fetched once.
+type loader[K comparable, V any] struct {
+	// fetch returns the values of keys. Keys without a value are left out of the map.
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	values  map[K]V
+	errs    map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(context.Context, []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:  fetch,
+		queued: map[K]bool{},
+		values: map[K]V{},
+		errs:   map[K]error{},
+	}
+}
+
+// load records key for the next batch and returns a thunk yielding its value,
+// or the zero value if there is none.
+func (l *loader[K, V]) load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			keys := l.pending
+			l.pending = nil
+			values, err := l.fetch(ctx, keys)
+			for _, k := range keys {
+				if err != nil {
+					l.errs[k] = err
+				} else if v, ok := values[k]; ok {
+					l.values[k] = v
+				}
+			}
+		}
+		return l.values[key], l.errs[key]
+	}
+}
+
+// loaders holds the loaders of one request.
+type loaders struct {
+	users          *loader[int, *models.User]
+	postsByAuthor  *loader[int, []*models.Post]
+	commentsByPost *loader[int, []*models.Comment]
+	tagsByPost     *loader[int, []*models.Tag]
+}
+
+func newLoaders(store repo.Storer) *loaders {
+	return &loaders{
+		users: newLoader(func(ctx context.Context, ids []int) (map[int]*models.User, error) {
+			users, err := store.GetUsersByIds(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byId := make(map[int]*models.User, len(users))
+			for _, user := range users {
+				byId[user.Id] = user
+			}
+			return byId, nil
+		}),
+		postsByAuthor: newLoader(func(ctx context.Context, authorIds []int) (map[int][]*models.Post, error) {
+			posts, err := store.GetPostsByAuthorIds(ctx, authorIds)
+			if err != nil {
+				return nil, err
+			}
+			// Authors without posts get an empty list rather than none.
+			byAuthor := make(map[int][]*models.Post, len(authorIds))
+			for _, id := range authorIds {
+				byAuthor[id] = []*models.Post{}
+			}
+			for _, post := range posts {
+				byAuthor[post.AuthorId] = append(byAuthor[post.AuthorId], post)
+			}
+			return byAuthor, nil
+		}),
+		commentsByPost: newLoader(func(ctx context.Context, postIds []int) (map[int][]*models.Comment, error) {
+			comments, err := store.GetCommentsByPostIds(ctx, postIds)
+			if err != nil {
+				return nil, err
+			}
+			// Posts without comments get an empty list rather than none.
+			byPost := make(map[int][]*models.Comment, len(postIds))
+			for _, id := range postIds {
+				byPost[id] = []*models.Comment{}
+			}
+			for _, comment := range comments {
+				byPost[comment.PostId] = append(byPost[comment.PostId], comment)
+			}
+			return byPost, nil
+		}),
+		tagsByPost: newLoader(func(ctx context.Context, postIds []int) (map[int][]*models.Tag, error) {
+			tags, err := store.GetTagsByPostIds(ctx, postIds)
+			if err != nil {
+				return nil, err
+			}
+			// Posts without tags get an empty list rather than none.
+			for _, id := range postIds {
+				if tags[id] == nil {
+					tags[id] = []*models.Tag{}
+				}
+			}
+			return tags, nil
+		}),
+	}
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
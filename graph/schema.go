@@ -0,0 +1,261 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+	"github.com/graphql-go/graphql"
+)
+
+// Codes in the extensions of GraphQL errors, next to the API error codes of utils.
+const (
+	CodeUnauthenticated  = "UNAUTHENTICATED"
+	CodeQueryTooDeep     = "QUERY_TOO_DEEP"
+	CodeQueryTooComplex  = "QUERY_TOO_COMPLEX"
+	CodeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+)
+
+// resolverError is an error returned by a resolver. Its code ends up in the extensions of the GraphQL error.
+type resolverError struct {
+	message string
+	code    string
+}
+
+func (e resolverError) Error() string {
+	return e.message
+}
+
+func (e resolverError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// toResolverError translates err the way utils.ToApiError does for REST handlers,
+// so both APIs report the same codes and hide the same internals.
+func toResolverError(err error) error {
+	var rErr resolverError
+	if errors.As(err, &rErr) {
+		return rErr
+	}
+
+	apiErr := utils.ToApiError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.Error("GraphQL resolver error", "err", err.Error())
+	}
+	return resolverError{message: apiErr.Detail, code: apiErr.Code}
+}
+
+// resolve adapts a resolver so its errors carry codes.
+func resolve(f graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		v, err := f(p)
+		if err != nil {
+			return nil, toResolverError(err)
+		}
+		return v, nil
+	}
+}
+
+// thunk defers a loader result to the executor, which resolves thunks after the other fields of a
+// level, so the keys of the whole level are loaded in one batch.
+func thunk[V any](load func() (V, error)) func() (any, error) {
+	return func() (any, error) {
+		v, err := load()
+		if err != nil {
+			return nil, toResolverError(err)
+		}
+		return v, nil
+	}
+}
+
+// userIdFrom returns the id of the user authenticated by utils.Auth.OptionalJWTAuthMiddleware.
+func userIdFrom(ctx context.Context) (int, bool) {
+	userId, ok := ctx.Value("userId").(int)
+	return userId, ok
+}
+
+// tagType is a tag of posts.
+var tagType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Tag",
+	Description: "A tag of posts.",
+	Fields: graphql.Fields{
+		"id":   {Type: graphql.NewNonNull(graphql.Int)},
+		"name": {Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// NewSchema builds the GraphQL schema, resolved through store.
+func NewSchema(store repo.Storer) (graphql.Schema, error) {
+	var userType, postType, commentType *graphql.Object
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A registered user.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.Int)},
+				"fullName":  {Type: graphql.NewNonNull(graphql.String)},
+				"username":  {Type: graphql.NewNonNull(graphql.String)},
+				"email":     {Type: graphql.NewNonNull(graphql.String)},
+				"bio":       {Type: graphql.NewNonNull(graphql.String)},
+				"joinedAt":  {Type: graphql.NewNonNull(graphql.DateTime)},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.DateTime)},
+				"version":   {Type: graphql.NewNonNull(graphql.Int)},
+				"posts": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+					Description: "The posts of the user, oldest first.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						user := p.Source.(*models.User)
+						return thunk(loadersFrom(p.Context).postsByAuthor.load(p.Context, user.Id)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Post",
+		Description: "A blog post.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.Int)},
+				"title":     {Type: graphql.NewNonNull(graphql.String)},
+				"content":   {Type: graphql.NewNonNull(graphql.String)},
+				"authorId":  {Type: graphql.NewNonNull(graphql.Int)},
+				"createdAt": {Type: graphql.NewNonNull(graphql.DateTime)},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.DateTime)},
+				"version":   {Type: graphql.NewNonNull(graphql.Int)},
+				"author": {
+					Type:        userType,
+					Description: "The author of the post.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						post := p.Source.(*models.Post)
+						return thunk(loadersFrom(p.Context).users.load(p.Context, post.AuthorId)), nil
+					},
+				},
+				"comments": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+					Description: "The comments on the post, oldest first.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						post := p.Source.(*models.Post)
+						return thunk(loadersFrom(p.Context).commentsByPost.load(p.Context, post.Id)), nil
+					},
+				},
+				"tags": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+					Description: "The tags of the post, by name.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						post := p.Source.(*models.Post)
+						return thunk(loadersFrom(p.Context).tagsByPost.load(p.Context, post.Id)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	commentType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Comment",
+		Description: "A comment on a post.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        {Type: graphql.NewNonNull(graphql.Int)},
+				"content":   {Type: graphql.NewNonNull(graphql.String)},
+				"postId":    {Type: graphql.NewNonNull(graphql.Int)},
+				"authorId":  {Type: graphql.NewNonNull(graphql.Int)},
+				"createdAt": {Type: graphql.NewNonNull(graphql.DateTime)},
+				"author": {
+					Type:        userType,
+					Description: "The author of the comment.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						comment := p.Source.(*models.Comment)
+						return thunk(loadersFrom(p.Context).users.load(p.Context, comment.AuthorId)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": {
+				Type:        userType,
+				Description: "The user with the given id or username, or null if there is none.",
+				Args: graphql.FieldConfigArgument{
+					"id":       {Type: graphql.Int},
+					"username": {Type: graphql.String},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams) (any, error) {
+					if id, ok := p.Args["id"].(int); ok {
+						return thunk(loadersFrom(p.Context).users.load(p.Context, id)), nil
+					}
+					username, ok := p.Args["username"].(string)
+					if !ok {
+						return nil, resolverError{message: "either id or username is required", code: utils.CodeBadRequest}
+					}
+					user, err := store.GetUserByUsername(p.Context, username)
+					if errors.Is(err, repo.ErrNotFound) {
+						return nil, nil
+					}
+					return user, err
+				}),
+			},
+			"users": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Description: "All users, by id.",
+				Resolve: resolve(func(p graphql.ResolveParams) (any, error) {
+					return store.GetAllUsers(p.Context)
+				}),
+			},
+			"post": {
+				Type:        postType,
+				Description: "The post with the given id, or null if there is none.",
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams) (any, error) {
+					post, err := store.GetPostById(p.Context, p.Args["id"].(int))
+					if errors.Is(err, repo.ErrNotFound) {
+						return nil, nil
+					}
+					return post, err
+				}),
+			},
+			"posts": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+				Description: "All posts, or those of one author, by id.",
+				Args: graphql.FieldConfigArgument{
+					"authorId": {Type: graphql.Int},
+				},
+				Resolve: resolve(func(p graphql.ResolveParams) (any, error) {
+					if authorId, ok := p.Args["authorId"].(int); ok {
+						return store.GetAllPostsByAuthor(p.Context, authorId)
+					}
+					return store.GetAllPosts(p.Context)
+				}),
+			},
+			"me": {
+				Type:        userType,
+				Description: "The user authenticated by the bearer token of the request.",
+				Resolve: resolve(func(p graphql.ResolveParams) (any, error) {
+					userId, ok := userIdFrom(p.Context)
+					if !ok {
+						return nil, resolverError{message: "a bearer token is required", code: CodeUnauthenticated}
+					}
+					return thunk(loadersFrom(p.Context).users.load(p.Context, userId)), nil
+				}),
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		return graphql.Schema{}, fmt.Errorf("invalid GraphQL schema: %w", err)
+	}
+	return schema, nil
+}
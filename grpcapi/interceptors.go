@@ -0,0 +1,162 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	goblogv1 "github.com/assaidy/goblog/proto/goblog/v1"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// protectedMethods are the methods requiring a token, like the protected REST routes.
+var protectedMethods = map[string]bool{
+	goblogv1.UserService_UpdateUser_FullMethodName: true,
+	goblogv1.UserService_DeleteUser_FullMethodName: true,
+	goblogv1.PostService_CreatePost_FullMethodName: true,
+	goblogv1.PostService_UpdatePost_FullMethodName: true,
+	goblogv1.PostService_DeletePost_FullMethodName: true,
+}
+
+// interceptors authenticate calls with the tokens of auth.
+type interceptors struct {
+	auth *utils.Auth
+}
+
+// authenticate returns the context of a call to method: a repo session, so reads that follow a write
+// within the call are served from the primary, the address of the client, and the ID of the user whose
+// token is in the "authorization" metadata. Calls to protected methods without a valid token are rejected.
+func (i interceptors) authenticate(ctx context.Context, method string) (context.Context, error) {
+	ctx = repo.WithSession(ctx)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		ctx = utils.ContextWithClientIP(ctx, host)
+	}
+
+	var token string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		token = values[0]
+	}
+	if token == "" {
+		if protectedMethods[method] {
+			return nil, utils.UnAuthorized(fmt.Errorf("missing authorization metadata"))
+		}
+		return ctx, nil
+	}
+
+	userId, err := i.auth.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ContextWithUserID(ctx, userId), nil
+}
+
+func (i interceptors) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := i.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i interceptors) streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream is a stream with another context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// unaryErrorInterceptor is the gRPC counterpart of utils.MakeHandlerFunc: it logs errors and
+// translates them to statuses.
+func unaryErrorInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		slog.Error("gRPC API error", "err", err.Error(), "method", info.FullMethod)
+		return nil, toStatus(err)
+	}
+	return resp, nil
+}
+
+func streamErrorInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := handler(srv, ss); err != nil {
+		slog.Error("gRPC API error", "err", err.Error(), "method", info.FullMethod)
+		return toStatus(err)
+	}
+	return nil
+}
+
+// toStatus translates an error into a gRPC status through utils.ToApiError, so both APIs agree on
+// which errors clients see. The API error code is sent as the reason of an ErrorInfo detail, and
+// field errors as a BadRequest detail. Errors that already are statuses are kept.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	apiErr := utils.ToApiError(err)
+	st := status.New(codeForStatus(apiErr.Status), apiErr.Detail)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: apiErr.Code, Domain: "goblog"}}
+	if len(apiErr.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fieldErr := range apiErr.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations,
+				&errdetails.BadRequest_FieldViolation{Field: fieldErr.Field, Description: fieldErr.Message})
+		}
+		details = append(details, badRequest)
+	}
+	if apiErr.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(apiErr.RetryAfter)})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// codeForStatus returns the gRPC code of an HTTP status.
+func codeForStatus(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,393 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goblogv1 "github.com/assaidy/goblog/proto/goblog/v1"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
+	"github.com/assaidy/goblog/router"
+	"github.com/assaidy/goblog/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// apis serves the REST and the gRPC API over one store, so tests can check they agree.
+type apis struct {
+	rest  http.Handler
+	users goblogv1.UserServiceClient
+	posts goblogv1.PostServiceClient
+}
+
+func newAPIs(t *testing.T) *apis {
+	t.Helper()
+	store, err := sqlite_repo.NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := sqlite_repo.Migrate(store.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	// Tokens issued by either API are accepted by the other.
+	auth := utils.NewAuth("parity-test-secret", time.Hour, nil, nil)
+	srv := NewServer(store, auth)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &apis{
+		rest:  router.NewRouter(store, router.Options{Auth: auth}),
+		users: goblogv1.NewUserServiceClient(conn),
+		posts: goblogv1.NewPostServiceClient(conn),
+	}
+}
+
+// do sends a REST request and decodes the response into v, if it is not nil. It returns the status.
+func (a *apis) do(t *testing.T, method, path, token, body string, v any) int {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.rest.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response %s: %v", method, path, w.Body, err)
+		}
+	}
+	return w.Code
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// restUser is a user of the v2 REST API.
+type restUser struct {
+	Id       int64     `json:"id"`
+	FullName string    `json:"fullName"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Bio      string    `json:"bio"`
+	JoinedAt time.Time `json:"joinedAt"`
+	Version  int64     `json:"version"`
+}
+
+type restPost struct {
+	Id        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	AuthorId  int64     `json:"authorId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int64     `json:"version"`
+}
+
+func TestUsersParity(t *testing.T) {
+	a := newAPIs(t)
+
+	created, err := a.users.Register(context.Background(), &goblogv1.RegisterRequest{
+		FullName: " Jane Doe ", Username: "jane", Email: "jane@example.com", Password: "secret", Bio: "hi",
+	})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	var rest restUser
+	if status := a.do(t, "GET", fmt.Sprintf("/api/v2/users/%d", created.Id), "", "", &rest); status != http.StatusOK {
+		t.Fatalf("GET user: status %d", status)
+	}
+	got := restUser{
+		Id: created.Id, FullName: created.FullName, Username: created.Username, Email: created.Email,
+		Bio: created.Bio, JoinedAt: created.JoinedAt.AsTime(), Version: created.Version,
+	}
+	if !got.JoinedAt.Equal(rest.JoinedAt) {
+		t.Errorf("joinedAt = %v over gRPC, %v over REST", got.JoinedAt, rest.JoinedAt)
+	}
+	got.JoinedAt = rest.JoinedAt
+	if got != rest {
+		t.Errorf("gRPC user %+v, REST user %+v", got, rest)
+	}
+	if got.FullName != "Jane Doe" {
+		t.Errorf("fullName = %q, want it trimmed as REST does", got.FullName)
+	}
+
+	// Tokens of either API work with the other.
+	var login struct{ Token string }
+	a.do(t, "POST", "/api/v2/login", "", `{"username":"jane","password":"secret"}`, &login)
+	if _, err := a.users.UpdateUser(withToken(login.Token), &goblogv1.UpdateUserRequest{
+		Id: created.Id, Version: created.Version, Username: "jane", Email: "jane@example.com", Password: "secret", Bio: "updated",
+	}); err != nil {
+		t.Errorf("UpdateUser with a REST token: %v", err)
+	}
+
+	grpcLogin, err := a.users.Login(context.Background(), &goblogv1.LoginRequest{Username: "jane", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if status := a.do(t, "POST", "/api/v2/posts", grpcLogin.Token,
+		fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, created.Id), nil); status != http.StatusCreated {
+		t.Errorf("POST post with a gRPC token: status %d", status)
+	}
+}
+
+func TestPostsParity(t *testing.T) {
+	a := newAPIs(t)
+
+	var author restUser
+	a.do(t, "POST", "/api/v2/register", "", `{"username":"jane","email":"jane@example.com","password":"secret"}`, &author)
+	login, err := a.users.Login(context.Background(), &goblogv1.LoginRequest{Username: "jane", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	for i := range 3 {
+		if _, err := a.posts.CreatePost(withToken(login.Token), &goblogv1.CreatePostRequest{
+			Title: fmt.Sprintf("post %d", i), Content: "content", AuthorId: author.Id,
+		}); err != nil {
+			t.Fatalf("CreatePost: %v", err)
+		}
+	}
+
+	var rest struct{ Data []restPost }
+	a.do(t, "GET", fmt.Sprintf("/api/v2/users/%d/posts", author.Id), "", "", &rest)
+
+	list, err := a.posts.ListPosts(context.Background(), &goblogv1.ListPostsRequest{AuthorId: &author.Id})
+	if err != nil {
+		t.Fatalf("ListPosts: %v", err)
+	}
+	stream, err := a.posts.StreamPosts(context.Background(), &goblogv1.ListPostsRequest{})
+	if err != nil {
+		t.Fatalf("StreamPosts: %v", err)
+	}
+	var streamed []*goblogv1.Post
+	for {
+		post, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		streamed = append(streamed, post)
+	}
+
+	if len(rest.Data) != 3 || len(list.Posts) != 3 || len(streamed) != 3 {
+		t.Fatalf("got %d posts over REST, %d listed and %d streamed over gRPC, want 3", len(rest.Data), len(list.Posts), len(streamed))
+	}
+	for i, want := range rest.Data {
+		for _, post := range []*goblogv1.Post{list.Posts[i], streamed[i]} {
+			got := restPost{
+				Id: post.Id, Title: post.Title, Content: post.Content, AuthorId: post.AuthorId,
+				CreatedAt: post.CreatedAt.AsTime(), UpdatedAt: post.UpdatedAt.AsTime(), Version: post.Version,
+			}
+			if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+				t.Errorf("post %d: times differ: gRPC %+v, REST %+v", want.Id, got, want)
+			}
+			got.CreatedAt, got.UpdatedAt = want.CreatedAt, want.UpdatedAt
+			if got != want {
+				t.Errorf("gRPC post %+v, REST post %+v", got, want)
+			}
+		}
+	}
+}
+
+// TestErrorParity checks that both APIs reject the same requests with the same error codes.
+func TestErrorParity(t *testing.T) {
+	a := newAPIs(t)
+
+	var jane, john restUser
+	a.do(t, "POST", "/api/v2/register", "", `{"username":"jane","email":"jane@example.com","password":"secret"}`, &jane)
+	a.do(t, "POST", "/api/v2/register", "", `{"username":"john","email":"john@example.com","password":"secret"}`, &john)
+	var login, janeLogin struct{ Token string }
+	a.do(t, "POST", "/api/v2/login", "", `{"username":"john","password":"secret"}`, &login)
+	a.do(t, "POST", "/api/v2/login", "", `{"username":"jane","password":"secret"}`, &janeLogin)
+	var post restPost
+	a.do(t, "POST", "/api/v2/posts", login.Token, fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, john.Id), &post)
+
+	tests := []struct {
+		name                      string
+		method, path, token, body string
+		ifMatch                   string
+		call                      func() error
+		code                      codes.Code
+	}{
+		{
+			name: "unknown user", method: "GET", path: "/api/v2/users/99",
+			call: func() error {
+				_, err := a.users.GetUser(context.Background(), &goblogv1.GetUserRequest{Key: &goblogv1.GetUserRequest_Id{Id: 99}})
+				return err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "taken username", method: "POST", path: "/api/v2/register",
+			body: `{"username":"jane","email":"other@example.com","password":"secret"}`,
+			call: func() error {
+				_, err := a.users.Register(context.Background(), &goblogv1.RegisterRequest{Username: "jane", Email: "other@example.com", Password: "secret"})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "invalid email", method: "POST", path: "/api/v2/register",
+			body: `{"username":"jim","email":"nope","password":"secret"}`,
+			call: func() error {
+				_, err := a.users.Register(context.Background(), &goblogv1.RegisterRequest{Username: "jim", Email: "nope", Password: "secret"})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "wrong password", method: "POST", path: "/api/v2/login",
+			body: `{"username":"jane","password":"nope"}`,
+			call: func() error {
+				_, err := a.users.Login(context.Background(), &goblogv1.LoginRequest{Username: "jane", Password: "nope"})
+				return err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "no token", method: "POST", path: "/api/v2/posts",
+			body: fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, john.Id),
+			call: func() error {
+				_, err := a.posts.CreatePost(context.Background(), &goblogv1.CreatePostRequest{Title: "t", Content: "c", AuthorId: john.Id})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "invalid token", method: "DELETE", path: fmt.Sprintf("/api/v2/posts/%d", post.Id), token: "nope",
+			call: func() error {
+				_, err := a.posts.DeletePost(withToken("nope"), &goblogv1.DeletePostRequest{Id: post.Id})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "post of another author", method: "POST", path: "/api/v2/posts", token: login.Token,
+			body: fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, jane.Id),
+			call: func() error {
+				_, err := a.posts.CreatePost(withToken(login.Token), &goblogv1.CreatePostRequest{Title: "t", Content: "c", AuthorId: jane.Id})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "update of another author's post", method: "PUT", path: fmt.Sprintf("/api/v2/posts/%d", post.Id), token: janeLogin.Token,
+			body: fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, jane.Id),
+			call: func() error {
+				_, err := a.posts.UpdatePost(withToken(janeLogin.Token), &goblogv1.UpdatePostRequest{
+					Id: post.Id, Title: "t", Content: "c", AuthorId: jane.Id,
+				})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "update of another user", method: "PUT", path: fmt.Sprintf("/api/v2/users/%d", jane.Id), token: login.Token,
+			body: `{"username":"jane","email":"jane@example.com","password":"secret"}`,
+			call: func() error {
+				_, err := a.users.UpdateUser(withToken(login.Token), &goblogv1.UpdateUserRequest{
+					Id: jane.Id, Username: "jane", Email: "jane@example.com", Password: "secret",
+				})
+				return err
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "update of another user with an invalid body", method: "PUT", path: fmt.Sprintf("/api/v2/users/%d", jane.Id), token: login.Token,
+			body: `{"username":"","email":"nope","password":""}`,
+			call: func() error {
+				_, err := a.users.UpdateUser(withToken(login.Token), &goblogv1.UpdateUserRequest{
+					Id: jane.Id, Username: "", Email: "nope", Password: "",
+				})
+				return err
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "deletion of another user", method: "DELETE", path: fmt.Sprintf("/api/v2/users/%d", jane.Id), token: login.Token,
+			call: func() error {
+				_, err := a.users.DeleteUser(withToken(login.Token), &goblogv1.DeleteUserRequest{Id: jane.Id})
+				return err
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "stale version", method: "PUT", path: fmt.Sprintf("/api/v2/posts/%d", post.Id), token: login.Token,
+			body:    fmt.Sprintf(`{"title":"t","content":"c","authorId":%d}`, john.Id),
+			ifMatch: utils.ETag(int(post.Version + 1)),
+			call: func() error {
+				_, err := a.posts.UpdatePost(withToken(login.Token), &goblogv1.UpdatePostRequest{
+					Id: post.Id, Version: post.Version + 1, Title: "t", Content: "c", AuthorId: john.Id,
+				})
+				return err
+			},
+			code: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			a.rest.ServeHTTP(w, r)
+			var problem utils.ApiError
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Code == "" {
+				t.Fatalf("REST: status %d, body %s, want a problem", w.Code, w.Body)
+			}
+
+			st := status.Convert(tt.call())
+			if st.Code() != tt.code {
+				t.Errorf("gRPC code %v, want %v (REST status %d)", st.Code(), tt.code, w.Code)
+			}
+			if codeForStatus(problem.Status) != st.Code() {
+				t.Errorf("REST status %d maps to %v, gRPC answered %v", problem.Status, codeForStatus(problem.Status), st.Code())
+			}
+
+			var reason string
+			var violations int
+			for _, detail := range st.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					reason = detail.Reason
+				case *errdetails.BadRequest:
+					violations = len(detail.FieldViolations)
+				}
+			}
+			if reason != problem.Code {
+				t.Errorf("gRPC reason %q, REST code %q", reason, problem.Code)
+			}
+			if violations != len(problem.Errors) {
+				t.Errorf("gRPC reports %d field violations, REST %d field errors", violations, len(problem.Errors))
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	goblogv1 "github.com/assaidy/goblog/proto/goblog/v1"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+)
+
+type postService struct {
+	goblogv1.UnimplementedPostServiceServer
+	store repo.Storer
+}
+
+// userIdFrom returns the id of the user authenticated by the interceptors.
+func userIdFrom(ctx context.Context) (int, error) {
+	userId, ok := ctx.Value("userId").(int)
+	if !ok {
+		return 0, utils.UnAuthorized(fmt.Errorf("user ID missing or invalid"))
+	}
+	return userId, nil
+}
+
+func (s *postService) GetPost(ctx context.Context, req *goblogv1.GetPostRequest) (*goblogv1.Post, error) {
+	post, err := s.store.GetPostById(ctx, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+	return toPost(post), nil
+}
+
+func (s *postService) ListPosts(ctx context.Context, req *goblogv1.ListPostsRequest) (*goblogv1.ListPostsResponse, error) {
+	posts, err := s.listPosts(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &goblogv1.ListPostsResponse{Posts: make([]*goblogv1.Post, 0, len(posts))}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, toPost(post))
+	}
+	return resp, nil
+}
+
+func (s *postService) StreamPosts(req *goblogv1.ListPostsRequest, stream goblogv1.PostService_StreamPostsServer) error {
+	posts, err := s.listPosts(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if err := stream.Send(toPost(post)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postService) listPosts(ctx context.Context, req *goblogv1.ListPostsRequest) ([]*models.Post, error) {
+	if req.AuthorId != nil {
+		return s.store.GetAllPostsByAuthor(ctx, int(*req.AuthorId))
+	}
+	return s.store.GetAllPosts(ctx)
+}
+
+func (s *postService) CreatePost(ctx context.Context, req *goblogv1.CreatePostRequest) (*goblogv1.Post, error) {
+	postReq := models.PostCreateOrUpdateRequest{Title: req.Title, Content: req.Content, AuthorId: int(req.AuthorId)}
+	if err := utils.ValidateRequest(&postReq); err != nil {
+		return nil, err
+	}
+
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if userId != postReq.AuthorId {
+		return nil, utils.UnAuthorized(fmt.Errorf("your user ID %d does not match the author ID %d", userId, postReq.AuthorId))
+	}
+
+	post, err := s.store.CreatePost(ctx, &models.Post{
+		Title:     postReq.Title,
+		Content:   postReq.Content,
+		AuthorId:  postReq.AuthorId,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toPost(post), nil
+}
+
+func (s *postService) UpdatePost(ctx context.Context, req *goblogv1.UpdatePostRequest) (*goblogv1.Post, error) {
+	updateReq := models.PostCreateOrUpdateRequest{Title: req.Title, Content: req.Content, AuthorId: int(req.AuthorId)}
+	if err := utils.ValidateRequest(&updateReq); err != nil {
+		return nil, err
+	}
+
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := s.store.GetPostById(ctx, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorId != userId {
+		return nil, utils.UnAuthorized(fmt.Errorf("you are not authorized to update this post"))
+	}
+	// The post cannot be handed over to another author
+	if updateReq.AuthorId != userId {
+		return nil, utils.UnAuthorized(fmt.Errorf("your user ID %d does not match the author ID %d", userId, updateReq.AuthorId))
+	}
+
+	post, err = s.store.UpdatePostById(ctx, post.Id, int(req.Version), &updateReq)
+	if err != nil {
+		return nil, err
+	}
+	return toPost(post), nil
+}
+
+func (s *postService) DeletePost(ctx context.Context, req *goblogv1.DeletePostRequest) (*goblogv1.DeletePostResponse, error) {
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := s.store.GetPostById(ctx, int(req.Id))
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorId != userId {
+		return nil, utils.UnAuthorized(fmt.Errorf("you are not authorized to delete this post"))
+	}
+
+	if err := s.store.DeletePostById(ctx, post.Id, userId, int(req.Version)); err != nil {
+		return nil, err
+	}
+	return &goblogv1.DeletePostResponse{}, nil
+}
@@ -0,0 +1,53 @@
+// Package grpcapi serves the gRPC API defined in proto/goblog/v1 over the same repo.Storer and
+// JWTs as the REST API, following the same rules.
+package grpcapi
+
+import (
+	"github.com/assaidy/goblog/models"
+	goblogv1 "github.com/assaidy/goblog/proto/goblog/v1"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewServer returns a gRPC server with the user and post services registered.
+// Requests are authenticated by interceptors, and errors are translated to gRPC statuses.
+// Tokens are issued and verified by auth, shared with the REST API.
+func NewServer(store repo.Storer, auth *utils.Auth, opts ...grpc.ServerOption) *grpc.Server {
+	i := interceptors{auth: auth}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryErrorInterceptor, i.unaryAuth),
+		grpc.ChainStreamInterceptor(streamErrorInterceptor, i.streamAuth),
+	)
+	s := grpc.NewServer(opts...)
+	goblogv1.RegisterUserServiceServer(s, &userService{store: store, auth: auth})
+	goblogv1.RegisterPostServiceServer(s, &postService{store: store})
+	return s
+}
+
+// toUser converts a user to its message, which has no password.
+func toUser(u *models.User) *goblogv1.User {
+	return &goblogv1.User{
+		Id:        int64(u.Id),
+		FullName:  u.FullName,
+		Username:  u.Username,
+		Email:     u.Email,
+		Bio:       u.Bio,
+		JoinedAt:  timestamppb.New(u.JoinedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+		Version:   int64(u.Version),
+	}
+}
+
+func toPost(p *models.Post) *goblogv1.Post {
+	return &goblogv1.Post{
+		Id:        int64(p.Id),
+		Title:     p.Title,
+		Content:   p.Content,
+		AuthorId:  int64(p.AuthorId),
+		CreatedAt: timestamppb.New(p.CreatedAt),
+		UpdatedAt: timestamppb.New(p.UpdatedAt),
+		Version:   int64(p.Version),
+	}
+}
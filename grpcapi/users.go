@@ -0,0 +1,139 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	goblogv1 "github.com/assaidy/goblog/proto/goblog/v1"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+)
+
+type userService struct {
+	goblogv1.UnimplementedUserServiceServer
+	store repo.Storer
+	auth  *utils.Auth
+}
+
+func (s *userService) Register(ctx context.Context, req *goblogv1.RegisterRequest) (*goblogv1.User, error) {
+	registerReq := models.UserRegisterOrUpdateRequest{
+		FullName: req.FullName,
+		Username: req.Username,
+		Email:    req.Email,
+		Password: req.Password,
+		Bio:      req.Bio,
+	}
+	if err := utils.ValidateRequest(&registerReq); err != nil {
+		return nil, err
+	}
+
+	// Check that the username and email are still available
+	if validationErrors, err := utils.ValidateRegisterUser(ctx, registerReq.Username, registerReq.Email, s.store); err != nil {
+		return nil, err
+	} else if len(validationErrors) > 0 {
+		return nil, utils.InvalidFields(validationErrors)
+	}
+
+	user, err := s.store.CreateUser(ctx, &models.User{
+		FullName: registerReq.FullName,
+		Username: registerReq.Username,
+		Email:    registerReq.Email,
+		Password: registerReq.Password,
+		Bio:      registerReq.Bio,
+		JoinedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *userService) Login(ctx context.Context, req *goblogv1.LoginRequest) (*goblogv1.LoginResponse, error) {
+	loginReq := models.UserLoginRequest{Username: req.Username, Password: req.Password}
+	if err := utils.ValidateRequest(&loginReq); err != nil {
+		return nil, err
+	}
+
+	login, err := s.auth.AuthenticateUser(ctx, loginReq, s.store)
+	if err != nil {
+		return nil, err
+	}
+	return &goblogv1.LoginResponse{User: toUser(login.User), Token: login.Token}, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *goblogv1.GetUserRequest) (*goblogv1.User, error) {
+	var user *models.User
+	var err error
+	switch key := req.Key.(type) {
+	case *goblogv1.GetUserRequest_Id:
+		user, err = s.store.GetUserById(ctx, int(key.Id))
+	case *goblogv1.GetUserRequest_Username:
+		user, err = s.store.GetUserByUsername(ctx, key.Username)
+	default:
+		return nil, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "either id or username is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, _ *goblogv1.ListUsersRequest) (*goblogv1.ListUsersResponse, error) {
+	users, err := s.store.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &goblogv1.ListUsersResponse{Users: make([]*goblogv1.User, 0, len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toUser(user))
+	}
+	return resp, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *goblogv1.UpdateUserRequest) (*goblogv1.User, error) {
+	if err := authorizeUser(ctx, int(req.Id)); err != nil {
+		return nil, err
+	}
+	updateReq := models.UserRegisterOrUpdateRequest{
+		FullName: req.FullName,
+		Username: req.Username,
+		Email:    req.Email,
+		Password: req.Password,
+		Bio:      req.Bio,
+	}
+	if err := utils.ValidateRequest(&updateReq); err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.UpdateUserById(ctx, int(req.Id), int(req.Version), &updateReq)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *goblogv1.DeleteUserRequest) (*goblogv1.DeleteUserResponse, error) {
+	if err := authorizeUser(ctx, int(req.Id)); err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteUserById(ctx, int(req.Id), int(req.Version)); err != nil {
+		return nil, err
+	}
+	return &goblogv1.DeleteUserResponse{}, nil
+}
+
+// authorizeUser checks that the authenticated user is the user id, as users may only change their own account.
+func authorizeUser(ctx context.Context, id int) error {
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if userId != id {
+		return utils.Forbidden(fmt.Errorf("you may only change your own account, not user %d", id))
+	}
+	return nil
+}
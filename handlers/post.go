@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/assaidy/goblog/models"
@@ -15,47 +14,35 @@ import (
 )
 
 type PostHandler struct {
-	store repo.Storer
+	store   repo.Storer
+	present Presenter
 }
 
-func NewPostHandler(store repo.Storer) *PostHandler {
-	return &PostHandler{store: store}
+func NewPostHandler(store repo.Storer, present Presenter) *PostHandler {
+	return &PostHandler{store: store, present: present}
 }
 
 func (h *PostHandler) HandleGetAllPosts(w http.ResponseWriter, r *http.Request) error {
-	posts, err := h.store.GetAllPosts()
+	posts, err := h.store.GetAllPosts(r.Context())
 	if err != nil {
 		return err
 	}
-	return utils.WriteJSON(w, http.StatusOK, posts)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Posts(posts))
 }
 
 func (h *PostHandler) HandleGetAllPostsByUser(w http.ResponseWriter, r *http.Request) error {
 	userId, _ := strconv.Atoi(mux.Vars(r)["userId"])
-	posts, err := h.store.GetAllPostsByAuthor(userId)
+	posts, err := h.store.GetAllPostsByAuthor(r.Context(), userId)
 	if err != nil {
 		return err
 	}
-	return utils.WriteJSON(w, http.StatusOK, posts)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Posts(posts))
 }
 
 func (h *PostHandler) HandleCreatePost(w http.ResponseWriter, r *http.Request) error {
 	var postReq models.PostCreateOrUpdateRequest
-
-	// Decode JSON request body
-	if err := json.NewDecoder(r.Body).Decode(&postReq); err != nil {
-		r.Body.Close()
-		return utils.InvalidJSON()
-	}
-	defer r.Body.Close()
-
-	// Trim input fields
-	postReq.Title = strings.TrimSpace(postReq.Title)
-	postReq.Content = strings.TrimSpace(postReq.Content)
-
-	// Check for required fields
-	if postReq.Title == "" || postReq.Content == "" {
-		return utils.InvalidRequestData([]string{"title and content are required"})
+	if err := utils.DecodeAndValidateJSON(r, &postReq); err != nil {
+		return err
 	}
 
 	// Retrieve userId from context
@@ -79,34 +66,42 @@ func (h *PostHandler) HandleCreatePost(w http.ResponseWriter, r *http.Request) e
 	}
 
 	// Store the post
-	postResp, err := h.store.CreatePost(&post)
+	postResp, err := h.store.CreatePost(r.Context(), &post)
 	if err != nil {
 		return err
 	}
 
 	// Respond with the created post
-	return utils.WriteJSON(w, http.StatusCreated, postResp)
+	utils.SetValidators(w, postResp.Version, postResp.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusCreated, h.present.Post(postResp))
 }
 
 func (h *PostHandler) HandleGetPostById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	post, err := h.store.GetPostById(id)
+	post, err := h.store.GetPostById(r.Context(), id)
 	if err != nil {
 		return err
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, post)
+	if utils.CheckNotModified(w, r, post.Version, post.UpdatedAt) {
+		return nil
+	}
+	return utils.WriteJSON(w, http.StatusOK, h.present.Post(post))
 }
 
 func (h *PostHandler) HandleUpdatePostById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+
 	var updateReq models.PostCreateOrUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
-		return utils.InvalidJSON()
+	if err := utils.DecodeAndValidateJSON(r, &updateReq); err != nil {
+		return err
 	}
-	defer r.Body.Close()
 
 	// Retrieve userId from context
 	userId, ok := r.Context().Value("userId").(int)
@@ -114,22 +109,98 @@ func (h *PostHandler) HandleUpdatePostById(w http.ResponseWriter, r *http.Reques
 		return utils.UnAuthorized(fmt.Errorf("user ID missing or invalid"))
 	}
 
-	// Check if the author ID matches the user ID
-	if userId != updateReq.AuthorId {
+	// Fetch the post to ensure it exists and to check authorization
+	post, err := h.store.GetPostById(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	// Only the author may update the post
+	if post.AuthorId != userId {
+		return utils.UnAuthorized(fmt.Errorf("you are not authorized to update this post"))
+	}
+
+	// The post cannot be handed over to another author
+	if updateReq.AuthorId != userId {
 		return utils.UnAuthorized(fmt.Errorf("your user ID %d does not match the author ID %d", userId, updateReq.AuthorId))
 	}
 
-	post, err := h.store.UpdatePostById(id, &updateReq)
+	post, err = h.store.UpdatePostById(r.Context(), id, version, &updateReq)
 	if err != nil {
 		return err
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, post)
+	utils.SetValidators(w, post.Version, post.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Post(post))
+}
+
+// HandlePatchPostById applies a merge patch or JSON patch to the post and validates the result.
+// The update is conditional on the version the patch was applied to, so concurrent writes are never lost.
+func (h *PostHandler) HandlePatchPostById(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	w.Header().Set("Accept-Patch", utils.AcceptPatch)
+
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+
+	// Retrieve userId from context
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		return utils.UnAuthorized(fmt.Errorf("user ID missing or invalid"))
+	}
+
+	post, err := h.store.GetPostById(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	// Only the author may patch the post
+	if post.AuthorId != userId {
+		return utils.UnAuthorized(fmt.Errorf("you are not authorized to update this post"))
+	}
+	if version != repo.AnyVersion && version != post.Version {
+		return utils.PreconditionFailed(fmt.Errorf("post %d is at version %d, not %d", id, post.Version, version))
+	}
+
+	updateReq := models.PostCreateOrUpdateRequest{
+		Title:    post.Title,
+		Content:  post.Content,
+		AuthorId: post.AuthorId,
+	}
+	if err := utils.DecodePatch(r, &updateReq); err != nil {
+		return err
+	}
+	if err := utils.ValidateRequest(&updateReq); err != nil {
+		return err
+	}
+
+	// The post cannot be handed over to another author
+	if updateReq.AuthorId != userId {
+		return utils.UnAuthorized(fmt.Errorf("your user ID %d does not match the author ID %d", userId, updateReq.AuthorId))
+	}
+
+	post, err = h.store.UpdatePostById(r.Context(), id, post.Version, &updateReq)
+	if errors.Is(err, repo.ErrVersionMismatch) && version == repo.AnyVersion {
+		return utils.Conflict(fmt.Errorf("post %d was modified while the patch was applied, retry the request", id))
+	}
+	if err != nil {
+		return err
+	}
+
+	utils.SetValidators(w, post.Version, post.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Post(post))
 }
 
 func (h *PostHandler) HandleDeletePostById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+
 	// Retrieve userId from context
 	userId, ok := r.Context().Value("userId").(int)
 	if !ok {
@@ -137,9 +208,9 @@ func (h *PostHandler) HandleDeletePostById(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Fetch the post to ensure it exists and to check authorization
-	post, err := h.store.GetPostById(id)
+	post, err := h.store.GetPostById(r.Context(), id)
 	if err != nil {
-		return utils.NotFound(fmt.Errorf("post with id %d not found", id))
+		return err
 	}
 
 	// Check if the user is the author of the post
@@ -148,7 +219,7 @@ func (h *PostHandler) HandleDeletePostById(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Proceed with deletion
-	if err := h.store.DeletePostById(id, userId); err != nil {
+	if err := h.store.DeletePostById(r.Context(), id, userId, version); err != nil {
 		return err
 	}
 
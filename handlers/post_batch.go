@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/utils"
+)
+
+// HandleBatchGetPosts returns the posts with the given ids, in the order of the ids.
+// Unknown ids get a not found result instead of failing the request.
+func (h *PostHandler) HandleBatchGetPosts(w http.ResponseWriter, r *http.Request) error {
+	var batchReq models.PostBatchGetRequest
+	if err := utils.DecodeAndValidateJSON(r, &batchReq); err != nil {
+		return err
+	}
+
+	posts, err := h.store.GetPostsByIds(r.Context(), batchReq.Ids)
+	if err != nil {
+		return err
+	}
+	byId := make(map[int]*models.Post, len(posts))
+	for _, post := range posts {
+		byId[post.Id] = post
+	}
+
+	results := make([]models.PostResult, len(batchReq.Ids))
+	for i, id := range batchReq.Ids {
+		if post, ok := byId[id]; ok {
+			results[i] = models.PostResult{Status: http.StatusOK, Post: post}
+		} else {
+			results[i] = failed(r, repo.NotFoundf("no post with id %d", id))
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, h.present.PostResults(results))
+}
+
+// HandleBulkPosts applies a list of create, update and delete operations, with the same
+// authorization rules as the single post routes, and returns the result of each one.
+//
+// In transaction mode the operations are applied in one transaction, up to the first that fails:
+// it gets its error, and every other operation a bulk_aborted error, as none of them is applied.
+// In best effort mode every operation is applied on its own.
+// Either way the response is 200; the status of each operation is in its result.
+func (h *PostHandler) HandleBulkPosts(w http.ResponseWriter, r *http.Request) error {
+	var bulkReq models.PostBulkRequest
+	if err := utils.DecodeAndValidateJSON(r, &bulkReq); err != nil {
+		return err
+	}
+
+	// Retrieve userId from context
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		return utils.UnAuthorized(fmt.Errorf("user ID missing or invalid"))
+	}
+
+	// Invalid operations fail before anything is applied
+	results := make([]models.PostResult, len(bulkReq.Operations))
+	for i := range bulkReq.Operations {
+		if err := validateOperation(&bulkReq.Operations[i], userId); err != nil {
+			results[i] = failed(r, err)
+		}
+	}
+
+	bulk := &bulkPosts{r: r, userId: userId, ops: bulkReq.Operations, results: results}
+	if bulkReq.Mode == models.BulkBestEffort {
+		bulk.apply(h.store, false)
+	} else {
+		err := firstError(results)
+		if err == nil {
+			err = h.store.InTx(r.Context(), func(tx repo.Storer) error {
+				return bulk.apply(tx, true)
+			})
+		}
+		if err != nil {
+			bulk.abort(err)
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, h.present.PostResults(results))
+}
+
+// validateOperation validates op like the single post routes validate their requests.
+func validateOperation(op *models.PostBulkOperation, userId int) error {
+	if err := utils.ValidateRequest(op); err != nil {
+		return err
+	}
+	if op.Post == nil {
+		return nil
+	}
+	if err := utils.ValidateRequest(op.Post); err != nil {
+		return err
+	}
+
+	// Check if the author ID matches the user ID
+	if userId != op.Post.AuthorId {
+		return utils.UnAuthorized(fmt.Errorf("your user ID %d does not match the author ID %d", userId, op.Post.AuthorId))
+	}
+	return nil
+}
+
+// bulkPosts applies the operations of a bulk request and collects their results.
+// Operations whose result already is an error are skipped.
+type bulkPosts struct {
+	r       *http.Request
+	userId  int
+	ops     []models.PostBulkOperation
+	results []models.PostResult
+}
+
+// apply applies the operations in order, inserting consecutive creates together.
+// With stopOnError it returns the error of the first operation that fails, without applying the rest.
+func (b *bulkPosts) apply(store repo.Storer, stopOnError bool) error {
+	ctx := b.r.Context()
+	for i := 0; i < len(b.ops); {
+		if b.results[i].Err != nil {
+			i++
+			continue
+		}
+
+		if b.ops[i].Op != models.BulkCreate {
+			b.results[i] = b.applyOne(ctx, store, b.ops[i])
+			if err := b.results[i].Err; err != nil && stopOnError {
+				return err
+			}
+			i++
+			continue
+		}
+
+		end := i
+		var posts []*models.Post
+		for ; end < len(b.ops) && b.ops[end].Op == models.BulkCreate && b.results[end].Err == nil; end++ {
+			posts = append(posts, newPost(b.ops[end].Post))
+		}
+
+		_, err := store.CreatePosts(ctx, posts)
+		switch {
+		case err == nil:
+			for j, post := range posts {
+				b.results[i+j] = models.PostResult{Status: http.StatusCreated, Post: post}
+			}
+		case stopOnError:
+			for j := range posts {
+				b.results[i+j] = failed(b.r, err)
+			}
+			return err
+		default:
+			// Create the posts one by one, so only the failing ones fail.
+			for j, post := range posts {
+				if _, err := store.CreatePost(ctx, post); err != nil {
+					b.results[i+j] = failed(b.r, err)
+				} else {
+					b.results[i+j] = models.PostResult{Status: http.StatusCreated, Post: post}
+				}
+			}
+		}
+		i = end
+	}
+	return nil
+}
+
+// applyOne applies an update or a delete. Like PATCH and DELETE, only the author may change a post.
+func (b *bulkPosts) applyOne(ctx context.Context, store repo.Storer, op models.PostBulkOperation) models.PostResult {
+	post, err := store.GetPostById(ctx, op.Id)
+	if err != nil {
+		return failed(b.r, err)
+	}
+	if post.AuthorId != b.userId {
+		return failed(b.r, utils.UnAuthorized(fmt.Errorf("you are not authorized to %s post %d", op.Op, op.Id)))
+	}
+
+	if op.Op == models.BulkDelete {
+		if err := store.DeletePostById(ctx, op.Id, b.userId, op.Version); err != nil {
+			return failed(b.r, err)
+		}
+		return models.PostResult{Status: http.StatusNoContent}
+	}
+
+	post, err = store.UpdatePostById(ctx, op.Id, op.Version, op.Post)
+	if err != nil {
+		return failed(b.r, err)
+	}
+	return models.PostResult{Status: http.StatusOK, Post: post}
+}
+
+// abort records that a transaction failed with err: none of the operations was applied.
+// The operations that did not fail themselves get a bulk_aborted error.
+func (b *bulkPosts) abort(err error) {
+	cause := -1
+	for i, result := range b.results {
+		if result.Err != nil {
+			cause = i
+			break
+		}
+	}
+	if cause == -1 {
+		// The transaction itself failed, e.g. to commit.
+		for i := range b.results {
+			b.results[i] = failed(b.r, err)
+		}
+		return
+	}
+
+	aborted := utils.NewProblem(http.StatusFailedDependency, utils.CodeBulkAborted,
+		fmt.Sprintf("not applied, as operations[%d] failed", cause))
+	for i, result := range b.results {
+		if result.Err == nil {
+			b.results[i] = models.PostResult{Status: aborted.Status, Err: aborted}
+		}
+	}
+}
+
+// failed returns the result of an item that failed with err, logging errors that are not the client's.
+func failed(r *http.Request, err error) models.PostResult {
+	status := utils.ToApiError(err).Status
+	if status >= http.StatusInternalServerError {
+		utils.Logger(r.Context()).Error("HTTP API error", "err", err.Error(), "path", r.URL.Path)
+	}
+	return models.PostResult{Status: status, Err: err}
+}
+
+// firstError returns the first error among results, if any.
+func firstError(results []models.PostResult) error {
+	for _, result := range results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+func newPost(postReq *models.PostCreateOrUpdateRequest) *models.Post {
+	now := time.Now().UTC()
+	return &models.Post{
+		Title:     postReq.Title,
+		Content:   postReq.Content,
+		AuthorId:  postReq.AuthorId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import "github.com/assaidy/goblog/models"
+
+// Presenter turns models into the response bodies of one version of the API,
+// so the models can change without changing what clients of released versions receive.
+type Presenter interface {
+	User(*models.User) any
+	Users([]*models.User) any
+	Login(*models.UserLoginResponse) any
+	Post(*models.Post) any
+	Posts([]*models.Post) any
+	// PostResults renders the outcomes of a batch request, in the order of its items.
+	PostResults([]models.PostResult) any
+}
@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/assaidy/goblog/models"
@@ -15,43 +14,35 @@ import (
 )
 
 type UserHandler struct {
-	store repo.Storer
+	store   repo.Storer
+	present Presenter
+	auth    *utils.Auth
 }
 
-func NewUserHandler(store repo.Storer) *UserHandler {
-	return &UserHandler{store: store}
+// NewUserHandler returns a UserHandler logging users in with auth.
+func NewUserHandler(store repo.Storer, present Presenter, auth *utils.Auth) *UserHandler {
+	return &UserHandler{store: store, present: present, auth: auth}
 }
 
 func (h *UserHandler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) error {
-	users, err := h.store.GetAllUsers()
+	users, err := h.store.GetAllUsers(r.Context())
 	if err != nil {
 		return err
 	}
-	return utils.WriteJSON(w, http.StatusOK, users)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Users(users))
 }
 
 func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) error {
 	var registerReq models.UserRegisterOrUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&registerReq); err != nil {
-		return utils.InvalidJSON()
-	}
-	defer r.Body.Close()
-
-	// Trim input fields
-	registerReq.Username = strings.TrimSpace(registerReq.Username)
-	registerReq.Email = strings.TrimSpace(registerReq.Email)
-	registerReq.Password = strings.TrimSpace(registerReq.Password)
-
-	// Check for required fields
-	if registerReq.Username == "" || registerReq.Email == "" || registerReq.Password == "" {
-		return utils.InvalidRequestData([]string{"Username, email, and password are required"})
+	if err := utils.DecodeAndValidateJSON(r, &registerReq); err != nil {
+		return err
 	}
 
-	// Validate user input
-	if validationErrors, err := utils.ValidateRegisterUser(registerReq.Username, registerReq.Email, h.store); err != nil {
+	// Check that the username and email are still available
+	if validationErrors, err := utils.ValidateRegisterUser(r.Context(), registerReq.Username, registerReq.Email, h.store); err != nil {
 		return err
 	} else if len(validationErrors) > 0 {
-		return utils.InvalidRequestData(validationErrors)
+		return utils.InvalidFields(validationErrors)
 	}
 
 	user := models.User{
@@ -63,7 +54,7 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		JoinedAt: time.Now().UTC(),
 	}
 
-	userResp, err := h.store.CreateUser(&user)
+	userResp, err := h.store.CreateUser(r.Context(), &user)
 	if err != nil {
 		return err
 	}
@@ -71,83 +62,160 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	// Clear password before sending response
 	userResp.Password = ""
 
-	return utils.WriteJSON(w, http.StatusCreated, userResp)
+	utils.SetValidators(w, userResp.Version, userResp.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusCreated, h.present.User(userResp))
 }
 
 func (h *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) error {
 	var loginReq models.UserLoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		log.Println(err)
-		return utils.InvalidJSON()
-	}
-	defer r.Body.Close()
-
-	// Trim input fields
-	loginReq.Username = strings.TrimSpace(loginReq.Username)
-	loginReq.Password = strings.TrimSpace(loginReq.Password)
-
-	// Check for required fields
-	if loginReq.Username == "" || loginReq.Password == "" {
-		return utils.InvalidRequestData([]string{"Username and password are required"})
+	if err := utils.DecodeAndValidateJSON(r, &loginReq); err != nil {
+		return err
 	}
 
-	user, err := utils.AuthenticateUser(loginReq, h.store)
+	login, err := h.auth.AuthenticateUser(r.Context(), loginReq, h.store)
 	if err != nil {
 		return err
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, user)
+	return utils.WriteJSON(w, http.StatusOK, h.present.Login(login))
 }
 
 func (h *UserHandler) HandleGetUserById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	user, err := h.store.GetUserById(id)
+	user, err := h.store.GetUserById(r.Context(), id)
 	if err != nil {
 		return err
 	}
 	user.Password = ""
 
-	return utils.WriteJSON(w, http.StatusOK, user)
+	if utils.CheckNotModified(w, r, user.Version, user.UpdatedAt) {
+		return nil
+	}
+	return utils.WriteJSON(w, http.StatusOK, h.present.User(user))
 }
 
 func (h *UserHandler) HandleGetUserByUsername(w http.ResponseWriter, r *http.Request) error {
 	username := mux.Vars(r)["username"]
 
-	user, err := h.store.GetUserByUsername(username)
+	user, err := h.store.GetUserByUsername(r.Context(), username)
 	if err != nil {
 		return err
 	}
 	user.Password = ""
 
-	return utils.WriteJSON(w, http.StatusOK, user)
+	if utils.CheckNotModified(w, r, user.Version, user.UpdatedAt) {
+		return nil
+	}
+	return utils.WriteJSON(w, http.StatusOK, h.present.User(user))
 }
 
 func (h *UserHandler) HandleUpdateUserById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := authorizeUser(r, id); err != nil {
+		return err
+	}
+
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
 
 	var updateReq models.UserRegisterOrUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
-		return utils.InvalidJSON()
+	if err := utils.DecodeAndValidateJSON(r, &updateReq); err != nil {
+		return err
+	}
+
+	user, err := h.store.UpdateUserById(r.Context(), id, version, &updateReq)
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+
+	utils.SetValidators(w, user.Version, user.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusOK, h.present.User(user))
+}
+
+// HandlePatchUserById applies a merge patch or JSON patch to the user and validates the result.
+// The password is left out of the patched document, so it can be set but never read through
+// test or copy operations; it is kept unchanged unless the patch sets it.
+// The update is conditional on the version the patch was applied to, so concurrent writes are never lost.
+func (h *UserHandler) HandlePatchUserById(w http.ResponseWriter, r *http.Request) error {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := authorizeUser(r, id); err != nil {
+		return err
 	}
-	defer r.Body.Close()
+	w.Header().Set("Accept-Patch", utils.AcceptPatch)
 
-	user, err := h.store.UpdateUserById(id, &updateReq)
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+
+	// The password is kept when the patch does not set it.
+	user, err := h.store.GetUserById(repo.WithCredentials(r.Context()), id)
+	if err != nil {
+		return err
+	}
+	if version != repo.AnyVersion && version != user.Version {
+		return utils.PreconditionFailed(fmt.Errorf("user %d is at version %d, not %d", id, user.Version, version))
+	}
+
+	updateReq := models.UserRegisterOrUpdateRequest{
+		FullName: user.FullName,
+		Username: user.Username,
+		Email:    user.Email,
+		Bio:      user.Bio,
+	}
+	if err := utils.DecodePatch(r, &updateReq); err != nil {
+		return err
+	}
+	if updateReq.Password == "" {
+		updateReq.Password = user.Password
+	}
+	if err := utils.ValidateRequest(&updateReq); err != nil {
+		return err
+	}
+
+	user, err = h.store.UpdateUserById(r.Context(), id, user.Version, &updateReq)
+	if errors.Is(err, repo.ErrVersionMismatch) && version == repo.AnyVersion {
+		return utils.Conflict(fmt.Errorf("user %d was modified while the patch was applied, retry the request", id))
+	}
 	if err != nil {
 		return err
 	}
 	user.Password = ""
 
-	return utils.WriteJSON(w, http.StatusOK, user)
+	utils.SetValidators(w, user.Version, user.UpdatedAt)
+	return utils.WriteJSON(w, http.StatusOK, h.present.User(user))
 }
 
 func (h *UserHandler) HandleDeleteUserById(w http.ResponseWriter, r *http.Request) error {
 	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := authorizeUser(r, id); err != nil {
+		return err
+	}
+
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
 
-	if err := h.store.DeleteUserById(id); err != nil {
+	if err := h.store.DeleteUserById(r.Context(), id, version); err != nil {
 		return err
 	}
 
 	return utils.WriteJSON(w, http.StatusOK, nil)
 }
 
+// authorizeUser checks that the client is the user id, the only one who may change or delete the account.
+func authorizeUser(r *http.Request, id int) error {
+	userId, err := utils.GetUserIDFromContext(r)
+	if err != nil {
+		return err
+	}
+	if userId != id {
+		return utils.Forbidden(fmt.Errorf("you may only change your own account, not user %d", id))
+	}
+	return nil
+}
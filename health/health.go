@@ -0,0 +1,134 @@
+// Package health serves the probes of the orchestrator: /healthz tells whether the process is alive,
+// /readyz whether it can serve requests, by checking the dependencies it needs.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses of a report and of its checks.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// Check reports why a dependency cannot be used, or nil. It must give up when ctx is done.
+type Check func(ctx context.Context) error
+
+// Report is the body of a probe response.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check. Duration is a Go duration such as "1.5ms".
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Checker runs the readiness checks. Checks are added while the application is set up,
+// before the probes are served.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecker returns a Checker that gives each check at most timeout to pass.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers a readiness check under name, replacing any check with the same name.
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs all checks concurrently, each within the timeout, and reports their results.
+// The report passes if every check does.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusPass, Checks: make(map[string]CheckResult, len(c.names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range c.names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusPass {
+				report.Status = StatusFail
+			}
+		}(name, c.checks[name])
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := make(chan error, 1)
+	// A check that ignores its context still cannot hold up the probe.
+	go func() { err <- check(ctx) }()
+
+	result := CheckResult{Status: StatusPass}
+	select {
+	case e := <-err:
+		if e != nil {
+			result.Status, result.Error = StatusFail, e.Error()
+		}
+	case <-ctx.Done():
+		result.Status, result.Error = StatusFail, ctx.Err().Error()
+	}
+	result.Duration = time.Since(start).String()
+	return result
+}
+
+// LivenessHandler answers /healthz. The process is alive as long as it answers, so it always passes.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusPass})
+	})
+}
+
+// ReadinessHandler answers /readyz with the report of c: 200 if it passes, 503 otherwise.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusPass {
+			status = http.StatusServiceUnavailable
+			slog.Warn("Not ready", "checks", report.Checks)
+		}
+		writeReport(w, status, report)
+	})
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	// Probes must see the current state, never a cached one.
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
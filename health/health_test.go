@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("database", func(context.Context) error { return nil })
+	checker.Add("migrations", func(context.Context) error { return nil })
+
+	probe := func() (int, Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		checker.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid report %s: %v", w.Body, err)
+		}
+		return w.Code, report
+	}
+
+	if code, report := probe(); code != http.StatusOK || report.Status != StatusPass || len(report.Checks) != 2 {
+		t.Fatalf("all checks passing: %d %+v", code, report)
+	}
+
+	checker.Add("migrations", func(context.Context) error { return errors.New("2 migrations not applied") })
+	// A check that hangs is cut short by the timeout, even if it ignores its context.
+	checker.Add("workers", func(context.Context) error { select {} })
+	code, report := probe()
+	if code != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Fatalf("failing checks: %d %+v", code, report)
+	}
+	want := map[string]CheckResult{
+		"database":   {Status: StatusPass},
+		"migrations": {Status: StatusFail, Error: "2 migrations not applied"},
+		"workers":    {Status: StatusFail, Error: context.DeadlineExceeded.Error()},
+	}
+	for name, result := range report.Checks {
+		result.Duration = ""
+		if result != want[name] {
+			t.Errorf("check %s = %+v, want %+v", name, result, want[name])
+		}
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	w := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("status %d, headers %v", w.Code, w.Header())
+	}
+}
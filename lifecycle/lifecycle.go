@@ -0,0 +1,215 @@
+// Package lifecycle starts the components of the application, such as servers, background workers
+// and connection pools, in the order they were registered, and stops them in the reverse order,
+// so servers stop taking requests before the resources serving them go away.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hook is how a component is started and stopped. Either function may be nil.
+type Hook struct {
+	Name string
+	// Start starts the component. Components that keep running, like servers, do their work in
+	// the background and return. A hook without Start wraps a resource that is already open, and
+	// is stopped even if the lifecycle never starts.
+	Start func(ctx context.Context) error
+	// Stop stops the component, giving up when ctx is done.
+	Stop func(ctx context.Context) error
+}
+
+// Lifecycle is a registry of the components of the application.
+type Lifecycle struct {
+	mu    sync.Mutex
+	hooks []*entry
+
+	stopping atomic.Bool
+	failed   chan error
+}
+
+type entry struct {
+	Hook
+	started bool
+}
+
+// New returns an empty Lifecycle.
+func New() *Lifecycle {
+	return &Lifecycle{failed: make(chan error, 1)}
+}
+
+// Append registers a component. Components are started in the order they are appended.
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, &entry{Hook: hook, started: hook.Start == nil})
+}
+
+// Start starts the components that are not started yet, in order, and stops at the first that fails.
+// The components started so far keep running until Stop is called.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.hooks {
+		if e.started {
+			continue
+		}
+		if err := e.Start(ctx); err != nil {
+			return fmt.Errorf("starting %s: %w", e.Name, err)
+		}
+		e.started = true
+		slog.Info("Started component", "component", e.Name)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order. Every component is stopped even if another
+// fails to; their errors are returned together.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.stopping.Store(true)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		e := l.hooks[i]
+		if !e.started {
+			continue
+		}
+		e.started = false
+		if e.Stop == nil {
+			continue
+		}
+
+		start := time.Now()
+		if err := e.Stop(ctx); err != nil {
+			slog.Error("Failed to stop component", "component", e.Name, "err", err.Error())
+			errs = append(errs, fmt.Errorf("stopping %s: %w", e.Name, err))
+			continue
+		}
+		slog.Info("Stopped component", "component", e.Name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+// Stopping reports whether Stop was called, so components can tell that they are about to go away.
+func (l *Lifecycle) Stopping() bool {
+	return l.stopping.Load()
+}
+
+// Check fails once Stop was called, or while components are not started yet.
+// It is a readiness check: load balancers stop sending requests as soon as the shutdown begins.
+func (l *Lifecycle) Check(ctx context.Context) error {
+	if l.Stopping() {
+		return errors.New("shutting down")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var pending []string
+	for _, e := range l.hooks {
+		if !e.started {
+			pending = append(pending, e.Name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("not started: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Fail reports that a running component failed, which makes Run stop the application.
+// Only the first failure is kept.
+func (l *Lifecycle) Fail(err error) {
+	select {
+	case l.failed <- err:
+	default:
+	}
+}
+
+// Run starts the components and runs until ctx is done, typically on a signal, or a component fails.
+// Then it stops every component, all within the timeout, and returns what went wrong, if anything.
+func (l *Lifecycle) Run(ctx context.Context, timeout time.Duration) error {
+	err := l.Start(ctx)
+	if err == nil {
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down", "timeout", timeout)
+		case err = <-l.failed:
+			slog.Error("Shutting down after a failure", "err", err.Error())
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	return errors.Join(err, l.Stop(stopCtx))
+}
+
+// Delay returns a hook whose Stop waits for d, or until its context is done. Appended last, it is
+// stopped first, while Check already fails, which gives load balancers the time to notice
+// before the servers stop.
+func Delay(name string, d time.Duration) Hook {
+	return Hook{
+		Name: name,
+		Stop: func(ctx context.Context) error {
+			select {
+			case <-time.After(d):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Server returns the hook of a server. Start listens on addr, so a port in use fails the start,
+// then calls serve in the background; an error it returns other than http.ErrServerClosed is
+// reported to Fail. Stop calls shutdown, which should stop accepting connections and wait for
+// the ones in flight until its context is done.
+func (l *Lifecycle) Server(name, addr string, serve func(net.Listener) error, shutdown func(context.Context) error) Hook {
+	return Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			var lc net.ListenConfig
+			listener, err := lc.Listen(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			slog.Info("Listening", "component", name, "addr", listener.Addr().String())
+
+			go func() {
+				if err := serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					l.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+			return nil
+		},
+		Stop: shutdown,
+	}
+}
+
+// HTTPServer returns the hook of srv, listening on srv.Addr, serving HTTPS with the certificates
+// of srv.TLSConfig if it is set. Stop lets the requests in flight finish, and closes the connections
+// still open when ctx is done.
+func (l *Lifecycle) HTTPServer(name string, srv *http.Server) Hook {
+	serve := srv.Serve
+	if srv.TLSConfig != nil {
+		serve = func(listener net.Listener) error { return srv.ServeTLS(listener, "", "") }
+	}
+	return l.Server(name, srv.Addr, serve, func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			srv.Close()
+		}
+		return err
+	})
+}
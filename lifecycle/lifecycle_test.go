@@ -0,0 +1,204 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder appends the events of the hooks it creates to a log.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) hook(name string, startErr error) Hook {
+	return Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			r.events = append(r.events, "start "+name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestStartAndStopOrder(t *testing.T) {
+	rec := &recorder{}
+	lc := New()
+	lc.Append(Hook{Name: "db", Stop: func(context.Context) error {
+		rec.events = append(rec.events, "stop db")
+		return nil
+	}})
+	lc.Append(rec.hook("worker", nil))
+	lc.Append(rec.hook("server", nil))
+
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if lc.Stopping() {
+		t.Fatalf("Stopping before Stop")
+	}
+	if err := lc.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !lc.Stopping() {
+		t.Fatalf("not Stopping after Stop")
+	}
+
+	want := []string{"start worker", "start server", "stop server", "stop worker", "stop db"}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Fatalf("events = %v, want %v", rec.events, want)
+	}
+}
+
+func TestFailedStartStopsStartedComponents(t *testing.T) {
+	rec := &recorder{}
+	lc := New()
+	lc.Append(rec.hook("worker", nil))
+	lc.Append(rec.hook("server", errors.New("port in use")))
+	lc.Append(rec.hook("never", nil))
+
+	err := lc.Run(context.Background(), time.Second)
+	if err == nil || !strings.Contains(err.Error(), "starting server: port in use") {
+		t.Fatalf("Run error = %v, want the start failure", err)
+	}
+
+	want := []string{"start worker", "start server", "stop worker"}
+	if !reflect.DeepEqual(rec.events, want) {
+		t.Fatalf("events = %v, want %v", rec.events, want)
+	}
+}
+
+func TestStopErrorsDoNotStopOthers(t *testing.T) {
+	rec := &recorder{}
+	lc := New()
+	lc.Append(rec.hook("db", nil))
+	lc.Append(Hook{Name: "broken", Stop: func(context.Context) error { return errors.New("stuck") }})
+	lc.Start(context.Background())
+
+	if err := lc.Stop(context.Background()); err == nil || !strings.Contains(err.Error(), "stopping broken: stuck") {
+		t.Fatalf("Stop error = %v, want the failure of broken", err)
+	}
+	if rec.events[len(rec.events)-1] != "stop db" {
+		t.Fatalf("db was not stopped: %v", rec.events)
+	}
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	rec := &recorder{}
+	lc := New()
+	lc.Append(rec.hook("worker", nil))
+
+	go lc.Fail(errors.New("worker crashed"))
+	err := lc.Run(context.Background(), time.Second)
+	if err == nil || err.Error() != "worker crashed" {
+		t.Fatalf("Run error = %v, want the failure", err)
+	}
+	if want := []string{"start worker", "stop worker"}; !reflect.DeepEqual(rec.events, want) {
+		t.Fatalf("events = %v, want %v", rec.events, want)
+	}
+}
+
+// TestHTTPServerDrainsRequests checks that shutting down lets a request in flight finish,
+// while new connections are refused.
+func TestHTTPServerDrainsRequests(t *testing.T) {
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	// Pick a free port up front, so the test knows where to connect.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		<-release
+		io.WriteString(w, "done")
+	})}
+	lc := New()
+	lc.Append(lc.HTTPServer("http", srv))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- lc.Run(ctx, 5*time.Second) }()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{string(body), err}
+	}()
+
+	<-inFlight
+	cancel()
+	for i := 0; i < 50 && !lc.Stopping(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give Shutdown the time to close the listener.
+	time.Sleep(50 * time.Millisecond)
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("new connection accepted during shutdown")
+	}
+
+	close(release)
+	if resp := <-responses; resp.err != nil || resp.body != "done" {
+		t.Fatalf("request in flight got %q, %v; want it to complete", resp.body, resp.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	lc := New()
+	lc.Append(Hook{Name: "server", Start: func(context.Context) error { return nil }})
+	lc.Append(Hook{Name: "db"})
+
+	ctx := context.Background()
+	if err := lc.Check(ctx); err == nil || err.Error() != "not started: server" {
+		t.Fatalf("Check before Start = %v, want the server not started", err)
+	}
+	lc.Start(ctx)
+	if err := lc.Check(ctx); err != nil {
+		t.Fatalf("Check after Start = %v", err)
+	}
+
+	// Check fails while the first components stop.
+	checked := make(chan error, 1)
+	lc.Append(Hook{Name: "delay", Stop: func(ctx context.Context) error {
+		checked <- lc.Check(ctx)
+		return nil
+	}})
+	lc.Stop(ctx)
+	if err := <-checked; err == nil {
+		t.Fatalf("Check during Stop passed")
+	}
+}
@@ -0,0 +1,95 @@
+// Package metrics holds the Prometheus metrics of the application and serves them at /metrics.
+// The packages being measured update the collectors declared here.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the metrics of the application.
+const namespace = "goblog"
+
+// Registry holds every metric served by Handler: those below, and the metrics of the Go runtime and the process.
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics, labeled by method, route template (such as /api/v2/posts/{id:[0-9]+}) and status code.
+// Requests matching no route have the route "unmatched", so clients cannot create series at will.
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "http", Name: "requests_total",
+		Help: "HTTP requests served.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+		Help:    "Time to serve HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	// HTTPPanics counts the handlers that panicked; their requests are also counted as 500s.
+	HTTPPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "http", Name: "panics_total",
+		Help: "Panics recovered while serving HTTP requests.",
+	}, []string{"route"})
+	// RateLimited counts the requests rejected by a rate limit, labeled by the name of its policy.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "http", Name: "rate_limited_total",
+		Help: "HTTP requests rejected by a rate limit.",
+	}, []string{"policy"})
+)
+
+// StoreDuration measures the calls to the repo.Storer, labeled by method and by result, "ok" or "error".
+// Calls returning a repo error such as ErrNotFound count as errors.
+var StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace, Subsystem: "store", Name: "call_duration_seconds",
+	Help:    "Time taken by calls to the store.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"method", "result"})
+
+// Business events. Writes are counted once committed.
+var (
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "registrations_total",
+		Help: "Users registered.",
+	})
+	Logins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "logins_total",
+		Help: "Successful logins.",
+	})
+	FailedLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "failed_logins_total",
+		Help: "Logins rejected for an unknown username or a wrong password.",
+	})
+	LockedLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "locked_logins_total",
+		Help: "Logins rejected as the username is locked out after failed logins.",
+	})
+	PostsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Name: "posts_created_total",
+		Help: "Posts created.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration, HTTPPanics, RateLimited,
+		StoreDuration,
+		Registrations, Logins, FailedLogins, LockedLogins, PostsCreated,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db, such as open and idle connections
+// and waits for a connection, with the label db_name set to name.
+func RegisterDB(name string, db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Comment is a comment left by a user on a post.
+type Comment struct {
+	Id        int       `json:"id"`
+	Content   string    `json:"content"`
+	PostId    int       `json:"postId"`
+	AuthorId  int       `json:"authorId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
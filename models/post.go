@@ -1,7 +1,7 @@
 package models
 
 import (
-	"strings"
+	"fmt"
 	"time"
 )
 
@@ -12,24 +12,92 @@ type Post struct {
 	AuthorId  int       `json:"authorId"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
 }
 
+// PostCreateOrUpdateRequest is used for creating or replacing a post.
 type PostCreateOrUpdateRequest struct {
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	AuthorId int    `json:"authorId"`
-}
-
-// Validate checks if the PostCreateOrUpdateRequest fields are valid.
-func (r *PostCreateOrUpdateRequest) Validate() []string {
-	var errors []string
-	r.Title = strings.TrimSpace(r.Title)
-	r.Content = strings.TrimSpace(r.Content)
-	if r.Title == "" {
-		errors = append(errors, "title is required")
+	Title    string `json:"title" validate:"trim,required,max=255"`
+	Content  string `json:"content" validate:"trim,required"`
+	AuthorId int    `json:"authorId" validate:"required"`
+}
+
+// MaxPostBatch is the most posts a batchGet or bulk request may address.
+const MaxPostBatch = 1000
+
+// PostBatchGetRequest lists the ids of the posts to read in one request.
+type PostBatchGetRequest struct {
+	Ids []int `json:"ids" validate:"required"`
+}
+
+// Validate bounds the number of ids.
+func (r *PostBatchGetRequest) Validate() map[string]string {
+	if r.Ids != nil && len(r.Ids) == 0 {
+		return map[string]string{"ids": "ids cannot be empty"}
 	}
-	if r.Content == "" {
-		errors = append(errors, "content is required")
+	if len(r.Ids) > MaxPostBatch {
+		return map[string]string{"ids": fmt.Sprintf("ids cannot list more than %d posts", MaxPostBatch)}
 	}
-	return errors
+	return nil
+}
+
+// Modes of a bulk request.
+const (
+	// BulkTransaction applies all operations in one transaction: all of them succeed, or none is applied.
+	BulkTransaction = "transaction"
+	// BulkBestEffort applies every operation on its own, so some may succeed while others fail.
+	BulkBestEffort = "bestEffort"
+)
+
+// Operations of a bulk request.
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// PostBulkRequest is a list of operations on posts, applied in order. Mode defaults to BulkTransaction.
+type PostBulkRequest struct {
+	Mode       string              `json:"mode" validate:"oneof=transaction bestEffort"`
+	Operations []PostBulkOperation `json:"operations" validate:"required"`
+}
+
+// Validate bounds the number of operations.
+func (r *PostBulkRequest) Validate() map[string]string {
+	if r.Operations != nil && len(r.Operations) == 0 {
+		return map[string]string{"operations": "operations cannot be empty"}
+	}
+	if len(r.Operations) > MaxPostBatch {
+		return map[string]string{"operations": fmt.Sprintf("operations cannot list more than %d operations", MaxPostBatch)}
+	}
+	return nil
+}
+
+// PostBulkOperation is one operation of a bulk request. Updates and deletes take the id of the post,
+// and the version it must be at like If-Match does, 0 meaning any. Creates and updates take the post.
+type PostBulkOperation struct {
+	Op      string                     `json:"op" validate:"required,oneof=create update delete"`
+	Id      int                        `json:"id,omitempty"`
+	Version int                        `json:"version,omitempty"`
+	Post    *PostCreateOrUpdateRequest `json:"post,omitempty"`
+}
+
+// Validate checks that the operation has the fields its kind needs.
+func (o *PostBulkOperation) Validate() map[string]string {
+	errs := map[string]string{}
+	if (o.Op == BulkUpdate || o.Op == BulkDelete) && o.Id == 0 {
+		errs["id"] = "id is required to " + o.Op + " a post"
+	}
+	if (o.Op == BulkCreate || o.Op == BulkUpdate) && o.Post == nil {
+		errs["post"] = "post is required to " + o.Op + " a post"
+	}
+	return errs
+}
+
+// PostResult is the outcome of one item of a batch request: the post, or the error it failed with.
+// Status is the HTTP status the item would have been answered with as a request of its own.
+type PostResult struct {
+	Status int
+	Post   *Post
+	Err    error
 }
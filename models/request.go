@@ -1,7 +1,7 @@
 package models
 
-// TODO: apply to the code
-// Request is an interface for different request types.
+// Request is implemented by request bodies that need checks beyond their `validate` struct tags.
+// Validate runs after the tag rules and returns error messages keyed by the JSON name of the offending field.
 type Request interface {
-	Validate() []string
+	Validate() map[string]string
 }
@@ -0,0 +1,7 @@
+package models
+
+// Tag is a label posts are tagged with. Names are unique.
+type Tag struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
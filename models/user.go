@@ -2,35 +2,52 @@ package models
 
 import (
 	"time"
+	"unicode"
 )
 
 // User represents a user entity in the system.
 // This struct is used to store and retrieve user information from the database.
 // Fields like `Password` should be handled securely (e.g., hashed and not exposed in responses).
 type User struct {
-	Id       int       `json:"id"`
-	FullName string    `json:"fullName"`
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
-	Password string    `json:"password"`
-	Bio      string    `json:"bio"`
-	JoinedAt time.Time `json:"joinedAt"`
+	Id        int       `json:"id"`
+	FullName  string    `json:"fullName"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	Bio       string    `json:"bio"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
 }
 
 // UserRegisterOrUpdateRequest is used for creating or updating a user account.
 // It contains the data required from the client to register or modify a user's information.
 type UserRegisterOrUpdateRequest struct {
-	FullName string `json:"fullName"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Bio      string `json:"bio"`
+	FullName string `json:"fullName" validate:"trim,max=100"`
+	Username string `json:"username" validate:"trim,required,max=100"`
+	Email    string `json:"email" validate:"trim,required,max=100,email"`
+	Password string `json:"password" validate:"trim,required,max=255"`
+	Bio      string `json:"bio" validate:"trim"`
+}
+
+// Validate rejects usernames starting with a digit, which would be mistaken for ids in /api/users/{id}.
+func (r *UserRegisterOrUpdateRequest) Validate() map[string]string {
+	if r.Username != "" && unicode.IsDigit(rune(r.Username[0])) {
+		return map[string]string{"username": "username cannot start with a number"}
+	}
+	return nil
 }
 
 // UserLoginRequest is used for user login requests.
 // It contains the essential fields required to authenticate a user.
 type UserLoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"trim,required"`
+	Password string `json:"password" validate:"trim,required"`
 }
 
+// UserLoginResponse is returned by a successful login. Token authenticates later requests
+// as a bearer token in the Authorization header.
+type UserLoginResponse struct {
+	User  *User  `json:"user"`
+	Token string `json:"token"`
+}
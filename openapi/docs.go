@@ -0,0 +1,25 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// docsPage renders an OpenAPI document in the browser. It loads nothing but the document
+// itself, so the docs work offline.
+//
+//go:embed docs.html
+var docsPage string
+
+// DocsHandler serves an interactive documentation page for the document at specURL.
+func DocsHandler(specURL string) http.Handler {
+	// specURL ends up in a JavaScript string literal.
+	page := strings.Replace(docsPage, "{{SPEC_URL}}", template.JSEscapeString(specURL), 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+}
@@ -0,0 +1,286 @@
+// Package openapi builds an OpenAPI 3.1 document from route descriptions and Go model types,
+// and serves it along with a self-contained documentation page.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.1.0"
+
+// ProblemMediaType is the media type of error responses.
+const ProblemMediaType = "application/problem+json"
+
+// Operation describes one route: its documentation, parameters, request body and responses.
+// Path parameters are derived from the route's path template and need not be listed.
+type Operation struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	// Auth marks routes that require a bearer token.
+	Auth bool
+	// Params are the header and query parameters of the route, and extra details of path parameters.
+	Params []Parameter
+	// Request holds a zero value of the request body per media type, e.g. {"application/json": models.User{}}.
+	Request map[string]any
+	// Responses maps status codes to responses. Error statuses are answered with Problem bodies.
+	Responses  map[int]Response
+	Deprecated bool
+}
+
+// Parameter describes a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// Response describes a response. Body is a zero value of the JSON response body, or nil if there is none.
+type Response struct {
+	Description string
+	Body        any
+	// Headers maps the names of response headers to their descriptions.
+	Headers map[string]string
+}
+
+// Document is an OpenAPI document. Build one with New and Add.
+type Document struct {
+	OpenAPI    string                        `json:"openapi"`
+	Info       Info                          `json:"info"`
+	Paths      map[string]map[string]*pathOp `json:"paths"`
+	Components components                    `json:"components"`
+	Tags       []tag                         `json:"tags,omitempty"`
+	tagSet     map[string]bool
+	// schemaNames holds the component names of the struct types described so far.
+	schemaNames map[reflect.Type]string
+	problem     any
+}
+
+// Info holds the metadata of the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes,omitempty"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type tag struct {
+	Name string `json:"name"`
+}
+
+type pathOp struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Headers     map[string]header    `json:"headers,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// bearerAuth is the name of the security scheme of routes with Auth set.
+const bearerAuth = "bearerAuth"
+
+// New creates an empty document. problem is a zero value of the body of error responses.
+func New(info Info, problem any) *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*pathOp{},
+		Components: components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]securityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		tagSet:      map[string]bool{},
+		schemaNames: map[reflect.Type]string{},
+		problem:     problem,
+	}
+	return d
+}
+
+// pathParam matches the variables of gorilla/mux path templates, e.g. {id} or {id:[0-9]+}.
+var pathParam = regexp.MustCompile(`\{([^{}:]+)(?::((?:[^{}]|\{[^{}]*\})*))?\}`)
+
+// Add documents the route with the given method and path template. Templates use the
+// gorilla/mux syntax; patterns of path variables are dropped from the documented path.
+// It returns an error if the method and path are documented already.
+func (d *Document) Add(method, template string, op Operation) error {
+	path := pathParam.ReplaceAllString(template, "{$1}")
+	method = strings.ToLower(method)
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = map[string]*pathOp{}
+		d.Paths[path] = item
+	}
+	if _, ok := item[method]; ok {
+		return fmt.Errorf("openapi: %s %s is documented twice", strings.ToUpper(method), path)
+	}
+
+	out := &pathOp{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Responses:   map[string]response{},
+		Deprecated:  op.Deprecated,
+	}
+	for _, t := range op.Tags {
+		if !d.tagSet[t] {
+			d.tagSet[t] = true
+			d.Tags = append(d.Tags, tag{Name: t})
+		}
+	}
+
+	out.Parameters = d.parameters(template, op.Params)
+
+	if len(op.Request) > 0 {
+		out.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{}}
+		for media, model := range op.Request {
+			out.RequestBody.Content[media] = mediaType{Schema: d.schemaFor(model)}
+		}
+	}
+
+	for status, resp := range op.Responses {
+		out.Responses[strconv.Itoa(status)] = d.response(status, resp)
+	}
+	// Any route can fail with a problem, e.g. a 500.
+	out.Responses["default"] = d.response(http.StatusInternalServerError, Response{Description: "Error"})
+
+	if op.Auth {
+		out.Security = []map[string][]string{{bearerAuth: {}}}
+		if _, ok := out.Responses["401"]; !ok {
+			out.Responses["401"] = d.response(http.StatusUnauthorized, Response{Description: "a missing or invalid token"})
+		}
+	}
+
+	item[method] = out
+	return nil
+}
+
+// parameters returns the path parameters of template, completed by params, followed by the other params.
+func (d *Document) parameters(template string, params []Parameter) []Parameter {
+	var out []Parameter
+	for _, m := range pathParam.FindAllStringSubmatch(template, -1) {
+		p := Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		if m[2] == "[0-9]+" {
+			p.Schema = &Schema{Type: "integer", Minimum: intPtr(0)}
+		} else if m[2] != "" {
+			p.Schema.Pattern = "^" + m[2] + "$"
+		}
+		for _, extra := range params {
+			if extra.In == "path" && extra.Name == p.Name {
+				p.Description = extra.Description
+				if extra.Schema != nil {
+					p.Schema = extra.Schema
+				}
+			}
+		}
+		out = append(out, p)
+	}
+	for _, p := range params {
+		if p.In != "path" {
+			if p.Schema == nil {
+				p.Schema = &Schema{Type: "string"}
+			}
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (d *Document) response(status int, resp Response) response {
+	out := response{Description: resp.Description}
+	if out.Description == "" {
+		out.Description = http.StatusText(status)
+	}
+
+	switch {
+	case resp.Body != nil:
+		out.Content = map[string]mediaType{"application/json": {Schema: d.schemaFor(resp.Body)}}
+	case status >= 400 && d.problem != nil:
+		out.Content = map[string]mediaType{ProblemMediaType: {Schema: d.schemaFor(d.problem)}}
+	}
+
+	if len(resp.Headers) > 0 {
+		out.Headers = map[string]header{}
+		for name, description := range resp.Headers {
+			out.Headers[name] = header{Description: description, Schema: &Schema{Type: "string"}}
+		}
+	}
+	return out
+}
+
+// Operations returns the documented operations as "METHOD /path" strings, sorted.
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// Handler serves the document as JSON. It is encoded on the first request,
+// so routes may still be added after the handler is created.
+func (d *Document) Handler() http.Handler {
+	encode := sync.OnceValues(func() ([]byte, error) { return json.Marshal(d) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := encode()
+		if err != nil {
+			http.Error(w, "cannot encode the OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,228 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema object, limited to the keywords the generator emits.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// partial marks a request body whose fields are all optional, see Partial.
+type partial struct{ model any }
+
+// Partial documents a body with the fields of model, none of them required,
+// such as a JSON merge patch of it.
+func Partial(model any) any { return partial{model} }
+
+// jsonPatch marks a JSON patch document, see JSONPatch.
+type jsonPatch struct{}
+
+// JSONPatch documents an RFC 6902 JSON patch body.
+var JSONPatch any = jsonPatch{}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of model's type. Named struct types are added to the
+// components of the document once and referenced from then on.
+func (d *Document) schemaFor(model any) *Schema {
+	switch m := model.(type) {
+	case partial:
+		s := *d.inlineSchema(reflect.TypeOf(m.model))
+		s.Required = nil
+		return &s
+	case jsonPatch:
+		return d.jsonPatchSchema()
+	}
+	return d.typeSchema(reflect.TypeOf(model))
+}
+
+func (d *Document) typeSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.inlineSchema(t)
+		}
+		name, ok := d.schemaNames[t]
+		if !ok {
+			name = d.componentName(t)
+			// Reserve the name first, so recursive types terminate.
+			d.schemaNames[t] = name
+			d.Components.Schemas[name] = nil
+			d.Components.Schemas[name] = d.inlineSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// componentName names the component of struct type t after the type. Types of different packages
+// sharing a name, such as the User types of two API versions, are told apart by prefixing the
+// package name to all but the first one registered.
+func (d *Document) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := d.Components.Schemas[name]; !taken {
+		return name
+	}
+	pkg := path.Base(t.PkgPath())
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+// inlineSchema returns the object schema of struct type t, built from the json and validate tags of its fields.
+func (d *Document) inlineSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// Request bodies mark their required fields with validate tags. Every field of
+	// other types is present in the JSON document unless marked omitempty.
+	request := isRequestType(t)
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := d.typeSchema(field.Type)
+		if rules, ok := field.Tag.Lookup("validate"); ok {
+			if applyRules(prop, rules) {
+				s.Required = append(s.Required, name)
+			}
+		} else if !request && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+// isRequestType reports whether struct type t has validate tags, which only request bodies have.
+func isRequestType(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("validate"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules translates the rules of a validate tag (see utils.ValidateStruct) into schema keywords,
+// and reports whether the field is required.
+func applyRules(s *Schema, tag string) (required bool) {
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "required":
+			required = true
+			if s.Type == "string" && s.MinLength == nil {
+				s.MinLength = intPtr(1)
+			}
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+			switch {
+			case s.Type == "string" && name == "min":
+				s.MinLength = intPtr(n)
+			case s.Type == "string":
+				s.MaxLength = intPtr(n)
+			case name == "min":
+				s.Minimum = intPtr(n)
+			default:
+				s.Maximum = intPtr(n)
+			}
+		case "email":
+			s.Format = "email"
+		case "oneof":
+			s.Enum = strings.Fields(arg)
+		case "regex":
+			s.Pattern = arg
+		}
+	}
+	return required
+}
+
+// jsonPatchSchema returns the schema of a JSON patch document, an array of operations.
+func (d *Document) jsonPatchSchema() *Schema {
+	const name = "JSONPatchOperation"
+	if _, ok := d.Components.Schemas[name]; !ok {
+		d.Components.Schemas[name] = &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"op":    {Type: "string", Enum: []string{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  {Type: "string", Description: "JSON pointer to the target location"},
+				"from":  {Type: "string", Description: "JSON pointer to the source location of move and copy"},
+				"value": {Description: "value of add, replace and test"},
+			},
+			Required: []string{"op", "path"},
+		}
+	}
+	return &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/" + name}}
+}
+
+func intPtr(n int) *int { return &n }
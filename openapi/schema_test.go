@@ -0,0 +1,166 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAuthor struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type testArticle struct {
+	Id       int         `json:"id"`
+	Title    string      `json:"title"`
+	Author   *testAuthor `json:"author"`
+	Tags     []string    `json:"tags,omitempty"`
+	Created  time.Time   `json:"createdAt"`
+	internal string
+	Skipped  string `json:"-"`
+}
+
+type testRequest struct {
+	Title  string `json:"title" validate:"trim,required,max=100"`
+	Email  string `json:"email" validate:"trim,max=50,email"`
+	Status string `json:"status" validate:"oneof=draft published"`
+	Slug   string `json:"slug" validate:"regex=^[a-z]+(-[a-z]+)*$"`
+	Stars  int    `json:"stars" validate:"min=1,max=5"`
+	Note   string `json:"note"`
+}
+
+func TestSchemaForResponse(t *testing.T) {
+	d := New(Info{}, nil)
+
+	s := d.schemaFor([]testArticle{})
+	if s.Type != "array" || s.Items.Ref != "#/components/schemas/testArticle" {
+		t.Fatalf("got %+v, want an array of testArticle references", s)
+	}
+
+	article := d.Components.Schemas["testArticle"]
+	if article == nil {
+		t.Fatal("testArticle is not a component")
+	}
+	if want := []string{"id", "title", "author", "createdAt"}; !reflect.DeepEqual(article.Required, want) {
+		t.Errorf("required = %v, want %v", article.Required, want)
+	}
+	if len(article.Properties) != 5 {
+		t.Errorf("properties = %v, want id, title, author, tags and createdAt", article.Properties)
+	}
+	if got := article.Properties["author"].Ref; got != "#/components/schemas/testAuthor" {
+		t.Errorf("author = %q, want a reference", got)
+	}
+	if _, ok := d.Components.Schemas["testAuthor"]; !ok {
+		t.Error("testAuthor is not a component")
+	}
+	if got := article.Properties["createdAt"]; got.Type != "string" || got.Format != "date-time" {
+		t.Errorf("createdAt = %+v, want a date-time string", got)
+	}
+	if got := article.Properties["tags"]; got.Type != "array" || got.Items.Type != "string" {
+		t.Errorf("tags = %+v, want an array of strings", got)
+	}
+}
+
+func TestSchemaForRequest(t *testing.T) {
+	d := New(Info{}, nil)
+	d.schemaFor(testRequest{})
+	s := d.Components.Schemas["testRequest"]
+
+	if want := []string{"title"}; !reflect.DeepEqual(s.Required, want) {
+		t.Errorf("required = %v, want %v", s.Required, want)
+	}
+
+	title := s.Properties["title"]
+	if *title.MinLength != 1 || *title.MaxLength != 100 {
+		t.Errorf("title = %+v, want a length of 1 to 100", title)
+	}
+	if email := s.Properties["email"]; email.Format != "email" || *email.MaxLength != 50 {
+		t.Errorf("email = %+v, want an email of at most 50 characters", email)
+	}
+	if status := s.Properties["status"]; !reflect.DeepEqual(status.Enum, []string{"draft", "published"}) {
+		t.Errorf("status enum = %v", status.Enum)
+	}
+	if slug := s.Properties["slug"]; slug.Pattern != "^[a-z]+(-[a-z]+)*$" {
+		t.Errorf("slug pattern = %q", slug.Pattern)
+	}
+	if stars := s.Properties["stars"]; stars.Type != "integer" || *stars.Minimum != 1 || *stars.Maximum != 5 {
+		t.Errorf("stars = %+v, want an integer from 1 to 5", stars)
+	}
+	if note := s.Properties["note"]; note.Type != "string" {
+		t.Errorf("note = %+v, want an optional string", note)
+	}
+}
+
+func TestSchemaForPatches(t *testing.T) {
+	d := New(Info{}, nil)
+
+	merge := d.schemaFor(Partial(testRequest{}))
+	if merge.Ref != "" || merge.Required != nil || merge.Properties["title"] == nil {
+		t.Errorf("merge patch = %+v, want testRequest inline without required fields", merge)
+	}
+
+	patch := d.schemaFor(JSONPatch)
+	if patch.Type != "array" || patch.Items.Ref != "#/components/schemas/JSONPatchOperation" {
+		t.Errorf("JSON patch = %+v, want an array of operations", patch)
+	}
+}
+
+func TestAddDerivesPathParameters(t *testing.T) {
+	d := New(Info{}, nil)
+
+	op := Operation{ID: "getArticle", Params: []Parameter{
+		{Name: "slug", In: "path", Description: "the slug"},
+		{Name: "If-None-Match", In: "header"},
+	}}
+	if err := d.Add("GET", "/articles/{id:[0-9]+}/{slug}", op); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add("GET", "/articles/{id}/{slug:[a-z]+}", op); err == nil {
+		t.Error("documenting the same path twice succeeded")
+	}
+
+	got := d.Paths["/articles/{id}/{slug}"]["get"]
+	if got == nil {
+		t.Fatalf("paths = %v", d.Operations())
+	}
+	if len(got.Parameters) != 3 {
+		t.Fatalf("parameters = %+v", got.Parameters)
+	}
+	if id := got.Parameters[0]; id.Name != "id" || id.In != "path" || !id.Required || id.Schema.Type != "integer" {
+		t.Errorf("id = %+v, want a required integer path parameter", id)
+	}
+	if slug := got.Parameters[1]; slug.Name != "slug" || slug.Description != "the slug" || slug.Schema.Type != "string" {
+		t.Errorf("slug = %+v", slug)
+	}
+	if h := got.Parameters[2]; h.Name != "If-None-Match" || h.In != "header" {
+		t.Errorf("header = %+v", h)
+	}
+	if _, ok := got.Responses["default"]; !ok {
+		t.Error("no default response")
+	}
+}
+
+// Cookie shares its name with http.Cookie.
+type Cookie struct {
+	Flavor string `json:"flavor"`
+}
+
+func TestSchemaNamesOfTypesSharingAName(t *testing.T) {
+	d := New(Info{}, nil)
+
+	ours := d.schemaFor(Cookie{})
+	theirs := d.schemaFor(http.Cookie{})
+	again := d.schemaFor(&Cookie{})
+
+	if ours.Ref != "#/components/schemas/Cookie" || again.Ref != ours.Ref {
+		t.Errorf("got %q and %q, want both to reference Cookie", ours.Ref, again.Ref)
+	}
+	if theirs.Ref != "#/components/schemas/HttpCookie" {
+		t.Errorf("got %q, want a reference to HttpCookie", theirs.Ref)
+	}
+	if d.Components.Schemas["HttpCookie"].Properties["Name"] == nil {
+		t.Error("HttpCookie does not describe http.Cookie")
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// KV is where a Lockout keeps its state. It must not evict entries before their TTL, or attackers
+// could flush lockouts by filling it: cache_repo.ExpiringCache fits in memory, and RedisCache in Redis.
+type KV interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// LockoutPolicy tells when and for how long accounts are locked out.
+type LockoutPolicy struct {
+	// MaxFailures is the number of failed attempts allowed before the first lockout.
+	MaxFailures int
+	// Duration is how long the first lockout lasts. Each further failure doubles it, up to MaxDuration.
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// Lockout locks keys, such as usernames, out after repeated failures, for longer after each further
+// one. Failures are forgotten after a success, or MaxDuration after the last lockout ends.
+// Concurrent failures of a key may be counted once, which only delays its lockout.
+type Lockout struct {
+	store  KV
+	policy LockoutPolicy
+	now    func() time.Time
+}
+
+// lockoutState is what the store holds per key.
+type lockoutState struct {
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// NewLockout returns a Lockout keeping its state in store.
+func NewLockout(store KV, policy LockoutPolicy) *Lockout {
+	return &Lockout{store: store, policy: policy, now: time.Now}
+}
+
+// Locked returns how long key stays locked out, or 0 if it is not.
+func (l *Lockout) Locked(key string) (time.Duration, error) {
+	state, err := l.load(key)
+	if err != nil {
+		return 0, err
+	}
+	return max(state.LockedUntil.Sub(l.now()), 0), nil
+}
+
+// Fail records a failed attempt of key, and returns how long key is now locked out, or 0.
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	state, err := l.load(key)
+	if err != nil {
+		return 0, err
+	}
+
+	now := l.now()
+	state.Failures++
+	var locked time.Duration
+	if state.Failures >= l.policy.MaxFailures {
+		locked = l.lockoutAfter(state.Failures)
+		state.LockedUntil = now.Add(locked)
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	return locked, l.store.Set(lockoutKey(key), raw, locked+l.policy.MaxDuration)
+}
+
+// Succeed forgets the failures of key.
+func (l *Lockout) Succeed(key string) error {
+	return l.store.Delete(lockoutKey(key))
+}
+
+// lockoutAfter returns how long the given number of failures locks out for.
+func (l *Lockout) lockoutAfter(failures int) time.Duration {
+	d := l.policy.Duration
+	for i := l.policy.MaxFailures; i < failures && d < l.policy.MaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, l.policy.MaxDuration)
+}
+
+func (l *Lockout) load(key string) (lockoutState, error) {
+	var state lockoutState
+	raw, ok, err := l.store.Get(lockoutKey(key))
+	if err != nil || !ok {
+		return state, err
+	}
+	err = json.Unmarshal(raw, &state)
+	return state, err
+}
+
+func lockoutKey(key string) string { return "lockout:" + key }
@@ -0,0 +1,157 @@
+// Package ratelimit limits how often clients may do something, with token buckets kept in a Store,
+// and locks accounts out after repeated failed logins.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows bursts of Burst events, and refills the bucket at Burst tokens per Period.
+// The zero Limit allows everything.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Enabled reports whether l limits anything.
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// String formats l as ParseLimit reads it, such as 10/1m0s.
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// ParseLimit parses a limit written as burst/period, such as 10/1m for 10 events a minute.
+// An empty string or "off" is the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "off" {
+		return Limit{}, nil
+	}
+	burst, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected burst/period such as 10/1m", s)
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", s)
+	}
+	return Limit{Burst: n, Period: d}, nil
+}
+
+// rate is the number of tokens added per nanosecond.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / float64(l.Period)
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// RetryAfter is how long until the next token, when the request was not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// ResultFor returns the result of a take that left tokens in the bucket of limit.
+// Stores compute the tokens left, and this function the rest.
+func ResultFor(limit Limit, tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(limit.Burst) - tokens) / limit.rate())),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1 - tokens) / limit.rate()))
+	}
+	return result
+}
+
+// Store keeps token buckets by key. Take must be atomic, so that the instances of the application
+// sharing a Store share the limits.
+type Store interface {
+	// Take takes a token from the bucket of key at now, if there is one.
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Refill returns the tokens of a bucket of limit that held tokens at updated, at now.
+// A bucket seen for the first time is full.
+func Refill(limit Limit, tokens float64, updated, now time.Time) float64 {
+	if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens += float64(elapsed) * limit.rate()
+	}
+	return math.Min(tokens, float64(limit.Burst))
+}
+
+// sweepEvery is how many takes a MemoryStore serves between two sweeps of its full buckets.
+const sweepEvery = 1024
+
+// MemoryStore is a Store local to the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will be full again, after which it can be forgotten.
+	full time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = Refill(limit, b.tokens, b.updated, now)
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	result := ResultFor(limit, b.tokens, allowed)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep forgets the buckets that are full, which a new bucket would be too.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
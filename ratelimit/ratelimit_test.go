@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{Burst: 10, Period: time.Minute}, false},
+		{"off", Limit{}, false},
+		{"", Limit{}, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"10/soon", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Burst: 3, Period: 3 * time.Second}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		result, _ := s.Take("k", limit, now)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("take = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+	result, _ := s.Take("k", limit, now)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("take of an empty bucket = %+v, want denied, retry after 1s, full after 3s", result)
+	}
+	if result, _ := s.Take("other", limit, now); !result.Allowed {
+		t.Fatalf("keys share a bucket")
+	}
+
+	// A token comes back every second.
+	if result, _ := s.Take("k", limit, now.Add(time.Second)); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take after 1s = %+v, want allowed with 0 remaining", result)
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Burst: 1, Period: time.Second}
+	now := time.Now()
+	s.Take("old", limit, now)
+	for i := 1; i < sweepEvery; i++ {
+		s.Take("new", limit, now.Add(time.Minute))
+	}
+	if _, ok := s.buckets["old"]; ok {
+		t.Fatalf("full bucket was not swept")
+	}
+}
+
+// memoryKV is a KV without expiry.
+type memoryKV map[string][]byte
+
+func (m memoryKV) Get(key string) ([]byte, bool, error) {
+	value, ok := m[key]
+	return value, ok, nil
+}
+
+func (m memoryKV) Set(key string, value []byte, ttl time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryKV) Delete(keys ...string) error {
+	for _, key := range keys {
+		delete(m, key)
+	}
+	return nil
+}
+
+func TestLockoutIsProgressive(t *testing.T) {
+	l := NewLockout(memoryKV{}, LockoutPolicy{MaxFailures: 3, Duration: time.Minute, MaxDuration: 3 * time.Minute})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for _, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if locked, _ := l.Locked("alice"); locked != 0 {
+			t.Fatalf("locked for %v before the failure", locked)
+		}
+		locked, err := l.Fail("alice")
+		if err != nil || locked != want {
+			t.Fatalf("Fail = %v, %v; want locked for %v", locked, err, want)
+		}
+		if locked, _ := l.Locked("alice"); locked != want {
+			t.Fatalf("Locked = %v, want %v", locked, want)
+		}
+		now = now.Add(want)
+	}
+
+	l.Succeed("alice")
+	if locked, _ := l.Fail("alice"); locked != 0 {
+		t.Fatalf("failures were not forgotten after a success: locked for %v", locked)
+	}
+}
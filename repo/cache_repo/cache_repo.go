@@ -0,0 +1,298 @@
+package cache_repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheRepo is a read-through caching decorator around another Storer.
+// Single-entity reads (users by id or username, posts by id) are served from the cache,
+// every Update*/Delete* invalidates the affected entries, and concurrent misses for the
+// same key are collapsed into a single call to the underlying store.
+// Users are cached without their password: reads that need it, marked by repo.WithCredentials,
+// bypass the cache.
+// All other methods pass straight through to the wrapped Storer.
+type CacheRepo struct {
+	repo.Storer
+
+	cache Cache
+	ttl   time.Duration
+	group singleflight.Group
+
+	// invalidations is bumped on every invalidation. A fill that started before an
+	// invalidation is not written back, so a slow read can't resurrect stale data.
+	invalidations atomic.Uint64
+}
+
+// NewCacheRepo wraps store so that its single-entity reads are cached in cache for ttl.
+func NewCacheRepo(store repo.Storer, cache Cache, ttl time.Duration) *CacheRepo {
+	return &CacheRepo{
+		Storer: store,
+		cache:  cache,
+		ttl:    ttl,
+	}
+}
+
+func userKey(id int) string              { return fmt.Sprintf("user:%d", id) }
+func usernameKey(username string) string { return "user:username:" + username }
+func postKey(id int) string              { return fmt.Sprintf("post:%d", id) }
+
+// GetUserById returns the user from the cache, loading it from the underlying store on a miss.
+func (c *CacheRepo) GetUserById(ctx context.Context, id int) (*models.User, error) {
+	if repo.WantsCredentials(ctx) {
+		return c.Storer.GetUserById(ctx, id)
+	}
+	user := &models.User{}
+	err := c.readThrough(ctx, userKey(id), user, func(ctx context.Context) (any, error) {
+		return withoutPassword(c.Storer.GetUserById(ctx, id))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByUsername resolves the username to an id through the cache and then reads the user by id,
+// so a user is only ever cached once and renames invalidate it through its id key.
+func (c *CacheRepo) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	if repo.WantsCredentials(ctx) {
+		return c.Storer.GetUserByUsername(ctx, username)
+	}
+	if raw, ok := c.cacheGet(usernameKey(username)); ok {
+		var id int
+		if err := json.Unmarshal(raw, &id); err == nil {
+			// The mapping may be stale after a rename or delete, so only trust it if it still matches.
+			if user, err := c.GetUserById(ctx, id); err == nil && user.Username == username {
+				return user, nil
+			}
+		}
+	}
+
+	var user *models.User
+	raw, err := c.load(ctx, usernameKey(username), func(ctx context.Context) (any, error) {
+		var err error
+		user, err = withoutPassword(c.Storer.GetUserByUsername(ctx, username))
+		return user, err
+	}, func(raw []byte) {
+		c.cacheSetRaw(userKey(user.Id), raw)
+		c.cacheSet(usernameKey(username), user.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{}
+	if err := json.Unmarshal(raw, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// withoutPassword clears the password of a user read from the underlying store, so it is never cached.
+func withoutPassword(user *models.User, err error) (*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// UpdateUserById updates the user and drops it from the cache.
+func (c *CacheRepo) UpdateUserById(ctx context.Context, id, version int, updateReq *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+	user, err := c.Storer.UpdateUserById(ctx, id, version, updateReq)
+	c.invalidate(userKey(id))
+	return user, err
+}
+
+// DeleteUserById deletes the user and drops it, along with the posts removed by the cascade, from the cache.
+func (c *CacheRepo) DeleteUserById(ctx context.Context, id, version int) error {
+	keys := []string{userKey(id)}
+	if posts, err := c.Storer.GetAllPostsByAuthor(ctx, id); err == nil {
+		for _, post := range posts {
+			keys = append(keys, postKey(post.Id))
+		}
+	}
+
+	err := c.Storer.DeleteUserById(ctx, id, version)
+	c.invalidate(keys...)
+	return err
+}
+
+// GetPostById returns the post from the cache, loading it from the underlying store on a miss.
+func (c *CacheRepo) GetPostById(ctx context.Context, id int) (*models.Post, error) {
+	post := &models.Post{}
+	err := c.readThrough(ctx, postKey(id), post, func(ctx context.Context) (any, error) {
+		return c.Storer.GetPostById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// UpdatePostById updates the post and drops it from the cache.
+func (c *CacheRepo) UpdatePostById(ctx context.Context, id, version int, postReq *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+	post, err := c.Storer.UpdatePostById(ctx, id, version, postReq)
+	c.invalidate(postKey(id))
+	return post, err
+}
+
+// DeletePostById deletes the post and drops it from the cache.
+func (c *CacheRepo) DeletePostById(ctx context.Context, id, authorId, version int) error {
+	err := c.Storer.DeletePostById(ctx, id, authorId, version)
+	c.invalidate(postKey(id))
+	return err
+}
+
+// InTx runs fn in a transaction of the underlying store. Within it reads bypass the cache, which
+// must not see uncommitted rows, and the entries the writes make stale are dropped once it ends.
+func (c *CacheRepo) InTx(ctx context.Context, fn func(tx repo.Storer) error) error {
+	tx := &txStore{}
+	err := c.Storer.InTx(ctx, func(inner repo.Storer) error {
+		tx.Storer = inner
+		return fn(tx)
+	})
+	if len(tx.keys) > 0 {
+		c.invalidate(tx.keys...)
+	}
+	return err
+}
+
+// txStore is the Storer handed out by CacheRepo.InTx. It records the cache keys of what it writes.
+type txStore struct {
+	repo.Storer
+	keys []string
+}
+
+func (t *txStore) UpdateUserById(ctx context.Context, id, version int, updateReq *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+	t.keys = append(t.keys, userKey(id))
+	return t.Storer.UpdateUserById(ctx, id, version, updateReq)
+}
+
+func (t *txStore) DeleteUserById(ctx context.Context, id, version int) error {
+	t.keys = append(t.keys, userKey(id))
+	if posts, err := t.Storer.GetAllPostsByAuthor(ctx, id); err == nil {
+		for _, post := range posts {
+			t.keys = append(t.keys, postKey(post.Id))
+		}
+	}
+	return t.Storer.DeleteUserById(ctx, id, version)
+}
+
+func (t *txStore) UpdatePostById(ctx context.Context, id, version int, postReq *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+	t.keys = append(t.keys, postKey(id))
+	return t.Storer.UpdatePostById(ctx, id, version, postReq)
+}
+
+func (t *txStore) DeletePostById(ctx context.Context, id, authorId, version int) error {
+	t.keys = append(t.keys, postKey(id))
+	return t.Storer.DeletePostById(ctx, id, authorId, version)
+}
+
+// InTx runs fn in the same transaction.
+func (t *txStore) InTx(ctx context.Context, fn func(tx repo.Storer) error) error {
+	return t.Storer.InTx(ctx, func(repo.Storer) error { return fn(t) })
+}
+
+// readThrough decodes the cached value for key into dst, or calls load on a miss and caches its result.
+// Values travel as JSON even for the in-process cache, so every caller gets its own copy
+// and handlers are free to mutate what they receive (e.g. clearing passwords).
+func (c *CacheRepo) readThrough(ctx context.Context, key string, dst any, load func(context.Context) (any, error)) error {
+	if raw, ok := c.cacheGet(key); ok {
+		if err := json.Unmarshal(raw, dst); err == nil {
+			return nil
+		}
+	}
+
+	raw, err := c.load(ctx, key, load, func(raw []byte) {
+		c.cacheSetRaw(key, raw)
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, dst)
+}
+
+// load calls fn at most once at a time per flightKey and returns its result as JSON.
+// fill is called with that JSON to populate the cache, unless an invalidation happened
+// while fn was running; in that case the (possibly stale) result is returned but not cached.
+func (c *CacheRepo) load(ctx context.Context, flightKey string, fn func(context.Context) (any, error), fill func(raw []byte)) ([]byte, error) {
+	// A request that already wrote must read its own writes, which a shared flight started
+	// by another request (possibly served by a lagging replica) can't guarantee.
+	if repo.HasWritten(ctx) {
+		value, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(value)
+	}
+
+	raw, err, _ := c.group.Do(flightKey, func() (any, error) {
+		generation := c.invalidations.Load()
+
+		// The result is shared with every caller waiting on this flight,
+		// so one caller going away must not fail the others.
+		value, err := fn(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.invalidations.Load() == generation {
+			fill(raw)
+		}
+		return raw, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return raw.([]byte), nil
+}
+
+// cacheGet treats cache failures as misses so an unavailable cache only costs performance.
+func (c *CacheRepo) cacheGet(key string) ([]byte, bool) {
+	raw, ok, err := c.cache.Get(key)
+	if err != nil {
+		slog.Warn("cache get failed", "key", key, "err", err.Error())
+		return nil, false
+	}
+	return raw, ok
+}
+
+func (c *CacheRepo) cacheSet(key string, value any) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	c.cacheSetRaw(key, raw)
+}
+
+func (c *CacheRepo) cacheSetRaw(key string, raw []byte) {
+	if err := c.cache.Set(key, raw, c.ttl); err != nil {
+		slog.Warn("cache set failed", "key", key, "err", err.Error())
+	}
+}
+
+func (c *CacheRepo) invalidate(keys ...string) {
+	c.invalidations.Add(1)
+	for _, key := range keys {
+		c.group.Forget(key)
+	}
+	if err := c.cache.Delete(keys...); err != nil {
+		slog.Warn("cache invalidation failed", "keys", keys, "err", err.Error())
+	}
+}
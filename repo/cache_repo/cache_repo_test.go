@@ -0,0 +1,409 @@
+package cache_repo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/ratelimit"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
+	"github.com/assaidy/goblog/repo/storertest"
+)
+
+func newSqliteStore(t *testing.T) repo.Storer {
+	t.Helper()
+	s, err := sqlite_repo.NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	t.Cleanup(func() { s.DB.Close() })
+
+	if err := sqlite_repo.Migrate(s.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return s
+}
+
+func TestStorerConformanceMemory(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) repo.Storer {
+		return NewCacheRepo(newSqliteStore(t), NewMemoryCache(100), time.Minute)
+	})
+}
+
+func TestStorerConformanceRedis(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) repo.Storer {
+		return NewCacheRepo(newSqliteStore(t), newTestRedisCache(t), time.Minute)
+	})
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	c.Get("a") // a is now more recently used than b
+	c.Set("c", []byte("3"), time.Minute)
+
+	if _, ok, _ := c.Get("b"); ok {
+		t.Fatalf("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(key); !ok {
+			t.Fatalf("entry %q was evicted", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d; want 2", c.Len())
+	}
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	now := time.Now()
+	c := NewMemoryCache(10)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", []byte("1"), time.Second)
+	if _, ok, _ := c.Get("a"); !ok {
+		t.Fatalf("fresh entry missing")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok, _ := c.Get("a"); ok {
+		t.Fatalf("expired entry returned")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expired entry was not dropped")
+	}
+}
+
+func TestExpiringCacheNeverEvicts(t *testing.T) {
+	now := time.Now()
+	c := NewExpiringCache()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 1000; i++ {
+		c.Set(strconv.Itoa(i), []byte("1"), time.Second)
+	}
+	c.Set("long", []byte("1"), time.Hour)
+	for _, key := range []string{"0", "999", "long"} {
+		if _, ok, _ := c.Get(key); !ok {
+			t.Fatalf("live entry %q was dropped", key)
+		}
+	}
+
+	// The next write after the sweep interval drops the expired entries.
+	now = now.Add(expiringSweepInterval)
+	c.Set("new", []byte("1"), time.Second)
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d after the sweep; want 2", c.Len())
+	}
+	if _, ok, _ := c.Get("long"); !ok {
+		t.Fatalf("live entry dropped by the sweep")
+	}
+}
+
+func TestAddOnlySetsMissingKeys(t *testing.T) {
+	caches := map[string]interface {
+		Cache
+		Add(key string, value []byte, ttl time.Duration) (bool, error)
+	}{
+		"memory":   NewMemoryCache(10),
+		"expiring": NewExpiringCache(),
+		"redis":    newTestRedisCache(t),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			if added, err := c.Add("k", []byte("1"), time.Minute); err != nil || !added {
+				t.Fatalf("first Add = %v, %v; want true, nil", added, err)
+			}
+			if added, err := c.Add("k", []byte("2"), time.Minute); err != nil || added {
+				t.Fatalf("second Add = %v, %v; want false, nil", added, err)
+			}
+			if value, _, _ := c.Get("k"); string(value) != "1" {
+				t.Fatalf("Add overwrote the value: %q", value)
+			}
+		})
+	}
+
+	expiring := NewMemoryCache(10)
+	now := time.Now()
+	expiring.now = func() time.Time { return now }
+	expiring.Add("k", []byte("1"), time.Second)
+	now = now.Add(time.Second)
+	if added, _ := expiring.Add("k", []byte("2"), time.Second); !added {
+		t.Fatalf("Add did not replace an expired entry")
+	}
+}
+
+// TestRedisTake checks the rate limit buckets kept in Redis. With the fake server, which emulates
+// the script, it only checks how RedisCache calls it.
+func TestRedisTake(t *testing.T) {
+	c := newTestRedisCache(t)
+	limit := ratelimit.Limit{Burst: 2, Period: time.Minute}
+	now := time.Now()
+
+	for i, want := range []struct {
+		allowed   bool
+		remaining int
+	}{{true, 1}, {true, 0}, {false, 0}} {
+		result, err := c.Take("ip:192.0.2.1", limit, now)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		if result.Allowed != want.allowed || result.Remaining != want.remaining {
+			t.Fatalf("take %d = %+v, want allowed %v with %d remaining", i, result, want.allowed, want.remaining)
+		}
+		if !want.allowed && result.RetryAfter <= 0 {
+			t.Fatalf("denied take has no RetryAfter: %+v", result)
+		}
+	}
+
+	// The bucket refills over time.
+	if result, _ := c.Take("ip:192.0.2.1", limit, now.Add(30*time.Second)); !result.Allowed {
+		t.Fatalf("take after a refill = %+v, want allowed", result)
+	}
+}
+
+// countingStore counts GetPostById calls and blocks them until release is closed.
+type countingStore struct {
+	repo.Storer
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStore) GetPostById(ctx context.Context, id int) (*models.Post, error) {
+	s.calls.Add(1)
+	<-s.release
+	return s.Storer.GetPostById(ctx, id)
+}
+
+func TestConcurrentMissesAreCollapsed(t *testing.T) {
+	ctx := context.Background()
+	store := newSqliteStore(t)
+	author, err := store.CreateUser(ctx, &models.User{FullName: "A", Username: "alice", Email: "alice@example.com", Password: "pw"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	post, err := store.CreatePost(ctx, &models.Post{Title: "t", Content: "c", AuthorId: author.Id})
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+
+	counting := &countingStore{Storer: store, release: make(chan struct{})}
+	c := NewCacheRepo(counting, NewMemoryCache(10), time.Minute)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetPostById(ctx, post.Id); err != nil {
+				t.Errorf("GetPostById: %v", err)
+			}
+		}()
+	}
+
+	// Give every goroutine a chance to join the in-flight load before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+
+	if _, err := c.GetPostById(ctx, post.Id); err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	if calls := counting.calls.Load(); calls != 1 {
+		t.Fatalf("underlying GetPostById called %d times; want 1", calls)
+	}
+}
+
+func TestReturnedValuesAreCopies(t *testing.T) {
+	ctx := context.Background()
+	store := newSqliteStore(t)
+	c := NewCacheRepo(store, NewMemoryCache(10), time.Minute)
+	created, err := store.CreateUser(ctx, &models.User{FullName: "A", Username: "alice", Email: "alice@example.com", Password: "pw"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	first, err := c.GetUserById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetUserById: %v", err)
+	}
+	first.FullName = "changed"
+
+	second, err := c.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if second.FullName != "A" {
+		t.Fatalf("mutating a returned user changed the cached copy")
+	}
+}
+
+func TestPasswordsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+	store := newSqliteStore(t)
+	cache := NewMemoryCache(10)
+	c := NewCacheRepo(store, cache, time.Minute)
+	created, err := store.CreateUser(ctx, &models.User{FullName: "A", Username: "alice", Email: "alice@example.com", Password: "s3cr3t-pw"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if _, err := c.GetUserByUsername(ctx, "alice"); err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	raw, ok, err := cache.Get(userKey(created.Id))
+	if err != nil || !ok {
+		t.Fatalf("user not cached: %v", err)
+	}
+	if strings.Contains(string(raw), "s3cr3t-pw") {
+		t.Fatalf("cached user has its password: %s", raw)
+	}
+
+	user, err := c.GetUserByUsername(repo.WithCredentials(ctx), "alice")
+	if err != nil || user.Password != "s3cr3t-pw" {
+		t.Fatalf("GetUserByUsername with credentials = %+v, %v; want the password", user, err)
+	}
+}
+
+// newTestRedisCache connects to GOBLOG_TEST_REDIS_ADDR when it is set,
+// otherwise to a minimal in-process server that speaks just enough RESP for RedisCache.
+func newTestRedisCache(t *testing.T) *RedisCache {
+	t.Helper()
+
+	addr := os.Getenv("GOBLOG_TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = startFakeRedis(t)
+	}
+
+	c, err := NewRedisCache(RedisOptions{
+		Addr:   addr,
+		Prefix: fmt.Sprintf("goblog-test:%s:%d:", t.Name(), time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	mem := NewMemoryCache(1000)
+	buckets := ratelimit.NewMemoryStore()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, mem, buckets)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// serveFakeRedis answers the commands RedisCache sends. EVAL of the take script is emulated with
+// buckets, which only reports whole tokens.
+func serveFakeRedis(conn net.Conn, mem *MemoryCache, buckets *ratelimit.MemoryStore) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case "GET":
+			if value, ok, _ := mem.Get(args[1]); ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				io.WriteString(conn, "$-1\r\n")
+			}
+		case "SET":
+			ms, _ := strconv.Atoi(args[4])
+			ttl := time.Duration(ms) * time.Millisecond
+			if len(args) > 5 && strings.ToUpper(args[5]) == "NX" {
+				if added, _ := mem.Add(args[1], []byte(args[2]), ttl); !added {
+					io.WriteString(conn, "$-1\r\n")
+					continue
+				}
+			} else {
+				mem.Set(args[1], []byte(args[2]), ttl)
+			}
+			io.WriteString(conn, "+OK\r\n")
+		case "DEL":
+			mem.Delete(args[1:]...)
+			fmt.Fprintf(conn, ":%d\r\n", len(args)-1)
+		case "EVAL":
+			burst, _ := strconv.Atoi(args[4])
+			period, _ := strconv.ParseInt(args[5], 10, 64)
+			now, _ := strconv.ParseInt(args[6], 10, 64)
+			limit := ratelimit.Limit{Burst: burst, Period: time.Duration(period) * time.Millisecond}
+			result, _ := buckets.Take(args[3], limit, time.UnixMilli(now))
+			allowed := 0
+			if result.Allowed {
+				allowed = 1
+			}
+			reply := fmt.Sprintf("%d %d", allowed, result.Remaining)
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(reply), reply)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,100 @@
+package cache_repo
+
+import (
+	"sync"
+	"time"
+)
+
+// expiringSweepInterval is how often writes to an ExpiringCache drop its expired entries.
+const expiringSweepInterval = time.Minute
+
+// ExpiringCache is an in-process Cache whose entries only go away when they expire or are deleted.
+// Unlike MemoryCache it never evicts a live entry to make room, so it suits state that must not be
+// forgotten early, such as idempotency records or login lockouts; its size is bounded by the rate
+// of writes times their TTL instead. Expired entries are dropped when they are read, and by a sweep
+// of the whole cache at most once every expiringSweepInterval, on writes.
+type ExpiringCache struct {
+	mu        sync.Mutex
+	items     map[string]expiringEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type expiringEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewExpiringCache creates an empty ExpiringCache.
+func NewExpiringCache() *ExpiringCache {
+	return &ExpiringCache{items: make(map[string]expiringEntry), now: time.Now}
+}
+
+// Get returns the value stored under key if it exists and has not expired.
+func (c *ExpiringCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Set stores value under key for ttl.
+func (c *ExpiringCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl)
+	return nil
+}
+
+// set is Set for callers holding c.mu.
+func (c *ExpiringCache) set(key string, value []byte, ttl time.Duration) {
+	now := c.now()
+	if now.Sub(c.lastSweep) >= expiringSweepInterval {
+		for k, entry := range c.items {
+			if !now.Before(entry.expiresAt) {
+				delete(c.items, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.items[key] = expiringEntry{value: value, expiresAt: now.Add(ttl)}
+}
+
+// Add stores value under key for ttl only if key holds no live entry, and reports whether it did.
+func (c *ExpiringCache) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.items[key]; ok && c.now().Before(entry.expiresAt) {
+		return false, nil
+	}
+	c.set(key, value, ttl)
+	return true, nil
+}
+
+// Delete removes the given keys; missing keys are ignored.
+func (c *ExpiringCache) Delete(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.items, key)
+	}
+	return nil
+}
+
+// Len returns the number of entries currently held, including expired ones not yet dropped.
+func (c *ExpiringCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
@@ -0,0 +1,246 @@
+package cache_repo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisCache is a Cache backed by any server speaking the Redis protocol (RESP2),
+// such as Redis, Valkey or KeyDB. It only needs GET, SET PX and DEL.
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+// RedisOptions configures a RedisCache.
+type RedisOptions struct {
+	Addr     string        // host:port of the server
+	Password string        // optional, sent with AUTH
+	DB       int           // database index selected with SELECT
+	Prefix   string        // prepended to every key
+	PoolSize int           // maximum number of idle connections kept around
+	Timeout  time.Duration // dial and per-command timeout
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// errRedisNil is returned by a command whose reply is the RESP null bulk string.
+var errRedisNil = errors.New("redis: nil")
+
+// NewRedisCache creates a RedisCache and checks that the server is reachable.
+func NewRedisCache(opts RedisOptions) (*RedisCache, error) {
+	if opts.PoolSize < 1 {
+		opts.PoolSize = 10
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	c := &RedisCache{
+		addr:     opts.Addr,
+		password: opts.Password,
+		db:       opts.DB,
+		prefix:   opts.Prefix,
+		timeout:  opts.Timeout,
+		pool:     make(chan *redisConn, opts.PoolSize),
+	}
+
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("failed to reach redis at %s: %w", opts.Addr, err)
+	}
+
+	return c, nil
+}
+
+// Get returns the value stored under key.
+func (c *RedisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", c.prefix+key)
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key with a millisecond-precision expiry.
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := c.do("SET", c.prefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Add stores value under key only if it does not exist yet (SET NX), and reports whether it did.
+func (c *RedisCache) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := c.do("SET", c.prefix+key, string(value), "PX", strconv.FormatInt(ms, 10), "NX")
+	if errors.Is(err, errRedisNil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the given keys.
+func (c *RedisCache) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]string, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, key := range keys {
+		args = append(args, c.prefix+key)
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+// Close closes all idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case rc := <-c.pool:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a single command and reads its reply, reusing a pooled connection when possible.
+// Connections that hit an I/O or protocol error are discarded instead of being returned to the pool.
+func (c *RedisCache) do(args ...string) (any, error) {
+	rc, err := c.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.roundTrip(c.timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &replyErr) {
+		rc.conn.Close()
+		return nil, err
+	}
+
+	c.putConn(rc)
+	return reply, err
+}
+
+func (c *RedisCache) getConn() (*redisConn, error) {
+	select {
+	case rc := <-c.pool:
+		return rc, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	if c.password != "" {
+		if _, err := rc.roundTrip(c.timeout, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.roundTrip(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+func (c *RedisCache) putConn(rc *redisConn) {
+	select {
+	case c.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// redisError is an error reply ("-ERR ...") sent by the server. The connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (rc *redisConn) roundTrip(timeout time.Duration, args ...string) (any, error) {
+	if err := rc.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rc.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rc.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := rc.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return rc.readReply()
+}
+
+// readReply parses one RESP2 reply. Arrays are not needed by the commands we send.
+func (rc *redisConn) readReply() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	payload := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply type %q", line[0])
+	}
+}
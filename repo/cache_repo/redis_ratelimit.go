@@ -0,0 +1,55 @@
+package cache_repo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assaidy/goblog/ratelimit"
+)
+
+// takeScript takes a token from the bucket stored in the hash KEYS[1], as ratelimit.MemoryStore
+// does, so instances sharing the server share the bucket. ARGV holds the burst, the period and
+// the current time, in milliseconds. It replies "allowed tokens", e.g. "1 4.5": a bulk string,
+// as Lua numbers are truncated to integers in replies.
+const takeScript = `
+local burst = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local rate = burst / period
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil((burst - tokens) / rate)))
+return allowed .. ' ' .. tostring(tokens)
+`
+
+// Take implements ratelimit.Store with a Lua script, which the server runs atomically.
+func (c *RedisCache) Take(key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	reply, err := c.do("EVAL", takeScript, "1", c.prefix+key,
+		strconv.Itoa(limit.Burst),
+		strconv.FormatInt(limit.Period.Milliseconds(), 10),
+		strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	raw, ok := reply.([]byte)
+	if !ok {
+		return ratelimit.Result{}, fmt.Errorf("redis: unexpected EVAL reply %T", reply)
+	}
+	allowed, tokensStr, _ := strings.Cut(string(raw), " ")
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("redis: malformed EVAL reply %q", raw)
+	}
+	return ratelimit.ResultFor(limit, tokens, allowed == "1"), nil
+}
@@ -0,0 +1,18 @@
+package repo
+
+import "context"
+
+// credentialsKey is the context key marking reads that need the credentials of users.
+type credentialsKey struct{}
+
+// WithCredentials returns a context for reads of users that need their password, like logins.
+// Caching implementations, which never keep passwords, serve such reads from the store they wrap.
+func WithCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, true)
+}
+
+// WantsCredentials reports whether ctx comes from WithCredentials.
+func WantsCredentials(ctx context.Context) bool {
+	wants, _ := ctx.Value(credentialsKey{}).(bool)
+	return wants
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel error kinds returned by Storer implementations. Callers match them with errors.Is;
+// the HTTP layer maps each kind to a status code, so storage code never deals with HTTP.
+var (
+	// ErrNotFound means the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a uniqueness constraint was violated, e.g. a taken username.
+	ErrConflict = errors.New("conflict")
+	// ErrForeignKey means a referenced row does not exist, or a row is still referenced.
+	ErrForeignKey = errors.New("foreign key violation")
+	// ErrInvalid means the data was rejected by a NOT NULL or CHECK constraint.
+	ErrInvalid = errors.New("invalid data")
+	// ErrVersionMismatch means a conditional write found the row at another version than expected.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// AnyVersion makes a write unconditional when passed as the expected version.
+const AnyVersion = 0
+
+// Error is a storage error of one of the kinds above, carrying a message fit for API clients
+// and, optionally, the driver error it was translated from.
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+// Error returns the client-facing message.
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Is makes errors.Is(err, ErrNotFound) and friends match on the error kind.
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap exposes the underlying driver error, if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFoundf returns an ErrNotFound error with a formatted message.
+func NotFoundf(format string, args ...any) error {
+	return &Error{Kind: ErrNotFound, Msg: fmt.Sprintf(format, args...)}
+}
+
+// VersionMismatchf returns an ErrVersionMismatch error with a formatted message.
+func VersionMismatchf(format string, args ...any) error {
+	return &Error{Kind: ErrVersionMismatch, Msg: fmt.Sprintf(format, args...)}
+}
+
+// NewError wraps a driver error cause as a storage error of the given kind.
+func NewError(kind error, msg string, cause error) error {
+	return &Error{Kind: kind, Msg: msg, Err: cause}
+}
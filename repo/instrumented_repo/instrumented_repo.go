@@ -0,0 +1,236 @@
+// Package instrumented_repo instruments the calls to a Storer: it measures them into Prometheus metrics,
+// traces them with OpenTelemetry, and counts the business events they record, such as registrations
+// and posts created.
+package instrumented_repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// InstrumentedRepo is a decorator around another Storer that times every call into metrics.StoreDuration,
+// runs it in a span whose children are the spans of its SQL statements, and counts the users and
+// posts created. Within InTx, creations are only counted once the transaction commits.
+type InstrumentedRepo struct {
+	store repo.Storer
+	// pending collects the counts of a transaction; it is nil outside of one.
+	pending *[]event
+}
+
+// event is a count to add to a counter.
+type event struct {
+	counter prometheus.Counter
+	n       int
+}
+
+// NewInstrumentedRepo wraps store so that its calls are measured and traced.
+func NewInstrumentedRepo(store repo.Storer) *InstrumentedRepo {
+	return &InstrumentedRepo{store: store}
+}
+
+var tracer = otel.Tracer("github.com/assaidy/goblog/repo/instrumented_repo")
+
+// measure times a call to the method of the underlying store, and runs it in a span named after the method.
+func measure[T any](ctx context.Context, method string, call func(context.Context) (T, error)) (T, error) {
+	ctx, span := tracer.Start(ctx, "Storer."+method)
+	defer span.End()
+
+	start := time.Now()
+	value, err := call(ctx)
+	result := "ok"
+	if err != nil {
+		result = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	metrics.StoreDuration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+	return value, err
+}
+
+// measureErr measures a call to a method returning only an error.
+func measureErr(ctx context.Context, method string, call func(context.Context) error) error {
+	_, err := measure(ctx, method, func(ctx context.Context) (struct{}, error) { return struct{}{}, call(ctx) })
+	return err
+}
+
+// count adds n to counter, or to the counts of the transaction until it commits.
+func (m *InstrumentedRepo) count(counter prometheus.Counter, n int) {
+	if m.pending != nil {
+		*m.pending = append(*m.pending, event{counter, n})
+		return
+	}
+	counter.Add(float64(n))
+}
+
+func (m *InstrumentedRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	user, err := measure(ctx, "CreateUser", func(ctx context.Context) (*models.User, error) {
+		return m.store.CreateUser(ctx, user)
+	})
+	if err == nil {
+		m.count(metrics.Registrations, 1)
+	}
+	return user, err
+}
+
+func (m *InstrumentedRepo) GetUserById(ctx context.Context, id int) (*models.User, error) {
+	return measure(ctx, "GetUserById", func(ctx context.Context) (*models.User, error) {
+		return m.store.GetUserById(ctx, id)
+	})
+}
+
+func (m *InstrumentedRepo) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return measure(ctx, "GetUserByUsername", func(ctx context.Context) (*models.User, error) {
+		return m.store.GetUserByUsername(ctx, username)
+	})
+}
+
+func (m *InstrumentedRepo) UpdateUserById(ctx context.Context, id, version int, req *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+	return measure(ctx, "UpdateUserById", func(ctx context.Context) (*models.User, error) {
+		return m.store.UpdateUserById(ctx, id, version, req)
+	})
+}
+
+func (m *InstrumentedRepo) DeleteUserById(ctx context.Context, id, version int) error {
+	return measureErr(ctx, "DeleteUserById", func(ctx context.Context) error {
+		return m.store.DeleteUserById(ctx, id, version)
+	})
+}
+
+func (m *InstrumentedRepo) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	return measure(ctx, "GetAllUsers", func(ctx context.Context) ([]*models.User, error) {
+		return m.store.GetAllUsers(ctx)
+	})
+}
+
+func (m *InstrumentedRepo) GetUsersByIds(ctx context.Context, ids []int) ([]*models.User, error) {
+	return measure(ctx, "GetUsersByIds", func(ctx context.Context) ([]*models.User, error) {
+		return m.store.GetUsersByIds(ctx, ids)
+	})
+}
+
+func (m *InstrumentedRepo) IsUsernameUsed(ctx context.Context, username string) (bool, error) {
+	return measure(ctx, "IsUsernameUsed", func(ctx context.Context) (bool, error) {
+		return m.store.IsUsernameUsed(ctx, username)
+	})
+}
+
+func (m *InstrumentedRepo) IsEmailUsed(ctx context.Context, email string) (bool, error) {
+	return measure(ctx, "IsEmailUsed", func(ctx context.Context) (bool, error) {
+		return m.store.IsEmailUsed(ctx, email)
+	})
+}
+
+func (m *InstrumentedRepo) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	post, err := measure(ctx, "CreatePost", func(ctx context.Context) (*models.Post, error) {
+		return m.store.CreatePost(ctx, post)
+	})
+	if err == nil {
+		m.count(metrics.PostsCreated, 1)
+	}
+	return post, err
+}
+
+func (m *InstrumentedRepo) CreatePosts(ctx context.Context, posts []*models.Post) ([]*models.Post, error) {
+	posts, err := measure(ctx, "CreatePosts", func(ctx context.Context) ([]*models.Post, error) {
+		return m.store.CreatePosts(ctx, posts)
+	})
+	if err == nil {
+		m.count(metrics.PostsCreated, len(posts))
+	}
+	return posts, err
+}
+
+func (m *InstrumentedRepo) GetPostById(ctx context.Context, id int) (*models.Post, error) {
+	return measure(ctx, "GetPostById", func(ctx context.Context) (*models.Post, error) {
+		return m.store.GetPostById(ctx, id)
+	})
+}
+
+func (m *InstrumentedRepo) GetPostsByIds(ctx context.Context, ids []int) ([]*models.Post, error) {
+	return measure(ctx, "GetPostsByIds", func(ctx context.Context) ([]*models.Post, error) {
+		return m.store.GetPostsByIds(ctx, ids)
+	})
+}
+
+func (m *InstrumentedRepo) UpdatePostById(ctx context.Context, id, version int, req *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+	return measure(ctx, "UpdatePostById", func(ctx context.Context) (*models.Post, error) {
+		return m.store.UpdatePostById(ctx, id, version, req)
+	})
+}
+
+func (m *InstrumentedRepo) DeletePostById(ctx context.Context, id, authorId, version int) error {
+	return measureErr(ctx, "DeletePostById", func(ctx context.Context) error {
+		return m.store.DeletePostById(ctx, id, authorId, version)
+	})
+}
+
+func (m *InstrumentedRepo) GetAllPosts(ctx context.Context) ([]*models.Post, error) {
+	return measure(ctx, "GetAllPosts", func(ctx context.Context) ([]*models.Post, error) {
+		return m.store.GetAllPosts(ctx)
+	})
+}
+
+func (m *InstrumentedRepo) GetAllPostsByAuthor(ctx context.Context, authorId int) ([]*models.Post, error) {
+	return measure(ctx, "GetAllPostsByAuthor", func(ctx context.Context) ([]*models.Post, error) {
+		return m.store.GetAllPostsByAuthor(ctx, authorId)
+	})
+}
+
+func (m *InstrumentedRepo) GetPostsByAuthorIds(ctx context.Context, authorIds []int) ([]*models.Post, error) {
+	return measure(ctx, "GetPostsByAuthorIds", func(ctx context.Context) ([]*models.Post, error) {
+		return m.store.GetPostsByAuthorIds(ctx, authorIds)
+	})
+}
+
+func (m *InstrumentedRepo) CreateComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	return measure(ctx, "CreateComment", func(ctx context.Context) (*models.Comment, error) {
+		return m.store.CreateComment(ctx, comment)
+	})
+}
+
+func (m *InstrumentedRepo) GetCommentsByPostIds(ctx context.Context, postIds []int) ([]*models.Comment, error) {
+	return measure(ctx, "GetCommentsByPostIds", func(ctx context.Context) ([]*models.Comment, error) {
+		return m.store.GetCommentsByPostIds(ctx, postIds)
+	})
+}
+
+func (m *InstrumentedRepo) TagPost(ctx context.Context, postId int, names []string) error {
+	return measureErr(ctx, "TagPost", func(ctx context.Context) error {
+		return m.store.TagPost(ctx, postId, names)
+	})
+}
+
+func (m *InstrumentedRepo) GetTagsByPostIds(ctx context.Context, postIds []int) (map[int][]*models.Tag, error) {
+	return measure(ctx, "GetTagsByPostIds", func(ctx context.Context) (map[int][]*models.Tag, error) {
+		return m.store.GetTagsByPostIds(ctx, postIds)
+	})
+}
+
+// InTx runs fn in a transaction of the underlying store, measured as a whole, and counts what it
+// created once it commits. A nested InTx joins the transaction and its counts.
+func (m *InstrumentedRepo) InTx(ctx context.Context, fn func(tx repo.Storer) error) error {
+	if m.pending != nil {
+		return m.store.InTx(ctx, func(repo.Storer) error { return fn(m) })
+	}
+
+	var pending []event
+	err := measureErr(ctx, "InTx", func(ctx context.Context) error {
+		return m.store.InTx(ctx, func(inner repo.Storer) error {
+			pending = pending[:0]
+			return fn(&InstrumentedRepo{store: inner, pending: &pending})
+		})
+	})
+	if err == nil {
+		for _, e := range pending {
+			e.counter.Add(float64(e.n))
+		}
+	}
+	return err
+}
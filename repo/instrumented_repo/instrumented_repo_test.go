@@ -0,0 +1,108 @@
+package instrumented_repo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
+	"github.com/assaidy/goblog/repo/storertest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func newSqliteStore(t *testing.T) repo.Storer {
+	t.Helper()
+	s, err := sqlite_repo.NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	t.Cleanup(func() { s.DB.Close() })
+
+	if err := sqlite_repo.Migrate(s.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return s
+}
+
+func TestStorerConformance(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) repo.Storer {
+		return NewInstrumentedRepo(newSqliteStore(t))
+	})
+}
+
+func TestCountsCommittedCreations(t *testing.T) {
+	ctx := context.Background()
+	store := NewInstrumentedRepo(newSqliteStore(t))
+	registrations := testutil.ToFloat64(metrics.Registrations)
+	postsCreated := testutil.ToFloat64(metrics.PostsCreated)
+
+	user, err := store.CreateUser(ctx, &models.User{FullName: "n", Username: "u", Email: "u@example.com", Password: "p"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	store.CreatePost(ctx, &models.Post{AuthorId: user.Id, Title: "t", Content: "c"})
+
+	// The posts of a rolled back transaction are not counted, those of a committed one are.
+	rollback := errors.New("rollback")
+	store.InTx(ctx, func(tx repo.Storer) error {
+		tx.CreatePost(ctx, &models.Post{AuthorId: user.Id, Title: "t", Content: "c"})
+		return rollback
+	})
+	err = store.InTx(ctx, func(tx repo.Storer) error {
+		_, err := tx.CreatePosts(ctx, []*models.Post{
+			{AuthorId: user.Id, Title: "t", Content: "c"},
+			{AuthorId: user.Id, Title: "t", Content: "c"},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.Registrations) - registrations; got != 1 {
+		t.Errorf("registrations counted = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.PostsCreated) - postsCreated; got != 3 {
+		t.Errorf("posts created counted = %v, want 3", got)
+	}
+	if n := testutil.CollectAndCount(metrics.StoreDuration, "goblog_store_call_duration_seconds"); n == 0 {
+		t.Errorf("store calls were not measured")
+	}
+}
+
+func TestTracesCallsAndStatements(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	store := NewInstrumentedRepo(newSqliteStore(t))
+
+	if _, err := store.GetPostById(context.Background(), 1); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("GetPostById = %v, want ErrNotFound", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want the call and its statement", len(spans))
+	}
+	statement, call := spans[0], spans[1]
+	if call.Name() != "Storer.GetPostById" || statement.Name() != "SELECT" {
+		t.Fatalf("spans = %q, %q", call.Name(), statement.Name())
+	}
+	if statement.Parent().SpanID() != call.SpanContext().SpanID() {
+		t.Errorf("the statement is not a child of the call")
+	}
+	attrs := map[string]any{}
+	for _, kv := range statement.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attrs[string(semconv.DBSystemKey)] != "sqlite" || attrs[string(semconv.DBQueryTextKey)] == nil {
+		t.Errorf("statement attributes = %v, want the database system and the query", attrs)
+	}
+}
@@ -0,0 +1,51 @@
+package postgres_repo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/assaidy/goblog/repo"
+	"github.com/lib/pq"
+)
+
+// PostgreSQL error codes of integrity constraint violations (class 23).
+const (
+	codeNotNullViolation    = "23502"
+	codeForeignKeyViolation = "23503"
+	codeUniqueViolation     = "23505"
+	codeCheckViolation      = "23514"
+)
+
+// keyDetailPattern extracts the column list from details like "Key (username)=(alice) already exists.".
+var keyDetailPattern = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// translateError maps constraint violations reported by lib/pq to repo error kinds.
+// Any other error is returned unchanged.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case codeUniqueViolation:
+		return repo.NewError(repo.ErrConflict, fmt.Sprintf("%s already exists", keyColumns(pqErr)), err)
+	case codeForeignKeyViolation:
+		return repo.NewError(repo.ErrForeignKey, fmt.Sprintf("%s does not reference an existing row", keyColumns(pqErr)), err)
+	case codeNotNullViolation:
+		return repo.NewError(repo.ErrInvalid, fmt.Sprintf("%s is required", pqErr.Column), err)
+	case codeCheckViolation:
+		return repo.NewError(repo.ErrInvalid, fmt.Sprintf("check %s failed", pqErr.Constraint), err)
+	default:
+		return err
+	}
+}
+
+// keyColumns names the columns involved in a key violation, falling back to the constraint name.
+func keyColumns(pqErr *pq.Error) string {
+	if m := keyDetailPattern.FindStringSubmatch(pqErr.Detail); m != nil {
+		return m[1]
+	}
+	return pqErr.Constraint
+}
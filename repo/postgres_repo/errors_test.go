@@ -0,0 +1,50 @@
+package postgres_repo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/assaidy/goblog/repo"
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		err  *pq.Error
+		kind error
+		msg  string
+	}{
+		{
+			err:  &pq.Error{Code: codeUniqueViolation, Detail: "Key (username)=(alice) already exists.", Constraint: "users_username_key"},
+			kind: repo.ErrConflict,
+			msg:  "username already exists",
+		},
+		{
+			err:  &pq.Error{Code: codeForeignKeyViolation, Detail: `Key (author_id)=(42) is not present in table "users".`},
+			kind: repo.ErrForeignKey,
+			msg:  "author_id does not reference an existing row",
+		},
+		{
+			err:  &pq.Error{Code: codeNotNullViolation, Column: "title"},
+			kind: repo.ErrInvalid,
+			msg:  "title is required",
+		},
+	}
+
+	for _, tt := range tests {
+		err := translateError(fmt.Errorf("query failed: %w", tt.err))
+		if !errors.Is(err, tt.kind) || err.Error() != tt.msg {
+			t.Errorf("translateError(%s) = %q; want %v %q", tt.err.Code, err, tt.kind, tt.msg)
+		}
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) {
+			t.Errorf("translateError(%s) lost the driver error", tt.err.Code)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if err := translateError(other); err != other {
+		t.Errorf("translateError changed an unrelated error to %v", err)
+	}
+}
@@ -1,24 +1,59 @@
 package postgres_repo
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"path"
 )
 
-// Migrate applies all pending SQL migrations from the migrations directory to the database.
-// It reads each SQL file and executes its contents against the provided database connection.
+// migrationsFS holds the SQL migration files, embedded so Migrate works regardless of the working directory.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID is the key of the advisory lock that keeps instances starting together
+// from migrating at the same time.
+const migrationLockID = 7_304_215_001
+
+// Migrate applies the SQL migrations from the migrations directory that have not been applied yet.
+// Applied migrations are recorded by file name in the schema_migrations table. Each migration runs
+// in a transaction together with its record, so a failing one leaves the database untouched.
 func Migrate(db *sql.DB) error {
-	// Find all migration files in the specified directory.
-	migrationFiles, err := filepath.Glob("./repo/postgres_repo/migrations/*.sql")
+	ctx := context.Background()
+
+	// Session level advisory locks belong to a connection, so keep hold of one.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version TEXT PRIMARY KEY,
+        applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    )`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	// Find all migration files in the embedded directory, in lexical (and therefore numeric) order.
+	migrationFiles, err := fs.Glob(migrationsFS, "migrations/*.sql")
 	if err != nil {
 		return fmt.Errorf("failed to list migration files: %w", err)
 	}
 
 	// Apply each migration file to the database.
 	for _, file := range migrationFiles {
-		if err := applyMigration(db, file); err != nil {
+		if err := applyMigration(ctx, conn, file); err != nil {
 			return fmt.Errorf("error applying migration %s: %w", file, err)
 		}
 	}
@@ -26,21 +61,71 @@ func Migrate(db *sql.DB) error {
 	return nil
 }
 
-// applyMigration reads the SQL file and executes its contents against the database.
+// applyMigration reads the SQL file and executes its contents against the database, unless it was applied before.
 // It is called by the Migrate function for each migration file.
-func applyMigration(db *sql.DB, filePath string) error {
+func applyMigration(ctx context.Context, conn *sql.Conn, filePath string) error {
 	// Read the content of the SQL migration file.
-	data, err := os.ReadFile(filePath)
+	data, err := migrationsFS.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read migration file %s: %w", filePath, err)
 	}
 
-	// Execute the SQL commands in the migration file.
-	_, err = db.Exec(string(data))
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version := path.Base(filePath)
+	var applied bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	// Execute the SQL commands in the migration file.
+	if _, err := tx.ExecContext(ctx, string(data)); err != nil {
 		return fmt.Errorf("failed to execute migration file %s: %w", filePath, err)
 	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
+// PendingMigrations returns the migrations that Migrate has not applied to db yet, in order.
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	migrationFiles, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+
+	var pending []string
+	for _, file := range migrationFiles {
+		if version := path.Base(file); !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
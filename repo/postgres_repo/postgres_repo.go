@@ -3,59 +3,206 @@ package postgres_repo
 // TODO: when removing users, use their ID's for new users.
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/assaidy/goblog/models"
-	"github.com/assaidy/goblog/utils"
-	_ "github.com/lib/pq"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/sqltrace"
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 // PostgresRepo implements the Storer interface for PostgreSQL.
+// Writes always go to the primary (DB). Reads are spread over the healthy read replicas,
+// except within a session that already wrote (see repo.WithSession), which reads from the primary.
 type PostgresRepo struct {
 	DB *sql.DB
+
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+	done     chan struct{}
+
+	// tx is the transaction all statements run in, if the repo was handed out by InTx.
+	tx *sql.Tx
 }
 
-// NewPostgresRepo initializes a new PostgresRepo with the given database connection string.
-func NewPostgresRepo(dbConn string) (*PostgresRepo, error) {
-	db, err := sql.Open("postgres", dbConn)
+// maxPostsPerInsert bounds the rows of a multi-row INSERT, keeping it well below Postgres's limit
+// of 65535 bind parameters.
+const maxPostsPerInsert = 1000
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Options tunes the connection pools of a PostgresRepo and configures its read replicas.
+// Zero values keep the database/sql defaults.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// ReplicaDSNs lists connection strings of read replicas. They share the pool settings above.
+	ReplicaDSNs []string
+	// HealthCheckInterval is how often replicas are pinged. Defaults to 5 seconds.
+	HealthCheckInterval time.Duration
+}
+
+// NewPostgresRepo initializes a new PostgresRepo with the given primary connection string and options.
+// Replicas that are unreachable at startup are not fatal: they start out unhealthy and
+// reads fall back to the primary until a health check succeeds.
+func NewPostgresRepo(dbConn string, opts Options) (*PostgresRepo, error) {
+	db, err := openPool(dbConn, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &PostgresRepo{DB: db}, nil
+	pg := &PostgresRepo{DB: db}
+	for i, dsn := range opts.ReplicaDSNs {
+		replicaDB, err := openPool(dsn, opts)
+		if err != nil {
+			pg.Close()
+			return nil, fmt.Errorf("invalid replica %d: %w", i, err)
+		}
+		pg.replicas = append(pg.replicas, &replica{name: fmt.Sprintf("replica-%d", i), db: replicaDB})
+	}
+
+	if len(pg.replicas) > 0 {
+		interval := opts.HealthCheckInterval
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		pg.checkReplicas()
+		pg.stop = make(chan struct{})
+		pg.done = make(chan struct{})
+		go pg.runHealthChecks(interval)
+	}
+
+	return pg, nil
+}
+
+// openPool opens a connection pool and applies the pool settings from opts.
+func openPool(dbConn string, opts Options) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+
+	return db, nil
+}
+
+// Close stops the replica health checks and closes the primary and replica pools.
+func (pg *PostgresRepo) Close() error {
+	if pg.stop != nil {
+		close(pg.stop)
+		<-pg.done
+	}
+	for _, r := range pg.replicas {
+		r.db.Close()
+	}
+	return pg.DB.Close()
+}
+
+// conn returns where writes run: the transaction, if any, or the primary.
+func (pg *PostgresRepo) conn() querier {
+	var q querier = pg.DB
+	if pg.tx != nil {
+		q = pg.tx
+	}
+	return sqltrace.Wrap(q, semconv.DBSystemPostgreSQL)
+}
+
+// readConn returns where reads run: the transaction, if any, or the pool picked by reader.
+func (pg *PostgresRepo) readConn(ctx context.Context) querier {
+	if pg.tx != nil {
+		return sqltrace.Wrap(pg.tx, semconv.DBSystemPostgreSQL)
+	}
+	return sqltrace.Wrap(pg.reader(ctx), semconv.DBSystemPostgreSQL)
+}
+
+// InTx runs fn with a copy of the repo bound to a transaction on the primary. The copy has no
+// replicas. If the repo already is bound to a transaction, fn runs in it.
+func (pg *PostgresRepo) InTx(ctx context.Context, fn func(tx repo.Storer) error) error {
+	return pg.inTx(ctx, func(tx *PostgresRepo) error { return fn(tx) })
+}
+
+func (pg *PostgresRepo) inTx(ctx context.Context, fn func(tx *PostgresRepo) error) error {
+	if pg.tx != nil {
+		return fn(pg)
+	}
+
+	sqlTx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(&PostgresRepo{DB: pg.DB, tx: sqlTx}); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return translateError(err)
+	}
+	return nil
 }
 
 // CreateUser inserts a new user into the database and returns the created user.
-func (pg *PostgresRepo) CreateUser(user *models.User) (*models.User, error) {
+func (pg *PostgresRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	repo.MarkWrite(ctx)
+
 	query := `
-    INSERT INTO users (full_name, username, email, password, bio, joined_at)
-    VALUES ($1, $2, $3, $4, $5, $6)
-    RETURNING id;`
+    INSERT INTO users (full_name, username, email, password, bio, joined_at, updated_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING id, version;`
 
-	err := pg.DB.QueryRow(query, user.FullName, user.Username, user.Email, user.Password, user.Bio, user.JoinedAt).Scan(&user.Id)
+	user.UpdatedAt = user.JoinedAt
+	err := pg.conn().QueryRowContext(ctx, query, user.FullName, user.Username, user.Email, user.Password, user.Bio, user.JoinedAt, user.UpdatedAt).Scan(&user.Id, &user.Version)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return user, nil
 }
 
 // GetUserById retrieves a user by their ID.
-func (pg *PostgresRepo) GetUserById(id int) (*models.User, error) {
+func (pg *PostgresRepo) GetUserById(ctx context.Context, id int) (*models.User, error) {
 	query := `
-    SELECT id, full_name, username, email, password, bio, joined_at
+    SELECT id, full_name, username, email, password, bio, joined_at, updated_at, version
     FROM users
     WHERE id = $1`
 
 	user := &models.User{}
-	err := pg.DB.QueryRow(query, id).Scan(
+	err := pg.readConn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&user.Id,
 		&user.FullName,
 		&user.Username,
@@ -63,10 +210,12 @@ func (pg *PostgresRepo) GetUserById(id int) (*models.User, error) {
 		&user.Password,
 		&user.Bio,
 		&user.JoinedAt,
+		&user.UpdatedAt,
+		&user.Version,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, utils.NotFound(fmt.Errorf("no user with id %d", id))
+		return nil, repo.NotFoundf("no user with id %d", id)
 	}
 	if err != nil {
 		return nil, err
@@ -76,14 +225,14 @@ func (pg *PostgresRepo) GetUserById(id int) (*models.User, error) {
 }
 
 // GetUserByUsername retrieves a user by their username.
-func (pg *PostgresRepo) GetUserByUsername(username string) (*models.User, error) {
+func (pg *PostgresRepo) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-    SELECT id, full_name, username, email, password, bio, joined_at
+    SELECT id, full_name, username, email, password, bio, joined_at, updated_at, version
     FROM users
     WHERE username = $1`
 
 	user := &models.User{}
-	err := pg.DB.QueryRow(query, username).Scan(
+	err := pg.readConn(ctx).QueryRowContext(ctx, query, username).Scan(
 		&user.Id,
 		&user.FullName,
 		&user.Username,
@@ -91,10 +240,12 @@ func (pg *PostgresRepo) GetUserByUsername(username string) (*models.User, error)
 		&user.Password,
 		&user.Bio,
 		&user.JoinedAt,
+		&user.UpdatedAt,
+		&user.Version,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, utils.NotFound(fmt.Errorf("no user with username %s", username))
+		return nil, repo.NotFoundf("no user with username %s", username)
 	}
 	if err != nil {
 		return nil, err
@@ -104,12 +255,13 @@ func (pg *PostgresRepo) GetUserByUsername(username string) (*models.User, error)
 }
 
 // GetAllUsers retrieves all users from the database.
-func (pg *PostgresRepo) GetAllUsers() ([]*models.User, error) {
+func (pg *PostgresRepo) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
-    SELECT id, full_name, username, email, bio, joined_at
-    FROM users`
+    SELECT id, full_name, username, email, bio, joined_at, updated_at, version
+    FROM users
+    ORDER BY id`
 
-	rows, err := pg.DB.Query(query)
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -125,6 +277,51 @@ func (pg *PostgresRepo) GetAllUsers() ([]*models.User, error) {
 			&user.Email,
 			&user.Bio,
 			&user.JoinedAt,
+			&user.UpdatedAt,
+			&user.Version,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUsersByIds retrieves the users with the given ids in a single query.
+func (pg *PostgresRepo) GetUsersByIds(ctx context.Context, ids []int) ([]*models.User, error) {
+	if len(ids) == 0 {
+		return make([]*models.User, 0), nil
+	}
+
+	query := `
+    SELECT id, full_name, username, email, bio, joined_at, updated_at, version
+    FROM users
+    WHERE id = ANY($1)
+    ORDER BY id`
+
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, int64Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0, len(ids))
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(
+			&user.Id,
+			&user.FullName,
+			&user.Username,
+			&user.Email,
+			&user.Bio,
+			&user.JoinedAt,
+			&user.UpdatedAt,
+			&user.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -139,70 +336,80 @@ func (pg *PostgresRepo) GetAllUsers() ([]*models.User, error) {
 }
 
 // UpdateUserById updates an existing user identified by ID with new information.
-func (pg *PostgresRepo) UpdateUserById(id int, updateReq *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+// The version is checked and incremented by the UPDATE itself, so concurrent conditional updates cannot both succeed.
+func (pg *PostgresRepo) UpdateUserById(ctx context.Context, id, version int, updateReq *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+	repo.MarkWrite(ctx)
+
 	query := `
     UPDATE users SET
         full_name = $1,
         username = $2,
         email = $3,
         password = $4,
-        bio = $5
-    WHERE id = $6
-    RETURNING joined_at`
+        bio = $5,
+        updated_at = $6,
+        version = version + 1
+    WHERE id = $7 AND ($8 = 0 OR version = $8)
+    RETURNING joined_at, version`
 
 	user := &models.User{
-		Id:       id,
-		FullName: updateReq.FullName,
-		Username: updateReq.Username,
-		Email:    updateReq.Email,
-		Password: updateReq.Password,
-		Bio:      updateReq.Bio,
+		Id:        id,
+		FullName:  updateReq.FullName,
+		Username:  updateReq.Username,
+		Email:     updateReq.Email,
+		Password:  updateReq.Password,
+		Bio:       updateReq.Bio,
+		UpdatedAt: time.Now().UTC(),
 	}
 
-	err := pg.DB.QueryRow(query,
+	err := pg.conn().QueryRowContext(ctx, query,
 		updateReq.FullName,
 		updateReq.Username,
 		updateReq.Email,
 		updateReq.Password,
 		updateReq.Bio,
+		user.UpdatedAt,
 		id,
-	).Scan(&user.JoinedAt)
+		version,
+	).Scan(&user.JoinedAt, &user.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, utils.NotFound(fmt.Errorf("no user with id %d", id))
+			return nil, pg.missingOrStale(ctx, "user", id, version)
 		}
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return user, nil
 }
 
 // DeleteUserById removes a user identified by ID from the database.
-func (pg *PostgresRepo) DeleteUserById(id int) error {
-	query := `DELETE FROM users WHERE id = $1`
+func (pg *PostgresRepo) DeleteUserById(ctx context.Context, id, version int) error {
+	repo.MarkWrite(ctx)
+
+	query := `DELETE FROM users WHERE id = $1 AND ($2 = 0 OR version = $2)`
 
-	result, err := pg.DB.Exec(query, id)
+	result, err := pg.conn().ExecContext(ctx, query, id, version)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 	if affectedRows == 0 {
-		return utils.NotFound(fmt.Errorf("no user with id %d", id))
+		return pg.missingOrStale(ctx, "user", id, version)
 	}
 
 	return nil
 }
 
 // IsUsernameUsed checks if the provided username is already in use.
-func (pg *PostgresRepo) IsUsernameUsed(username string) (bool, error) {
+func (pg *PostgresRepo) IsUsernameUsed(ctx context.Context, username string) (bool, error) {
 	query := `SELECT 1 FROM users WHERE username = $1 LIMIT 1`
 
 	var exists int
-	err := pg.DB.QueryRow(query, username).Scan(&exists)
+	err := pg.readConn(ctx).QueryRowContext(ctx, query, username).Scan(&exists)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return false, err
 	}
@@ -211,11 +418,11 @@ func (pg *PostgresRepo) IsUsernameUsed(username string) (bool, error) {
 }
 
 // IsEmailUsed checks if the provided email is already in use.
-func (pg *PostgresRepo) IsEmailUsed(email string) (bool, error) {
+func (pg *PostgresRepo) IsEmailUsed(ctx context.Context, email string) (bool, error) {
 	query := `SELECT 1 FROM users WHERE email = $1 LIMIT 1`
 
 	var exists int
-	err := pg.DB.QueryRow(query, email).Scan(&exists)
+	err := pg.readConn(ctx).QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return false, err
 	}
@@ -223,38 +430,117 @@ func (pg *PostgresRepo) IsEmailUsed(email string) (bool, error) {
 	return exists == 1, nil
 }
 
-func (pg *PostgresRepo) CreatePost(post *models.Post) (*models.Post, error) {
+func (pg *PostgresRepo) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	repo.MarkWrite(ctx)
+
 	query := `
     INSERT INTO posts (title, content, author_id, created_at, updated_at)
     VALUES ($1, $2, $3, $4, $5)
-    RETURNING id;`
+    RETURNING id, version;`
 
-	err := pg.DB.QueryRow(query, post.Title, post.Content, post.AuthorId, post.CreatedAt, post.UpdatedAt).Scan(&post.Id)
+	err := pg.conn().QueryRowContext(ctx, query, post.Title, post.Content, post.AuthorId, post.CreatedAt, post.UpdatedAt).Scan(&post.Id, &post.Version)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return post, nil
 }
 
-func (pg *PostgresRepo) GetPostById(id int) (*models.Post, error) {
+// CreatePosts inserts the posts with one INSERT per maxPostsPerInsert posts, in a single transaction.
+// COPY is not used, as it cannot return the generated ids.
+func (pg *PostgresRepo) CreatePosts(ctx context.Context, posts []*models.Post) ([]*models.Post, error) {
+	repo.MarkWrite(ctx)
+
+	err := pg.inTx(ctx, func(tx *PostgresRepo) error {
+		for start := 0; start < len(posts); start += maxPostsPerInsert {
+			if err := tx.insertPosts(ctx, posts[start:min(start+maxPostsPerInsert, len(posts))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// insertPosts inserts posts with a single statement. Each row carries its index in posts, and the
+// ids are drawn from the sequence beside it, so the statement returns which post got which id.
+func (pg *PostgresRepo) insertPosts(ctx context.Context, posts []*models.Post) error {
+	var values strings.Builder
+	args := make([]any, 0, 6*len(posts))
+	for i, post := range posts {
+		if i > 0 {
+			values.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&values, "($%d::int, $%d::text, $%d::text, $%d::int, $%d::timestamp, $%d::timestamp)",
+			n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, i, post.Title, post.Content, post.AuthorId, post.CreatedAt, post.UpdatedAt)
+	}
+
+	query := `
+    WITH new_posts (n, title, content, author_id, created_at, updated_at) AS (
+        VALUES ` + values.String() + `
+    ), numbered AS (
+        SELECT nextval(pg_get_serial_sequence('posts', 'id'))::int AS id, new_posts.* FROM new_posts
+    ), inserted AS (
+        INSERT INTO posts (id, title, content, author_id, created_at, updated_at)
+        SELECT id, title, content, author_id, created_at, updated_at FROM numbered
+        RETURNING id, version
+    )
+    SELECT numbered.n, inserted.id, inserted.version
+    FROM inserted JOIN numbered USING (id)`
+
+	rows, err := pg.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var n, id, version int
+		if err := rows.Scan(&n, &id, &version); err != nil {
+			return translateError(err)
+		}
+		if n < 0 || n >= len(posts) {
+			return fmt.Errorf("inserted post %d has index %d, out of %d", id, n, len(posts))
+		}
+		posts[n].Id, posts[n].Version = id, version
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return translateError(err)
+	}
+
+	if count != len(posts) {
+		return fmt.Errorf("inserted %d posts, not %d", count, len(posts))
+	}
+	return nil
+}
+
+func (pg *PostgresRepo) GetPostById(ctx context.Context, id int) (*models.Post, error) {
 	query := `
-    SELECT id, title, content, author_id, created_at, updated_at 
+    SELECT id, title, content, author_id, created_at, updated_at, version
     FROM posts
     WHERE id = $1`
 
 	post := &models.Post{}
-	err := pg.DB.QueryRow(query, id).Scan(
+	err := pg.readConn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&post.Id,
 		&post.Title,
 		&post.Content,
 		&post.AuthorId,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.Version,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, utils.NotFound(fmt.Errorf("no post with id %d", id))
+		return nil, repo.NotFoundf("no post with id %d", id)
 	}
 	if err != nil {
 		return nil, err
@@ -263,14 +549,19 @@ func (pg *PostgresRepo) GetPostById(id int) (*models.Post, error) {
 	return post, nil
 }
 
-func (pg *PostgresRepo) UpdatePostById(id int, postReq *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+// UpdatePostById replaces the title and content of a post.
+// The version is checked and incremented by the UPDATE itself, so concurrent conditional updates cannot both succeed.
+func (pg *PostgresRepo) UpdatePostById(ctx context.Context, id, version int, postReq *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+	repo.MarkWrite(ctx)
+
 	query := `
     UPDATE posts SET
         title = $1,
         content = $2,
-        updated_at = $3
-    WHERE id = $4
-    RETURNING author_id, created_at`
+        updated_at = $3,
+        version = version + 1
+    WHERE id = $4 AND ($5 = 0 OR version = $5)
+    RETURNING author_id, created_at, version`
 
 	post := &models.Post{
 		Id:        id,
@@ -279,45 +570,86 @@ func (pg *PostgresRepo) UpdatePostById(id int, postReq *models.PostCreateOrUpdat
 		UpdatedAt: time.Now().UTC(),
 	}
 
-	err := pg.DB.QueryRow(query, post.Title, post.Content, post.UpdatedAt, post.Id).Scan(
+	err := pg.conn().QueryRowContext(ctx, query, post.Title, post.Content, post.UpdatedAt, post.Id, version).Scan(
 		&post.AuthorId,
 		&post.CreatedAt,
+		&post.Version,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, utils.NotFound(fmt.Errorf("no post with id %d", id))
+			return nil, pg.missingOrStale(ctx, "post", id, version)
 		}
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return post, nil
 }
 
-func (pg *PostgresRepo) DeletePostById(id, authorId int) error {
-	query := `DELETE FROM posts WHERE id = $1`
+func (pg *PostgresRepo) DeletePostById(ctx context.Context, id, authorId, version int) error {
+	repo.MarkWrite(ctx)
+
+	query := `DELETE FROM posts WHERE id = $1 AND ($2 = 0 OR version = $2)`
 
-	result, err := pg.DB.Exec(query, id)
+	result, err := pg.conn().ExecContext(ctx, query, id, version)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	affectedRows, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 	if affectedRows == 0 {
-		return utils.NotFound(fmt.Errorf("no post with id %d found", id))
+		return pg.missingOrStale(ctx, "post", id, version)
 	}
 
 	return nil
 }
 
-func (pg *PostgresRepo) GetAllPosts() ([]*models.Post, error) {
+func (pg *PostgresRepo) GetAllPosts(ctx context.Context) ([]*models.Post, error) {
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    ORDER BY id`
+
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*models.Post, 0)
+	for rows.Next() {
+		post := &models.Post{}
+		if err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.AuthorId,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+		); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (pg *PostgresRepo) GetAllPostsByAuthor(ctx context.Context, authorId int) ([]*models.Post, error) {
 	query := `
-    SELECT id, title, content, author_id, created_at, updated_at 
-    FROM posts`
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE author_id = $1
+    ORDER BY id`
 
-	rows, err := pg.DB.Query(query)
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, authorId)
 	if err != nil {
 		return nil, err
 	}
@@ -333,6 +665,49 @@ func (pg *PostgresRepo) GetAllPosts() ([]*models.Post, error) {
 			&post.AuthorId,
 			&post.CreatedAt,
 			&post.UpdatedAt,
+			&post.Version,
+		); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetPostsByIds retrieves the posts with the given ids in a single query.
+func (pg *PostgresRepo) GetPostsByIds(ctx context.Context, ids []int) ([]*models.Post, error) {
+	if len(ids) == 0 {
+		return make([]*models.Post, 0), nil
+	}
+
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE id = ANY($1)
+    ORDER BY id`
+
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, int64Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*models.Post, 0, len(ids))
+	for rows.Next() {
+		post := &models.Post{}
+		if err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.AuthorId,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -346,13 +721,19 @@ func (pg *PostgresRepo) GetAllPosts() ([]*models.Post, error) {
 	return posts, nil
 }
 
-func (pg *PostgresRepo) GetAllPostsByAuthor(authorId int) ([]*models.Post, error) {
+// GetPostsByAuthorIds retrieves the posts of all the given authors in a single query.
+func (pg *PostgresRepo) GetPostsByAuthorIds(ctx context.Context, authorIds []int) ([]*models.Post, error) {
+	if len(authorIds) == 0 {
+		return make([]*models.Post, 0), nil
+	}
+
 	query := `
-    SELECT id, title, content, author_id, created_at, updated_at 
+    SELECT id, title, content, author_id, created_at, updated_at, version
     FROM posts
-    WHERE author_id = $1`
+    WHERE author_id = ANY($1)
+    ORDER BY id`
 
-	rows, err := pg.DB.Query(query, authorId)
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, int64Array(authorIds))
 	if err != nil {
 		return nil, err
 	}
@@ -368,6 +749,7 @@ func (pg *PostgresRepo) GetAllPostsByAuthor(authorId int) ([]*models.Post, error
 			&post.AuthorId,
 			&post.CreatedAt,
 			&post.UpdatedAt,
+			&post.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -380,3 +762,141 @@ func (pg *PostgresRepo) GetAllPostsByAuthor(authorId int) ([]*models.Post, error
 
 	return posts, nil
 }
+
+// CreateComment inserts a comment and fills in its id.
+func (pg *PostgresRepo) CreateComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    INSERT INTO comments (content, post_id, author_id, created_at)
+    VALUES ($1, $2, $3, $4)
+    RETURNING id;`
+
+	err := pg.conn().QueryRowContext(ctx, query, comment.Content, comment.PostId, comment.AuthorId, comment.CreatedAt).Scan(&comment.Id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return comment, nil
+}
+
+// GetCommentsByPostIds retrieves the comments of all the given posts in a single query.
+func (pg *PostgresRepo) GetCommentsByPostIds(ctx context.Context, postIds []int) ([]*models.Comment, error) {
+	if len(postIds) == 0 {
+		return make([]*models.Comment, 0), nil
+	}
+
+	query := `
+    SELECT id, content, post_id, author_id, created_at
+    FROM comments
+    WHERE post_id = ANY($1)
+    ORDER BY id`
+
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, int64Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]*models.Comment, 0)
+	for rows.Next() {
+		comment := &models.Comment{}
+		if err := rows.Scan(&comment.Id, &comment.Content, &comment.PostId, &comment.AuthorId, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// TagPost creates the missing tags and links them to the post, in a single transaction.
+func (pg *PostgresRepo) TagPost(ctx context.Context, postId int, names []string) error {
+	repo.MarkWrite(ctx)
+	if len(names) == 0 {
+		return nil
+	}
+
+	return pg.inTx(ctx, func(tx *PostgresRepo) error {
+		_, err := tx.conn().ExecContext(ctx, `
+    INSERT INTO tags (name)
+    SELECT unnest($1::text[])
+    ON CONFLICT (name) DO NOTHING`, pq.StringArray(names))
+		if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.conn().ExecContext(ctx, `
+    INSERT INTO post_tags (post_id, tag_id)
+    SELECT $1, id FROM tags WHERE name = ANY($2)
+    ON CONFLICT (post_id, tag_id) DO NOTHING`, postId, pq.StringArray(names))
+		if err != nil {
+			return translateError(err)
+		}
+		return nil
+	})
+}
+
+// GetTagsByPostIds retrieves the tags of all the given posts in a single query.
+func (pg *PostgresRepo) GetTagsByPostIds(ctx context.Context, postIds []int) (map[int][]*models.Tag, error) {
+	if len(postIds) == 0 {
+		return make(map[int][]*models.Tag), nil
+	}
+
+	query := `
+    SELECT post_tags.post_id, tags.id, tags.name
+    FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+    WHERE post_tags.post_id = ANY($1)
+    ORDER BY post_tags.post_id, tags.name`
+
+	rows, err := pg.readConn(ctx).QueryContext(ctx, query, int64Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]*models.Tag)
+	for rows.Next() {
+		var postId int
+		tag := &models.Tag{}
+		if err := rows.Scan(&postId, &tag.Id, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags[postId] = append(tags[postId], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// int64Array converts ids to a Postgres bigint[] parameter.
+func int64Array(ids []int) pq.Int64Array {
+	arr := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		arr[i] = int64(id)
+	}
+	return arr
+}
+
+// missingOrStale explains why a conditional write on a row matched nothing: either the row does
+// not exist, or it is not at the expected version. entity is "user" or "post", stored in its plural table.
+// It reads from the primary, which the write just went to.
+func (pg *PostgresRepo) missingOrStale(ctx context.Context, entity string, id, version int) error {
+	var current int
+	err := pg.conn().QueryRowContext(ctx, `SELECT version FROM `+entity+`s WHERE id = $1`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repo.NotFoundf("no %s with id %d", entity, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	return repo.VersionMismatchf("%s %d is at version %d, not %d", entity, id, current, version)
+}
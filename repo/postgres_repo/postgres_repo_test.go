@@ -0,0 +1,144 @@
+package postgres_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/storertest"
+)
+
+// adminDSN points at the maintenance database of the server the tests run against.
+// It is empty when no server is available, in which case the tests are skipped.
+var (
+	adminDSN  string
+	skipCause string
+	dbCounter atomic.Int64
+)
+
+// TestMain runs the tests against GOBLOG_TEST_POSTGRES_DSN (a key=value DSN of a superuser) when it is set,
+// otherwise it spawns a throwaway PostgreSQL server with initdb/pg_ctl from PATH (or from the PG_BIN directory).
+func TestMain(m *testing.M) {
+	if dsn := os.Getenv("GOBLOG_TEST_POSTGRES_DSN"); dsn != "" {
+		adminDSN = dsn
+		os.Exit(m.Run())
+	}
+
+	stop, err := startLocalPostgres()
+	if err != nil {
+		skipCause = err.Error()
+		os.Exit(m.Run())
+	}
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startLocalPostgres initializes a new cluster in a temporary directory and starts it on a free port.
+func startLocalPostgres() (stop func(), err error) {
+	initdb, err := findPgBinary("initdb")
+	if err != nil {
+		return nil, err
+	}
+	pgCtl, err := findPgBinary("pg_ctl")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "goblog-pg-")
+	if err != nil {
+		return nil, err
+	}
+	dataDir := filepath.Join(dir, "data")
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("initdb failed: %v\n%s", err, out)
+	}
+
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=localhost -c fsync=off", port, dir)
+	logFile := filepath.Join(dir, "postgres.log")
+	if out, err := exec.Command(pgCtl, "-D", dataDir, "-o", opts, "-l", logFile, "-w", "start").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pg_ctl start failed: %v\n%s", err, out)
+	}
+
+	adminDSN = fmt.Sprintf("host=localhost port=%d user=postgres dbname=postgres sslmode=disable", port)
+
+	return func() {
+		exec.Command(pgCtl, "-D", dataDir, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func findPgBinary(name string) (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return filepath.Join(dir, name), nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found in PATH; set PG_BIN or GOBLOG_TEST_POSTGRES_DSN to run the PostgreSQL tests", name)
+	}
+	return path, nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// newTestRepo creates a fresh database on the test server, migrates it and drops it when the test ends.
+func newTestRepo(t *testing.T) *PostgresRepo {
+	t.Helper()
+	if adminDSN == "" {
+		t.Skip(skipCause)
+	}
+
+	admin, err := sql.Open("postgres", adminDSN)
+	if err != nil {
+		t.Fatalf("failed to connect to the test server: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("goblog_test_%d_%d", os.Getpid(), dbCounter.Add(1))
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("failed to create database %s: %v", name, err)
+	}
+
+	pg, err := NewPostgresRepo(adminDSN+" dbname="+name, Options{})
+	if err != nil {
+		t.Fatalf("NewPostgresRepo: %v", err)
+	}
+	t.Cleanup(func() {
+		pg.Close()
+		admin.Exec("DROP DATABASE IF EXISTS " + name)
+	})
+
+	if err := Migrate(pg.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return pg
+}
+
+func TestStorerConformance(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) repo.Storer {
+		return newTestRepo(t)
+	})
+}
@@ -0,0 +1,83 @@
+package postgres_repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/assaidy/goblog/repo"
+)
+
+// healthCheckTimeout bounds a single replica ping.
+const healthCheckTimeout = 2 * time.Second
+
+// replica is a read-only connection pool together with its last known health.
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// reader picks the pool a read query should run on: the next healthy replica in round-robin order,
+// or the primary when the session in ctx has written, or when no replica is healthy.
+func (pg *PostgresRepo) reader(ctx context.Context) *sql.DB {
+	if len(pg.replicas) == 0 || repo.HasWritten(ctx) {
+		return pg.DB
+	}
+
+	start := pg.next.Add(1)
+	for i := range pg.replicas {
+		r := pg.replicas[(start+uint64(i))%uint64(len(pg.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+
+	return pg.DB
+}
+
+// Pools returns the connection pools of the repo by name: "primary" and those of the replicas.
+func (pg *PostgresRepo) Pools() map[string]*sql.DB {
+	pools := map[string]*sql.DB{"primary": pg.DB}
+	for _, r := range pg.replicas {
+		pools[r.name] = r.db
+	}
+	return pools
+}
+
+// runHealthChecks pings every replica on each tick until Close is called.
+func (pg *PostgresRepo) runHealthChecks(interval time.Duration) {
+	defer close(pg.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pg.stop:
+			return
+		case <-ticker.C:
+			pg.checkReplicas()
+		}
+	}
+}
+
+// checkReplicas pings every replica and records whether it is usable, logging state changes.
+func (pg *PostgresRepo) checkReplicas() {
+	for _, r := range pg.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if was := r.healthy.Swap(healthy); was != healthy {
+			if healthy {
+				slog.Info("read replica is healthy", "replica", r.name)
+			} else {
+				slog.Warn("read replica is unhealthy, falling back to the primary", "replica", r.name, "err", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package postgres_repo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/assaidy/goblog/repo"
+)
+
+// newRoutingRepo builds a PostgresRepo with unconnected pools; sql.Open never dials,
+// so reader() can be exercised without a server.
+func newRoutingRepo(t *testing.T, replicas int) *PostgresRepo {
+	t.Helper()
+	open := func() *sql.DB {
+		db, err := sql.Open("postgres", "host=invalid.example sslmode=disable")
+		if err != nil {
+			t.Fatalf("sql.Open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	pg := &PostgresRepo{DB: open()}
+	for i := 0; i < replicas; i++ {
+		r := &replica{name: "test", db: open()}
+		r.healthy.Store(true)
+		pg.replicas = append(pg.replicas, r)
+	}
+	return pg
+}
+
+func TestReaderRoundRobinsOverHealthyReplicas(t *testing.T) {
+	pg := newRoutingRepo(t, 2)
+	ctx := context.Background()
+
+	seen := map[*sql.DB]int{}
+	for i := 0; i < 10; i++ {
+		seen[pg.reader(ctx)]++
+	}
+
+	if seen[pg.DB] != 0 {
+		t.Fatalf("reads went to the primary while replicas were healthy")
+	}
+	for _, r := range pg.replicas {
+		if seen[r.db] != 5 {
+			t.Fatalf("replica got %d of 10 reads; want 5", seen[r.db])
+		}
+	}
+}
+
+func TestReaderSkipsUnhealthyReplicas(t *testing.T) {
+	pg := newRoutingRepo(t, 2)
+	ctx := context.Background()
+
+	pg.replicas[0].healthy.Store(false)
+	for i := 0; i < 4; i++ {
+		if db := pg.reader(ctx); db != pg.replicas[1].db {
+			t.Fatalf("read was not routed to the only healthy replica")
+		}
+	}
+
+	pg.replicas[1].healthy.Store(false)
+	if db := pg.reader(ctx); db != pg.DB {
+		t.Fatalf("read was not routed to the primary with no healthy replica")
+	}
+}
+
+func TestReaderUsesPrimaryAfterWriteInSession(t *testing.T) {
+	pg := newRoutingRepo(t, 1)
+	ctx := repo.WithSession(context.Background())
+
+	if db := pg.reader(ctx); db == pg.DB {
+		t.Fatalf("read went to the primary before any write")
+	}
+
+	repo.MarkWrite(ctx)
+	if db := pg.reader(ctx); db != pg.DB {
+		t.Fatalf("read after a write in the same session was not routed to the primary")
+	}
+	if db := pg.reader(context.Background()); db == pg.DB {
+		t.Fatalf("a write in one session pinned reads of other requests to the primary")
+	}
+}
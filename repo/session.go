@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// sessionKey is the context key under which a request's session is stored.
+type sessionKey struct{}
+
+// session tracks whether the current request has written to the store.
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a context carrying a fresh read-your-writes session.
+// Every Storer calls MarkWrite from its write methods. Once a write happens within the session,
+// implementations that route reads to replicas or caches must serve every following read
+// of that session from the primary.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// MarkWrite records that the session in ctx has written to the store. It is a no-op without a session.
+func MarkWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// HasWritten reports whether the session in ctx has written to the store.
+func HasWritten(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
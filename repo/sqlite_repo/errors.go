@@ -0,0 +1,50 @@
+package sqlite_repo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/assaidy/goblog/repo"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// constraintColumnsPattern extracts "users.username" from messages like
+// "UNIQUE constraint failed: users.username" (several columns are comma separated).
+var (
+	constraintColumnsPattern = regexp.MustCompile(`constraint failed: (\w+\.\w+(?:, \w+\.\w+)*)`)
+	tablePrefixPattern       = regexp.MustCompile(`\w+\.`)
+)
+
+// translateError maps SQLite constraint violations to repo error kinds.
+// Any other error is returned unchanged.
+func translateError(err error) error {
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) {
+		return err
+	}
+
+	switch liteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return repo.NewError(repo.ErrConflict, fmt.Sprintf("%s already exists", constraintColumns(liteErr)), err)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		// SQLite does not report which key failed.
+		return repo.NewError(repo.ErrForeignKey, "a referenced row does not exist", err)
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		return repo.NewError(repo.ErrInvalid, fmt.Sprintf("%s is required", constraintColumns(liteErr)), err)
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return repo.NewError(repo.ErrInvalid, "check constraint failed", err)
+	default:
+		return err
+	}
+}
+
+// constraintColumns names the columns of a failed constraint without their table prefix.
+func constraintColumns(liteErr *sqlite.Error) string {
+	m := constraintColumnsPattern.FindStringSubmatch(liteErr.Error())
+	if m == nil {
+		return "value"
+	}
+	return tablePrefixPattern.ReplaceAllString(m[1], "")
+}
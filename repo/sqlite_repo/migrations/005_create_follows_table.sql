@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS followers (
+    follower_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    followee_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (follower_id, followee_id)
+);
+
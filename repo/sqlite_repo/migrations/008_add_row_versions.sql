@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- SQLite does not allow a non-constant default on an added column, CreateUser sets it instead.
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMP;
+UPDATE users SET updated_at = joined_at;
+ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,774 @@
+package sqlite_repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/sqltrace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	_ "modernc.org/sqlite"
+)
+
+// busyTimeout is how long a connection waits on a locked database before giving up with SQLITE_BUSY.
+const busyTimeout = 5 * time.Second
+
+// maxPostsPerInsert bounds the rows of a multi-row INSERT, keeping it below SQLite's limit of
+// 32766 bind parameters.
+const maxPostsPerInsert = 1000
+
+// SqliteRepo implements the Storer interface for SQLite.
+type SqliteRepo struct {
+	DB *sql.DB
+	// tx is the transaction the methods run in, if the repo was handed out by InTx.
+	tx *sql.Tx
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NewSqliteRepo opens (or creates) the SQLite database file at the given path.
+// Every connection is opened in WAL mode with foreign keys enabled and a busy timeout,
+// and transactions take the write lock up front so concurrent writers wait instead of failing.
+func NewSqliteRepo(path string) (*SqliteRepo, error) {
+	db, err := sql.Open("sqlite", buildDSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SqliteRepo{DB: db}, nil
+}
+
+// buildDSN makes a URI of the database file path, escaped so that characters such as ? and #
+// stay part of the name, with the connection pragmas as its query.
+func buildDSN(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_txlock", "immediate")
+
+	dsn := url.URL{Scheme: "file", Path: path, OmitHost: true, RawQuery: params.Encode()}
+	return dsn.String()
+}
+
+// Close closes the underlying database.
+func (s *SqliteRepo) Close() error {
+	return s.DB.Close()
+}
+
+// conn returns where the methods run their statements: the transaction, if any, or the database.
+func (s *SqliteRepo) conn() querier {
+	var q querier = s.DB
+	if s.tx != nil {
+		q = s.tx
+	}
+	return sqltrace.Wrap(q, semconv.DBSystemSqlite)
+}
+
+// InTx runs fn with a copy of the repo bound to a transaction. If the repo already is, fn runs in it.
+func (s *SqliteRepo) InTx(ctx context.Context, fn func(tx repo.Storer) error) error {
+	return s.inTx(ctx, func(tx *SqliteRepo) error { return fn(tx) })
+}
+
+func (s *SqliteRepo) inTx(ctx context.Context, fn func(tx *SqliteRepo) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	sqlTx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(&SqliteRepo{DB: s.DB, tx: sqlTx}); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// CreateUser inserts a new user into the database and returns the created user.
+func (s *SqliteRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    INSERT INTO users (full_name, username, email, password, bio, joined_at, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    RETURNING id, version;`
+
+	user.UpdatedAt = user.JoinedAt
+	err := s.conn().QueryRowContext(ctx, query, user.FullName, user.Username, user.Email, user.Password, user.Bio, user.JoinedAt, user.UpdatedAt).Scan(&user.Id, &user.Version)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return user, nil
+}
+
+// GetUserById retrieves a user by their ID.
+func (s *SqliteRepo) GetUserById(ctx context.Context, id int) (*models.User, error) {
+	query := `
+    SELECT id, full_name, username, email, password, bio, joined_at, updated_at, version
+    FROM users
+    WHERE id = ?`
+
+	user := &models.User{}
+	err := s.conn().QueryRowContext(ctx, query, id).Scan(
+		&user.Id,
+		&user.FullName,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.Bio,
+		&user.JoinedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repo.NotFoundf("no user with id %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by their username.
+func (s *SqliteRepo) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `
+    SELECT id, full_name, username, email, password, bio, joined_at, updated_at, version
+    FROM users
+    WHERE username = ?`
+
+	user := &models.User{}
+	err := s.conn().QueryRowContext(ctx, query, username).Scan(
+		&user.Id,
+		&user.FullName,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.Bio,
+		&user.JoinedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repo.NotFoundf("no user with username %s", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetAllUsers retrieves all users from the database.
+func (s *SqliteRepo) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	query := `
+    SELECT id, full_name, username, email, bio, joined_at, updated_at, version
+    FROM users
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+// GetUsersByIds retrieves the users with the given ids in a single query.
+func (s *SqliteRepo) GetUsersByIds(ctx context.Context, ids []int) ([]*models.User, error) {
+	if len(ids) == 0 {
+		return make([]*models.User, 0), nil
+	}
+
+	query := `
+    SELECT id, full_name, username, email, bio, joined_at, updated_at, version
+    FROM users
+    WHERE id IN (` + placeholders(len(ids)) + `)
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query, intArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanUsers(rows)
+}
+
+// UpdateUserById updates an existing user identified by ID with new information.
+// The version is checked and incremented by the UPDATE itself, so concurrent conditional updates cannot both succeed.
+func (s *SqliteRepo) UpdateUserById(ctx context.Context, id, version int, updateReq *models.UserRegisterOrUpdateRequest) (*models.User, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    UPDATE users SET
+        full_name = ?,
+        username = ?,
+        email = ?,
+        password = ?,
+        bio = ?,
+        updated_at = ?,
+        version = version + 1
+    WHERE id = ? AND (? = 0 OR version = ?)
+    RETURNING joined_at, version`
+
+	user := &models.User{
+		Id:        id,
+		FullName:  updateReq.FullName,
+		Username:  updateReq.Username,
+		Email:     updateReq.Email,
+		Password:  updateReq.Password,
+		Bio:       updateReq.Bio,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	err := s.conn().QueryRowContext(ctx, query,
+		updateReq.FullName,
+		updateReq.Username,
+		updateReq.Email,
+		updateReq.Password,
+		updateReq.Bio,
+		user.UpdatedAt,
+		id,
+		version,
+		version,
+	).Scan(&user.JoinedAt, &user.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, s.missingOrStale(ctx, "user", id, version)
+		}
+		return nil, translateError(err)
+	}
+
+	return user, nil
+}
+
+// DeleteUserById removes a user identified by ID from the database.
+func (s *SqliteRepo) DeleteUserById(ctx context.Context, id, version int) error {
+	repo.MarkWrite(ctx)
+
+	query := `DELETE FROM users WHERE id = ? AND (? = 0 OR version = ?)`
+
+	result, err := s.conn().ExecContext(ctx, query, id, version, version)
+	if err != nil {
+		return translateError(err)
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if affectedRows == 0 {
+		return s.missingOrStale(ctx, "user", id, version)
+	}
+
+	return nil
+}
+
+// IsUsernameUsed checks if the provided username is already in use.
+func (s *SqliteRepo) IsUsernameUsed(ctx context.Context, username string) (bool, error) {
+	query := `SELECT 1 FROM users WHERE username = ? LIMIT 1`
+
+	var exists int
+	err := s.conn().QueryRowContext(ctx, query, username).Scan(&exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// IsEmailUsed checks if the provided email is already in use.
+func (s *SqliteRepo) IsEmailUsed(ctx context.Context, email string) (bool, error) {
+	query := `SELECT 1 FROM users WHERE email = ? LIMIT 1`
+
+	var exists int
+	err := s.conn().QueryRowContext(ctx, query, email).Scan(&exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+func (s *SqliteRepo) CreatePost(ctx context.Context, post *models.Post) (*models.Post, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    INSERT INTO posts (title, content, author_id, created_at, updated_at)
+    VALUES (?, ?, ?, ?, ?)
+    RETURNING id, version;`
+
+	err := s.conn().QueryRowContext(ctx, query, post.Title, post.Content, post.AuthorId, post.CreatedAt, post.UpdatedAt).Scan(&post.Id, &post.Version)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return post, nil
+}
+
+// CreatePosts inserts the posts with one INSERT per maxPostsPerInsert posts, in a single transaction.
+func (s *SqliteRepo) CreatePosts(ctx context.Context, posts []*models.Post) ([]*models.Post, error) {
+	repo.MarkWrite(ctx)
+
+	err := s.inTx(ctx, func(tx *SqliteRepo) error {
+		for start := 0; start < len(posts); start += maxPostsPerInsert {
+			if err := tx.insertPosts(ctx, posts[start:min(start+maxPostsPerInsert, len(posts))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// insertPosts inserts posts with a single statement. Rows get increasing ids in the order of the
+// VALUES list, so the returned ids, once sorted, are those of the posts in order.
+func (s *SqliteRepo) insertPosts(ctx context.Context, posts []*models.Post) error {
+	query := `
+    INSERT INTO posts (title, content, author_id, created_at, updated_at)
+    VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?),", len(posts)), ",") + `
+    RETURNING id, version`
+
+	args := make([]any, 0, 5*len(posts))
+	for _, post := range posts {
+		args = append(args, post.Title, post.Content, post.AuthorId, post.CreatedAt, post.UpdatedAt)
+	}
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+	defer rows.Close()
+
+	return assignInserted(rows, posts)
+}
+
+func (s *SqliteRepo) GetPostById(ctx context.Context, id int) (*models.Post, error) {
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE id = ?`
+
+	post := &models.Post{}
+	err := s.conn().QueryRowContext(ctx, query, id).Scan(
+		&post.Id,
+		&post.Title,
+		&post.Content,
+		&post.AuthorId,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repo.NotFoundf("no post with id %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// UpdatePostById replaces the title and content of a post.
+// The version is checked and incremented by the UPDATE itself, so concurrent conditional updates cannot both succeed.
+func (s *SqliteRepo) UpdatePostById(ctx context.Context, id, version int, postReq *models.PostCreateOrUpdateRequest) (*models.Post, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    UPDATE posts SET
+        title = ?,
+        content = ?,
+        updated_at = ?,
+        version = version + 1
+    WHERE id = ? AND (? = 0 OR version = ?)
+    RETURNING author_id, created_at, version`
+
+	post := &models.Post{
+		Id:        id,
+		Title:     postReq.Title,
+		Content:   postReq.Content,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	err := s.conn().QueryRowContext(ctx, query, post.Title, post.Content, post.UpdatedAt, post.Id, version, version).Scan(
+		&post.AuthorId,
+		&post.CreatedAt,
+		&post.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, s.missingOrStale(ctx, "post", id, version)
+		}
+		return nil, translateError(err)
+	}
+
+	return post, nil
+}
+
+func (s *SqliteRepo) DeletePostById(ctx context.Context, id, authorId, version int) error {
+	repo.MarkWrite(ctx)
+
+	query := `DELETE FROM posts WHERE id = ? AND (? = 0 OR version = ?)`
+
+	result, err := s.conn().ExecContext(ctx, query, id, version, version)
+	if err != nil {
+		return translateError(err)
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if affectedRows == 0 {
+		return s.missingOrStale(ctx, "post", id, version)
+	}
+
+	return nil
+}
+
+func (s *SqliteRepo) GetAllPosts(ctx context.Context) ([]*models.Post, error) {
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
+
+func (s *SqliteRepo) GetAllPostsByAuthor(ctx context.Context, authorId int) ([]*models.Post, error) {
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE author_id = ?
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query, authorId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
+
+// GetPostsByIds retrieves the posts with the given ids in a single query.
+func (s *SqliteRepo) GetPostsByIds(ctx context.Context, ids []int) ([]*models.Post, error) {
+	if len(ids) == 0 {
+		return make([]*models.Post, 0), nil
+	}
+
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE id IN (` + placeholders(len(ids)) + `)
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query, intArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
+
+// GetPostsByAuthorIds retrieves the posts of all the given authors in a single query.
+func (s *SqliteRepo) GetPostsByAuthorIds(ctx context.Context, authorIds []int) ([]*models.Post, error) {
+	if len(authorIds) == 0 {
+		return make([]*models.Post, 0), nil
+	}
+
+	query := `
+    SELECT id, title, content, author_id, created_at, updated_at, version
+    FROM posts
+    WHERE author_id IN (` + placeholders(len(authorIds)) + `)
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query, intArgs(authorIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
+
+// CreateComment inserts a comment and fills in its id.
+func (s *SqliteRepo) CreateComment(ctx context.Context, comment *models.Comment) (*models.Comment, error) {
+	repo.MarkWrite(ctx)
+
+	query := `
+    INSERT INTO comments (content, post_id, author_id, created_at)
+    VALUES (?, ?, ?, ?)
+    RETURNING id;`
+
+	err := s.conn().QueryRowContext(ctx, query, comment.Content, comment.PostId, comment.AuthorId, comment.CreatedAt).Scan(&comment.Id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return comment, nil
+}
+
+// GetCommentsByPostIds retrieves the comments of all the given posts in a single query.
+func (s *SqliteRepo) GetCommentsByPostIds(ctx context.Context, postIds []int) ([]*models.Comment, error) {
+	if len(postIds) == 0 {
+		return make([]*models.Comment, 0), nil
+	}
+
+	query := `
+    SELECT id, content, post_id, author_id, created_at
+    FROM comments
+    WHERE post_id IN (` + placeholders(len(postIds)) + `)
+    ORDER BY id`
+
+	rows, err := s.conn().QueryContext(ctx, query, intArgs(postIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]*models.Comment, 0)
+	for rows.Next() {
+		comment := &models.Comment{}
+		if err := rows.Scan(&comment.Id, &comment.Content, &comment.PostId, &comment.AuthorId, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// TagPost creates the missing tags and links them to the post, in a single transaction.
+func (s *SqliteRepo) TagPost(ctx context.Context, postId int, names []string) error {
+	repo.MarkWrite(ctx)
+	if len(names) == 0 {
+		return nil
+	}
+
+	return s.inTx(ctx, func(tx *SqliteRepo) error {
+		for _, name := range names {
+			if _, err := tx.conn().ExecContext(ctx, `INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+				return translateError(err)
+			}
+		}
+
+		query := `
+    INSERT INTO post_tags (post_id, tag_id)
+    SELECT ?, id FROM tags WHERE name IN (` + placeholders(len(names)) + `)
+    ON CONFLICT (post_id, tag_id) DO NOTHING`
+
+		args := append([]any{postId}, stringArgs(names)...)
+		if _, err := tx.conn().ExecContext(ctx, query, args...); err != nil {
+			return translateError(err)
+		}
+		return nil
+	})
+}
+
+// GetTagsByPostIds retrieves the tags of all the given posts in a single query.
+func (s *SqliteRepo) GetTagsByPostIds(ctx context.Context, postIds []int) (map[int][]*models.Tag, error) {
+	if len(postIds) == 0 {
+		return make(map[int][]*models.Tag), nil
+	}
+
+	query := `
+    SELECT post_tags.post_id, tags.id, tags.name
+    FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+    WHERE post_tags.post_id IN (` + placeholders(len(postIds)) + `)
+    ORDER BY post_tags.post_id, tags.name`
+
+	rows, err := s.conn().QueryContext(ctx, query, intArgs(postIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPostTags(rows)
+}
+
+// missingOrStale explains why a conditional write on a row matched nothing: either the row does
+// not exist, or it is not at the expected version. entity is "user" or "post", stored in its plural table.
+func (s *SqliteRepo) missingOrStale(ctx context.Context, entity string, id, version int) error {
+	var current int
+	err := s.conn().QueryRowContext(ctx, `SELECT version FROM `+entity+`s WHERE id = ?`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repo.NotFoundf("no %s with id %d", entity, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	return repo.VersionMismatchf("%s %d is at version %d, not %d", entity, id, current, version)
+}
+
+// scanUsers reads every row of a users query, without the password, into a slice.
+func scanUsers(rows *sql.Rows) ([]*models.User, error) {
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(
+			&user.Id,
+			&user.FullName,
+			&user.Username,
+			&user.Email,
+			&user.Bio,
+			&user.JoinedAt,
+			&user.UpdatedAt,
+			&user.Version,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// placeholders returns n comma separated bind parameters, for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// intArgs converts ids to query arguments.
+func intArgs(ids []int) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// stringArgs converts strings to query arguments.
+func stringArgs(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// scanPostTags reads every (post id, tag id, tag name) row of a query into the tags of each post.
+func scanPostTags(rows *sql.Rows) (map[int][]*models.Tag, error) {
+	tags := make(map[int][]*models.Tag)
+	for rows.Next() {
+		var postId int
+		tag := &models.Tag{}
+		if err := rows.Scan(&postId, &tag.Id, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags[postId] = append(tags[postId], tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// scanPosts reads every row of a posts query into a slice.
+func scanPosts(rows *sql.Rows) ([]*models.Post, error) {
+	posts := make([]*models.Post, 0)
+	for rows.Next() {
+		post := &models.Post{}
+		if err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.AuthorId,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+		); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// assignInserted reads the ids and versions returned by a multi-row INSERT of posts into them.
+func assignInserted(rows *sql.Rows, posts []*models.Post) error {
+	type inserted struct{ id, version int }
+	var all []inserted
+	for rows.Next() {
+		var row inserted
+		if err := rows.Scan(&row.id, &row.version); err != nil {
+			return translateError(err)
+		}
+		all = append(all, row)
+	}
+	if err := rows.Err(); err != nil {
+		return translateError(err)
+	}
+
+	if len(all) != len(posts) {
+		return fmt.Errorf("inserted %d posts, not %d", len(all), len(posts))
+	}
+	slices.SortFunc(all, func(a, b inserted) int { return a.id - b.id })
+	for i, post := range posts {
+		post.Id, post.Version = all[i].id, all[i].version
+	}
+	return nil
+}
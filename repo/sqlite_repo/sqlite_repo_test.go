@@ -0,0 +1,158 @@
+package sqlite_repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/storertest"
+)
+
+func TestStorerConformance(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) repo.Storer {
+		s, err := NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+		if err != nil {
+			t.Fatalf("NewSqliteRepo: %v", err)
+		}
+		t.Cleanup(func() { s.DB.Close() })
+
+		if err := Migrate(s.DB); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		return s
+	})
+}
+
+func TestPathsNeedingEscapes(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, path := range []string{filepath.Join(dir, "go?blog#1 100%.db"), "goblog.db", "go?blog.db"} {
+		s, err := NewSqliteRepo(path)
+		if err != nil {
+			t.Fatalf("NewSqliteRepo(%q): %v", path, err)
+		}
+		defer s.Close()
+		if err := Migrate(s.DB); err != nil {
+			t.Fatalf("Migrate(%q): %v", path, err)
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("database not created at %q: %v", path, err)
+		}
+		// The pragmas still apply.
+		var journalMode string
+		var foreignKeys int
+		if err := s.DB.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+			t.Errorf("%q: journal_mode = %q, %v; want wal", path, journalMode, err)
+		}
+		if err := s.DB.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+			t.Errorf("%q: foreign_keys = %d, %v; want 1", path, foreignKeys, err)
+		}
+	}
+}
+
+func TestConstraintErrorMessages(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	defer s.Close()
+	if err := Migrate(s.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	user := &models.User{FullName: "A", Username: "alice", Email: "alice@example.com", Password: "pw"}
+	if _, err := s.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	dup := *user
+	dup.Email = "other@example.com"
+	_, err = s.CreateUser(ctx, &dup)
+	if !errors.Is(err, repo.ErrConflict) || err.Error() != "username already exists" {
+		t.Fatalf("duplicate username error = %q; want ErrConflict %q", err, "username already exists")
+	}
+}
+
+func TestMigrateUpgradesUntrackedDatabase(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	defer s.Close()
+
+	// A database created before migrations were tracked: the original tables, without versions.
+	for _, file := range []string{"001_create_users_table.sql", "002_create_posts_table.sql"} {
+		data, err := migrationsFS.ReadFile("migrations/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.DB.Exec(string(data)); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+	if _, err := s.DB.Exec(`INSERT INTO users (full_name, username, email, password, bio) VALUES ('A', 'alice', 'alice@example.com', 'pw', '')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Migrate(s.DB); err != nil {
+			t.Fatalf("Migrate #%d: %v", i+1, err)
+		}
+	}
+
+	user, err := s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if user.Version != 1 || !user.UpdatedAt.Equal(user.JoinedAt) {
+		t.Fatalf("existing user got version %d and updatedAt %v; want 1 and %v", user.Version, user.UpdatedAt, user.JoinedAt)
+	}
+
+	files, _ := migrationsFS.ReadDir("migrations")
+	var applied int
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatalf("count schema_migrations: %v", err)
+	}
+	if applied != len(files) {
+		t.Fatalf("%d migrations recorded; want %d", applied, len(files))
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := PendingMigrations(ctx, s.DB); err == nil {
+		t.Fatalf("PendingMigrations of a database that was never migrated: no error")
+	}
+
+	if err := Migrate(s.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if _, err := s.DB.Exec(`DELETE FROM schema_migrations WHERE version = '008_add_row_versions.sql'`); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := PendingMigrations(ctx, s.DB)
+	if err != nil || len(pending) != 1 || pending[0] != "008_add_row_versions.sql" {
+		t.Fatalf("PendingMigrations = %v, %v; want the deleted record", pending, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package sqltrace records the SQL statements run by the repos as spans, which are children of
+// the span of the Storer call running them.
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/assaidy/goblog/repo/sqltrace")
+
+// Querier is what *sql.DB and *sql.Tx have in common.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Wrap returns a Querier running its statements on q, each in a span carrying the database system,
+// such as semconv.DBSystemSqlite, the statement and its operation. Statements are recorded as they
+// are written, with placeholders; the arguments are not. The span of a query ends once its first
+// rows are available, not when they have all been read.
+func Wrap(q Querier, system attribute.KeyValue) Querier {
+	return &tracedQuerier{q: q, system: system}
+}
+
+type tracedQuerier struct {
+	q      Querier
+	system attribute.KeyValue
+}
+
+func (t *tracedQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	result, err := t.q.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return result, err
+}
+
+func (t *tracedQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+func (t *tracedQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	row := t.q.QueryRowContext(ctx, query, args...)
+	// sql.ErrNoRows is reported by Scan, so it is not an error here.
+	recordError(span, row.Err())
+	return row
+}
+
+// start starts the span of a statement, named after its operation, such as SELECT.
+func (t *tracedQuerier) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := operation(query)
+	return tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		t.system,
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(query),
+	))
+}
+
+// operation returns the first keyword of query, in upper case.
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -1,23 +1,62 @@
 package repo
 
-import "github.com/assaidy/goblog/models"
+import (
+	"context"
+
+	"github.com/assaidy/goblog/models"
+)
 
 // Storer defines the interface for user data storage operations.
 // Implementations of this interface should provide methods for CRUD operations and checks.
+// Every method takes the context of the request it serves, so implementations can honor
+// cancellation and request-scoped state such as read-your-writes sessions.
+//
+// Users and posts carry a version that every update increments. Updates and deletes take the
+// version the caller expects the row to be at, and fail with ErrVersionMismatch, without
+// writing anything, when it is at another one. Pass AnyVersion to write unconditionally.
+//
+// GetUserById and GetUserByUsername return the password of the user only when ctx comes from
+// WithCredentials; implementations may return it otherwise, but callers must not count on it.
+//
+// InTx runs fn with a Storer whose methods all run in one transaction, committed when fn returns
+// nil and rolled back otherwise. That Storer must not be used concurrently, nor after fn returns;
+// calling its own InTx runs the nested fn in the same transaction.
 type Storer interface {
-	CreateUser(*models.User) (*models.User, error)
-	GetUserById(int) (*models.User, error)
-	GetUserByUsername(string) (*models.User, error)
-	UpdateUserById(int, *models.UserRegisterOrUpdateRequest) (*models.User, error)
-	DeleteUserById(int) error
-	GetAllUsers() ([]*models.User, error)
-	IsUsernameUsed(string) (bool, error)
-	IsEmailUsed(string) (bool, error)
+	CreateUser(context.Context, *models.User) (*models.User, error)
+	GetUserById(context.Context, int) (*models.User, error)
+	GetUserByUsername(context.Context, string) (*models.User, error)
+	UpdateUserById(ctx context.Context, id, version int, req *models.UserRegisterOrUpdateRequest) (*models.User, error)
+	DeleteUserById(ctx context.Context, id, version int) error
+	GetAllUsers(context.Context) ([]*models.User, error)
+	// GetUsersByIds returns the users with the given ids, ordered by id. Unknown ids are skipped.
+	GetUsersByIds(ctx context.Context, ids []int) ([]*models.User, error)
+	IsUsernameUsed(context.Context, string) (bool, error)
+	IsEmailUsed(context.Context, string) (bool, error)
+
+	CreatePost(context.Context, *models.Post) (*models.Post, error)
+	// CreatePosts inserts the posts with multi-row INSERTs and fills in their ids and versions.
+	// Either all of them are created, or none is.
+	CreatePosts(ctx context.Context, posts []*models.Post) ([]*models.Post, error)
+	GetPostById(context.Context, int) (*models.Post, error)
+	// GetPostsByIds returns the posts with the given ids, ordered by id. Unknown ids are skipped.
+	GetPostsByIds(ctx context.Context, ids []int) ([]*models.Post, error)
+	UpdatePostById(ctx context.Context, id, version int, req *models.PostCreateOrUpdateRequest) (*models.Post, error)
+	DeletePostById(ctx context.Context, id, authorId, version int) error
+	GetAllPosts(context.Context) ([]*models.Post, error)
+	GetAllPostsByAuthor(context.Context, int) ([]*models.Post, error)
+	// GetPostsByAuthorIds returns the posts of all the given authors, ordered by id.
+	GetPostsByAuthorIds(ctx context.Context, authorIds []int) ([]*models.Post, error)
+
+	CreateComment(context.Context, *models.Comment) (*models.Comment, error)
+	// GetCommentsByPostIds returns the comments of all the given posts, ordered by id.
+	GetCommentsByPostIds(ctx context.Context, postIds []int) ([]*models.Comment, error)
+
+	// TagPost tags the post with the tags of the given names, creating those that do not exist yet.
+	// Tags the post already has are kept.
+	TagPost(ctx context.Context, postId int, names []string) error
+	// GetTagsByPostIds returns the tags of each of the given posts, by post id, ordered by name.
+	// Posts without tags are left out.
+	GetTagsByPostIds(ctx context.Context, postIds []int) (map[int][]*models.Tag, error)
 
-	CreatePost(*models.Post) (*models.Post, error)
-	GetPostById(int) (*models.Post, error)
-	UpdatePostById(int, *models.PostCreateOrUpdateRequest) (*models.Post, error)
-	DeletePostById(int, int) error
-	GetAllPosts() ([]*models.Post, error)
-	GetAllPostsByAuthor(int) ([]*models.Post, error)
+	InTx(ctx context.Context, fn func(tx Storer) error) error
 }
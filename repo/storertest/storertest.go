@@ -0,0 +1,930 @@
+// Package storertest provides a conformance test suite that every repo.Storer implementation must pass.
+//
+// A backend wires the suite up from its own _test.go file:
+//
+//	func TestStorer(t *testing.T) {
+//		storertest.Run(t, func(t *testing.T) repo.Storer {
+//			return newEmptyMigratedStore(t)
+//		})
+//	}
+package storertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+)
+
+// Factory returns a fresh, empty and fully migrated Storer.
+// It is called once per subtest, so implementations must not share data between calls.
+// Any cleanup should be registered with t.Cleanup.
+type Factory func(t *testing.T) repo.Storer
+
+// Run executes the whole conformance suite against the Storer returned by newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, repo.Storer)
+	}{
+		{"UserCRUD", testUserCRUD},
+		{"UserUniqueness", testUserUniqueness},
+		{"UserNotFound", testUserNotFound},
+		{"PostCRUD", testPostCRUD},
+		{"PostNotFound", testPostNotFound},
+		{"PostRequiresExistingAuthor", testPostRequiresExistingAuthor},
+		{"DeleteUserCascadesToPosts", testDeleteUserCascadesToPosts},
+		{"Ordering", testOrdering},
+		{"BatchReads", testBatchReads},
+		{"CommentsAndTags", testCommentsAndTags},
+		{"CreatePosts", testCreatePosts},
+		{"Transactions", testTransactions},
+		{"ConcurrentCreateUsers", testConcurrentCreateUsers},
+		{"ConcurrentDuplicateUsername", testConcurrentDuplicateUsername},
+		{"ConcurrentUpdatePost", testConcurrentUpdatePost},
+		{"Versions", testVersions},
+		{"ConcurrentConditionalUpdate", testConcurrentConditionalUpdate},
+		{"ReadYourWrites", testReadYourWrites},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testUserCRUD(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	created := mustCreateUser(t, s, "alice")
+	if created.Id == 0 {
+		t.Fatalf("CreateUser did not assign an id")
+	}
+
+	got, err := s.GetUserById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetUserById: %v", err)
+	}
+	assertUserEqual(t, got, created)
+
+	got, err = s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	assertUserEqual(t, got, created)
+
+	// Reads for credentials return the password, even once the user was read without it.
+	if got, err := s.GetUserById(repo.WithCredentials(ctx), created.Id); err != nil || got.Password != created.Password {
+		t.Fatalf("GetUserById with credentials = %+v, %v; want the password", got, err)
+	}
+	if got, err := s.GetUserByUsername(repo.WithCredentials(ctx), "alice"); err != nil || got.Password != created.Password {
+		t.Fatalf("GetUserByUsername with credentials = %+v, %v; want the password", got, err)
+	}
+
+	if used, err := s.IsUsernameUsed(ctx, "alice"); err != nil || !used {
+		t.Fatalf("IsUsernameUsed(alice) = %v, %v; want true, nil", used, err)
+	}
+	if used, err := s.IsUsernameUsed(ctx, "bob"); err != nil || used {
+		t.Fatalf("IsUsernameUsed(bob) = %v, %v; want false, nil", used, err)
+	}
+	if used, err := s.IsEmailUsed(ctx, "alice@example.com"); err != nil || !used {
+		t.Fatalf("IsEmailUsed(alice@example.com) = %v, %v; want true, nil", used, err)
+	}
+	if used, err := s.IsEmailUsed(ctx, "bob@example.com"); err != nil || used {
+		t.Fatalf("IsEmailUsed(bob@example.com) = %v, %v; want false, nil", used, err)
+	}
+
+	updated, err := s.UpdateUserById(ctx, created.Id, repo.AnyVersion, &models.UserRegisterOrUpdateRequest{
+		FullName: "Alice Updated",
+		Username: "alice2",
+		Email:    "alice2@example.com",
+		Password: "newpassword",
+		Bio:      "new bio",
+	})
+	if err != nil {
+		t.Fatalf("UpdateUserById: %v", err)
+	}
+	if updated.Username != "alice2" || updated.FullName != "Alice Updated" || updated.Bio != "new bio" {
+		t.Fatalf("UpdateUserById returned %+v", updated)
+	}
+	assertSameTime(t, "JoinedAt", updated.JoinedAt, created.JoinedAt)
+
+	got, err = s.GetUserById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetUserById after update: %v", err)
+	}
+	assertUserEqual(t, got, updated)
+	if got, err := s.GetUserById(repo.WithCredentials(ctx), created.Id); err != nil || got.Password != "newpassword" {
+		t.Fatalf("GetUserById with credentials after update = %+v, %v; want the new password", got, err)
+	}
+
+	if _, err := s.GetUserByUsername(ctx, "alice"); !isNotFound(err) {
+		t.Fatalf("GetUserByUsername(old username) error = %v; want ErrNotFound", err)
+	}
+
+	users, err := s.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].Id != created.Id {
+		t.Fatalf("GetAllUsers returned %d users; want only %d", len(users), created.Id)
+	}
+	if users[0].Password != "" {
+		t.Fatalf("GetAllUsers must not return passwords")
+	}
+
+	if err := s.DeleteUserById(ctx, created.Id, repo.AnyVersion); err != nil {
+		t.Fatalf("DeleteUserById: %v", err)
+	}
+	if _, err := s.GetUserById(ctx, created.Id); !isNotFound(err) {
+		t.Fatalf("GetUserById after delete error = %v; want ErrNotFound", err)
+	}
+	users, err = s.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetAllUsers after delete: %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("GetAllUsers after delete returned %d users; want 0", len(users))
+	}
+}
+
+func testUserUniqueness(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+
+	dupUsername := newUser("alice")
+	dupUsername.Email = "other@example.com"
+	if _, err := s.CreateUser(ctx, dupUsername); !errors.Is(err, repo.ErrConflict) {
+		t.Fatalf("CreateUser with a duplicate username error = %v; want ErrConflict", err)
+	}
+
+	dupEmail := newUser("carol")
+	dupEmail.Email = alice.Email
+	if _, err := s.CreateUser(ctx, dupEmail); !errors.Is(err, repo.ErrConflict) {
+		t.Fatalf("CreateUser with a duplicate email error = %v; want ErrConflict", err)
+	}
+
+	if _, err := s.UpdateUserById(ctx, bob.Id, repo.AnyVersion, &models.UserRegisterOrUpdateRequest{
+		FullName: bob.FullName,
+		Username: alice.Username,
+		Email:    bob.Email,
+		Password: bob.Password,
+	}); !errors.Is(err, repo.ErrConflict) {
+		t.Fatalf("UpdateUserById to a taken username error = %v; want ErrConflict", err)
+	}
+
+	got, err := s.GetUserById(ctx, bob.Id)
+	if err != nil {
+		t.Fatalf("GetUserById: %v", err)
+	}
+	if got.Username != "bob" {
+		t.Fatalf("failed update changed the username to %q", got.Username)
+	}
+}
+
+func testUserNotFound(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const missing = 4242
+
+	if _, err := s.GetUserById(ctx, missing); !isNotFound(err) {
+		t.Errorf("GetUserById error = %v; want ErrNotFound", err)
+	}
+	if _, err := s.GetUserByUsername(ctx, "nobody"); !isNotFound(err) {
+		t.Errorf("GetUserByUsername error = %v; want ErrNotFound", err)
+	}
+	if _, err := s.UpdateUserById(ctx, missing, repo.AnyVersion, &models.UserRegisterOrUpdateRequest{
+		FullName: "x", Username: "x", Email: "x@example.com", Password: "x",
+	}); !isNotFound(err) {
+		t.Errorf("UpdateUserById error = %v; want ErrNotFound", err)
+	}
+	if err := s.DeleteUserById(ctx, missing, repo.AnyVersion); !isNotFound(err) {
+		t.Errorf("DeleteUserById error = %v; want ErrNotFound", err)
+	}
+}
+
+func testPostCRUD(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	author := mustCreateUser(t, s, "alice")
+	created := mustCreatePost(t, s, author.Id, "first")
+	if created.Id == 0 {
+		t.Fatalf("CreatePost did not assign an id")
+	}
+
+	got, err := s.GetPostById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	assertPostEqual(t, got, created)
+
+	updated, err := s.UpdatePostById(ctx, created.Id, repo.AnyVersion, &models.PostCreateOrUpdateRequest{
+		Title:    "first (edited)",
+		Content:  "edited content",
+		AuthorId: author.Id,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePostById: %v", err)
+	}
+	if updated.Title != "first (edited)" || updated.Content != "edited content" || updated.AuthorId != author.Id {
+		t.Fatalf("UpdatePostById returned %+v", updated)
+	}
+	assertSameTime(t, "CreatedAt", updated.CreatedAt, created.CreatedAt)
+	if updated.UpdatedAt.Before(created.UpdatedAt.Add(-time.Second)) {
+		t.Fatalf("UpdatePostById moved UpdatedAt backwards: %v -> %v", created.UpdatedAt, updated.UpdatedAt)
+	}
+
+	got, err = s.GetPostById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("GetPostById after update: %v", err)
+	}
+	assertPostEqual(t, got, updated)
+
+	if err := s.DeletePostById(ctx, created.Id, author.Id, repo.AnyVersion); err != nil {
+		t.Fatalf("DeletePostById: %v", err)
+	}
+	if _, err := s.GetPostById(ctx, created.Id); !isNotFound(err) {
+		t.Fatalf("GetPostById after delete error = %v; want ErrNotFound", err)
+	}
+}
+
+func testPostNotFound(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const missing = 4242
+
+	if _, err := s.GetPostById(ctx, missing); !isNotFound(err) {
+		t.Errorf("GetPostById error = %v; want ErrNotFound", err)
+	}
+	if _, err := s.UpdatePostById(ctx, missing, repo.AnyVersion, &models.PostCreateOrUpdateRequest{Title: "x", Content: "x"}); !isNotFound(err) {
+		t.Errorf("UpdatePostById error = %v; want ErrNotFound", err)
+	}
+	if err := s.DeletePostById(ctx, missing, 1, repo.AnyVersion); !isNotFound(err) {
+		t.Errorf("DeletePostById error = %v; want ErrNotFound", err)
+	}
+
+	posts, err := s.GetAllPostsByAuthor(ctx, missing)
+	if err != nil {
+		t.Fatalf("GetAllPostsByAuthor: %v", err)
+	}
+	if posts == nil || len(posts) != 0 {
+		t.Errorf("GetAllPostsByAuthor of an unknown author = %#v; want an empty, non-nil slice", posts)
+	}
+}
+
+func testPostRequiresExistingAuthor(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	post := newPost(4242, "orphan")
+	if _, err := s.CreatePost(ctx, post); !errors.Is(err, repo.ErrForeignKey) {
+		t.Fatalf("CreatePost with an unknown author error = %v; want ErrForeignKey", err)
+	}
+}
+
+func testDeleteUserCascadesToPosts(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	alicePost := mustCreatePost(t, s, alice.Id, "by alice")
+	bobPost := mustCreatePost(t, s, bob.Id, "by bob")
+
+	if err := s.DeleteUserById(ctx, alice.Id, repo.AnyVersion); err != nil {
+		t.Fatalf("DeleteUserById: %v", err)
+	}
+
+	if _, err := s.GetPostById(ctx, alicePost.Id); !isNotFound(err) {
+		t.Fatalf("post of a deleted author is still readable, err = %v", err)
+	}
+	if _, err := s.GetPostById(ctx, bobPost.Id); err != nil {
+		t.Fatalf("post of another author was removed: %v", err)
+	}
+
+	posts, err := s.GetAllPosts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllPosts: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Id != bobPost.Id {
+		t.Fatalf("GetAllPosts after cascade returned %d posts; want only %d", len(posts), bobPost.Id)
+	}
+}
+
+func testOrdering(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	var authors []*models.User
+	for i := 0; i < 3; i++ {
+		authors = append(authors, mustCreateUser(t, s, fmt.Sprintf("user%d", i)))
+	}
+	for i := 0; i < 9; i++ {
+		mustCreatePost(t, s, authors[i%len(authors)].Id, fmt.Sprintf("post %d", i))
+	}
+
+	users, err := s.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != len(authors) {
+		t.Fatalf("GetAllUsers returned %d users; want %d", len(users), len(authors))
+	}
+	for i := 1; i < len(users); i++ {
+		if users[i-1].Id >= users[i].Id {
+			t.Fatalf("GetAllUsers is not ordered by id: %d before %d", users[i-1].Id, users[i].Id)
+		}
+	}
+
+	posts, err := s.GetAllPosts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllPosts: %v", err)
+	}
+	if len(posts) != 9 {
+		t.Fatalf("GetAllPosts returned %d posts; want 9", len(posts))
+	}
+	assertPostsOrdered(t, "GetAllPosts", posts)
+
+	byAuthor, err := s.GetAllPostsByAuthor(ctx, authors[1].Id)
+	if err != nil {
+		t.Fatalf("GetAllPostsByAuthor: %v", err)
+	}
+	if len(byAuthor) != 3 {
+		t.Fatalf("GetAllPostsByAuthor returned %d posts; want 3", len(byAuthor))
+	}
+	for _, post := range byAuthor {
+		if post.AuthorId != authors[1].Id {
+			t.Fatalf("GetAllPostsByAuthor returned a post by author %d", post.AuthorId)
+		}
+	}
+	assertPostsOrdered(t, "GetAllPostsByAuthor", byAuthor)
+}
+
+func testBatchReads(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	var authors []*models.User
+	for i := 0; i < 3; i++ {
+		authors = append(authors, mustCreateUser(t, s, fmt.Sprintf("user%d", i)))
+	}
+	for i := 0; i < 9; i++ {
+		mustCreatePost(t, s, authors[i%len(authors)].Id, fmt.Sprintf("post %d", i))
+	}
+
+	// Unknown ids are skipped, duplicates and the order of the ids don't matter.
+	users, err := s.GetUsersByIds(ctx, []int{authors[2].Id, 999999, authors[0].Id, authors[2].Id})
+	if err != nil {
+		t.Fatalf("GetUsersByIds: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("GetUsersByIds returned %d users; want 2", len(users))
+	}
+	authors[0].Password, authors[2].Password = "", ""
+	assertUserEqual(t, users[0], authors[0])
+	assertUserEqual(t, users[1], authors[2])
+
+	posts, err := s.GetPostsByAuthorIds(ctx, []int{authors[2].Id, authors[0].Id})
+	if err != nil {
+		t.Fatalf("GetPostsByAuthorIds: %v", err)
+	}
+	if len(posts) != 6 {
+		t.Fatalf("GetPostsByAuthorIds returned %d posts; want 6", len(posts))
+	}
+	for _, post := range posts {
+		if post.AuthorId == authors[1].Id {
+			t.Fatalf("GetPostsByAuthorIds returned a post by author %d", post.AuthorId)
+		}
+	}
+	assertPostsOrdered(t, "GetPostsByAuthorIds", posts)
+
+	if users, err := s.GetUsersByIds(ctx, nil); err != nil || len(users) != 0 {
+		t.Fatalf("GetUsersByIds(nil) = %v, %v; want no users", users, err)
+	}
+	if posts, err := s.GetPostsByAuthorIds(ctx, nil); err != nil || len(posts) != 0 {
+		t.Fatalf("GetPostsByAuthorIds(nil) = %v, %v; want no posts", posts, err)
+	}
+
+	byIds, err := s.GetPostsByIds(ctx, []int{posts[3].Id, 999999, posts[0].Id, posts[3].Id})
+	if err != nil {
+		t.Fatalf("GetPostsByIds: %v", err)
+	}
+	if len(byIds) != 2 {
+		t.Fatalf("GetPostsByIds returned %d posts; want 2", len(byIds))
+	}
+	assertPostEqual(t, byIds[0], posts[0])
+	assertPostEqual(t, byIds[1], posts[3])
+	if posts, err := s.GetPostsByIds(ctx, nil); err != nil || len(posts) != 0 {
+		t.Fatalf("GetPostsByIds(nil) = %v, %v; want no posts", posts, err)
+	}
+}
+
+func testCommentsAndTags(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	posts := []*models.Post{
+		mustCreatePost(t, s, alice.Id, "first"),
+		mustCreatePost(t, s, alice.Id, "second"),
+		mustCreatePost(t, s, bob.Id, "third"),
+	}
+
+	for i, c := range []struct{ post, author int }{{0, 1}, {2, 0}, {0, 0}, {1, 1}} {
+		comment := &models.Comment{
+			Content:   fmt.Sprintf("comment %d", i),
+			PostId:    posts[c.post].Id,
+			AuthorId:  []int{alice.Id, bob.Id}[c.author],
+			CreatedAt: time.Now().UTC(),
+		}
+		if _, err := s.CreateComment(ctx, comment); err != nil || comment.Id == 0 {
+			t.Fatalf("CreateComment = %+v, %v", comment, err)
+		}
+	}
+	if _, err := s.CreateComment(ctx, &models.Comment{Content: "c", PostId: 4242, AuthorId: alice.Id}); !errors.Is(err, repo.ErrForeignKey) {
+		t.Fatalf("CreateComment on an unknown post error = %v; want ErrForeignKey", err)
+	}
+
+	comments, err := s.GetCommentsByPostIds(ctx, []int{posts[2].Id, 999999, posts[0].Id})
+	if err != nil {
+		t.Fatalf("GetCommentsByPostIds: %v", err)
+	}
+	var contents []string
+	for _, comment := range comments {
+		contents = append(contents, comment.Content)
+	}
+	if want := []string{"comment 0", "comment 1", "comment 2"}; !slices.Equal(contents, want) {
+		t.Fatalf("GetCommentsByPostIds returned %q; want %q", contents, want)
+	}
+	if comments[0].PostId != posts[0].Id || comments[0].AuthorId != bob.Id {
+		t.Fatalf("GetCommentsByPostIds returned %+v", comments[0])
+	}
+
+	// Tags are created once, shared by posts, and tagging again keeps the existing ones.
+	if err := s.TagPost(ctx, posts[0].Id, []string{"go", "databases"}); err != nil {
+		t.Fatalf("TagPost: %v", err)
+	}
+	if err := s.TagPost(ctx, posts[0].Id, []string{"go", "apis"}); err != nil {
+		t.Fatalf("TagPost again: %v", err)
+	}
+	if err := s.TagPost(ctx, posts[2].Id, []string{"go"}); err != nil {
+		t.Fatalf("TagPost: %v", err)
+	}
+	if err := s.TagPost(ctx, 4242, []string{"go"}); !errors.Is(err, repo.ErrForeignKey) {
+		t.Fatalf("TagPost of an unknown post error = %v; want ErrForeignKey", err)
+	}
+
+	tags, err := s.GetTagsByPostIds(ctx, []int{posts[0].Id, posts[1].Id, posts[2].Id})
+	if err != nil {
+		t.Fatalf("GetTagsByPostIds: %v", err)
+	}
+	names := map[int][]string{}
+	for postId, postTags := range tags {
+		for _, tag := range postTags {
+			names[postId] = append(names[postId], tag.Name)
+		}
+	}
+	want := map[int][]string{posts[0].Id: {"apis", "databases", "go"}, posts[2].Id: {"go"}}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("GetTagsByPostIds returned %v; want %v", names, want)
+	}
+	if tags[posts[0].Id][2].Id != tags[posts[2].Id][0].Id {
+		t.Fatalf("the go tag was created twice: %+v, %+v", tags[posts[0].Id][2], tags[posts[2].Id][0])
+	}
+
+	if comments, err := s.GetCommentsByPostIds(ctx, nil); err != nil || len(comments) != 0 {
+		t.Fatalf("GetCommentsByPostIds(nil) = %v, %v; want no comments", comments, err)
+	}
+	if tags, err := s.GetTagsByPostIds(ctx, nil); err != nil || len(tags) != 0 {
+		t.Fatalf("GetTagsByPostIds(nil) = %v, %v; want no tags", tags, err)
+	}
+}
+
+func testCreatePosts(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+
+	// More posts than fit in one INSERT, with authors interleaved.
+	var posts []*models.Post
+	for i := 0; i < 1500; i++ {
+		author := alice
+		if i%3 == 0 {
+			author = bob
+		}
+		posts = append(posts, newPost(author.Id, fmt.Sprintf("post %d", i)))
+	}
+	created, err := s.CreatePosts(ctx, posts)
+	if err != nil {
+		t.Fatalf("CreatePosts: %v", err)
+	}
+	if len(created) != len(posts) {
+		t.Fatalf("CreatePosts returned %d posts; want %d", len(created), len(posts))
+	}
+	assertPostsOrdered(t, "CreatePosts", created)
+	for i, post := range created {
+		got, err := s.GetPostById(ctx, post.Id)
+		if err != nil {
+			t.Fatalf("GetPostById(%d): %v", post.Id, err)
+		}
+		if got.Title != fmt.Sprintf("post %d", i) || got.Version != 1 {
+			t.Fatalf("post %d was created as %+v", i, got)
+		}
+		assertPostEqual(t, got, post)
+	}
+
+	// One bad post fails the whole batch, even when it is in a later INSERT.
+	posts = posts[:0]
+	for i := 0; i < 1200; i++ {
+		posts = append(posts, newPost(alice.Id, fmt.Sprintf("again %d", i)))
+	}
+	posts[1100].AuthorId = 4242
+	if _, err := s.CreatePosts(ctx, posts); !errors.Is(err, repo.ErrForeignKey) {
+		t.Fatalf("CreatePosts with an unknown author error = %v; want ErrForeignKey", err)
+	}
+	all, err := s.GetAllPosts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllPosts: %v", err)
+	}
+	if len(all) != len(created) {
+		t.Fatalf("a failed CreatePosts left %d posts behind", len(all)-len(created))
+	}
+
+	if created, err := s.CreatePosts(ctx, nil); err != nil || len(created) != 0 {
+		t.Fatalf("CreatePosts(nil) = %v, %v; want no posts", created, err)
+	}
+}
+
+func testTransactions(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice")
+	kept := mustCreatePost(t, s, alice.Id, "kept")
+
+	var created *models.Post
+	err := s.InTx(ctx, func(tx repo.Storer) error {
+		var err error
+		if created, err = tx.CreatePost(ctx, newPost(alice.Id, "committed")); err != nil {
+			return err
+		}
+		// Writes are visible within the transaction, including to nested ones.
+		return tx.InTx(ctx, func(nested repo.Storer) error {
+			if _, err := nested.GetPostById(ctx, created.Id); err != nil {
+				return fmt.Errorf("GetPostById within the transaction: %w", err)
+			}
+			_, err := nested.UpdatePostById(ctx, kept.Id, kept.Version, &models.PostCreateOrUpdateRequest{Title: "renamed", Content: "c"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	if _, err := s.GetPostById(ctx, created.Id); err != nil {
+		t.Fatalf("post created in a committed transaction: %v", err)
+	}
+	renamed, err := s.GetPostById(ctx, kept.Id)
+	if err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	if renamed.Title != "renamed" {
+		t.Fatalf("update in a committed nested transaction was lost: %+v", renamed)
+	}
+
+	// An error from fn, or from a nested fn, rolls everything back and is returned as is.
+	errBoom := errors.New("boom")
+	var rolledBack *models.Post
+	err = s.InTx(ctx, func(tx repo.Storer) error {
+		var err error
+		if rolledBack, err = tx.CreatePost(ctx, newPost(alice.Id, "rolled back")); err != nil {
+			return err
+		}
+		if err := tx.DeletePostById(ctx, kept.Id, alice.Id, repo.AnyVersion); err != nil {
+			return err
+		}
+		return tx.InTx(ctx, func(repo.Storer) error { return errBoom })
+	})
+	if err != errBoom {
+		t.Fatalf("InTx error = %v; want the error of fn", err)
+	}
+	if _, err := s.GetPostById(ctx, rolledBack.Id); !isNotFound(err) {
+		t.Fatalf("post created in a rolled back transaction is readable, err = %v", err)
+	}
+	got, err := s.GetPostById(ctx, kept.Id)
+	if err != nil {
+		t.Fatalf("post deleted in a rolled back transaction: %v", err)
+	}
+	assertPostEqual(t, got, renamed)
+}
+
+func testConcurrentCreateUsers(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const n = 20
+
+	var wg sync.WaitGroup
+	ids := make([]int, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user, err := s.CreateUser(ctx, newUser(fmt.Sprintf("user%d", i)))
+			if err == nil {
+				ids[i] = user.Id
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, n)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent CreateUser #%d: %v", i, err)
+		}
+		if seen[ids[i]] {
+			t.Fatalf("concurrent CreateUser assigned id %d twice", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+
+	users, err := s.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != n {
+		t.Fatalf("GetAllUsers returned %d users; want %d", len(users), n)
+	}
+}
+
+func testConcurrentDuplicateUsername(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const n = 10
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := newUser("contended")
+			user.Email = fmt.Sprintf("contended%d@example.com", i)
+			_, errs[i] = s.CreateUser(ctx, user)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, repo.ErrConflict) {
+			t.Fatalf("concurrent CreateUser with a taken username error = %v; want ErrConflict", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent CreateUser calls with the same username succeeded; want exactly 1", succeeded)
+	}
+}
+
+func testConcurrentUpdatePost(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const n = 10
+
+	author := mustCreateUser(t, s, "alice")
+	post := mustCreatePost(t, s, author.Id, "contended")
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.UpdatePostById(ctx, post.Id, repo.AnyVersion, &models.PostCreateOrUpdateRequest{
+				Title:    fmt.Sprintf("title %d", i),
+				Content:  fmt.Sprintf("content %d", i),
+				AuthorId: author.Id,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent UpdatePostById #%d: %v", i, err)
+		}
+	}
+
+	got, err := s.GetPostById(ctx, post.Id)
+	if err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	var i int
+	if _, err := fmt.Sscanf(got.Title, "title %d", &i); err != nil || got.Content != fmt.Sprintf("content %d", i) {
+		t.Fatalf("post ended up with a torn update: %q / %q", got.Title, got.Content)
+	}
+}
+
+func testVersions(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "alice")
+	post := mustCreatePost(t, s, user.Id, "versioned")
+	if user.Version != 1 || post.Version != 1 {
+		t.Fatalf("new rows are at versions %d and %d; want 1", user.Version, post.Version)
+	}
+
+	userReq := &models.UserRegisterOrUpdateRequest{FullName: "A", Username: "alice", Email: "alice@example.com", Password: "pw"}
+	updatedUser, err := s.UpdateUserById(ctx, user.Id, 1, userReq)
+	if err != nil {
+		t.Fatalf("UpdateUserById at the current version: %v", err)
+	}
+	if updatedUser.Version != 2 {
+		t.Fatalf("UpdateUserById returned version %d; want 2", updatedUser.Version)
+	}
+	if _, err := s.UpdateUserById(ctx, user.Id, 1, userReq); !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Fatalf("UpdateUserById at a stale version error = %v; want ErrVersionMismatch", err)
+	}
+
+	postReq := &models.PostCreateOrUpdateRequest{Title: "edited", Content: "edited", AuthorId: user.Id}
+	updatedPost, err := s.UpdatePostById(ctx, post.Id, 1, postReq)
+	if err != nil {
+		t.Fatalf("UpdatePostById at the current version: %v", err)
+	}
+	if updatedPost.Version != 2 {
+		t.Fatalf("UpdatePostById returned version %d; want 2", updatedPost.Version)
+	}
+	if _, err := s.UpdatePostById(ctx, post.Id, 1, postReq); !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Fatalf("UpdatePostById at a stale version error = %v; want ErrVersionMismatch", err)
+	}
+	if updatedPost, err = s.UpdatePostById(ctx, post.Id, repo.AnyVersion, postReq); err != nil || updatedPost.Version != 3 {
+		t.Fatalf("unconditional UpdatePostById = %+v, %v; want version 3", updatedPost, err)
+	}
+
+	got, err := s.GetPostById(ctx, post.Id)
+	if err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	assertPostEqual(t, got, updatedPost)
+
+	if err := s.DeletePostById(ctx, post.Id, user.Id, 2); !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Fatalf("DeletePostById at a stale version error = %v; want ErrVersionMismatch", err)
+	}
+	if err := s.DeletePostById(ctx, post.Id, user.Id, 3); err != nil {
+		t.Fatalf("DeletePostById at the current version: %v", err)
+	}
+	if err := s.DeleteUserById(ctx, user.Id, 1); !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Fatalf("DeleteUserById at a stale version error = %v; want ErrVersionMismatch", err)
+	}
+	if err := s.DeleteUserById(ctx, user.Id, 2); err != nil {
+		t.Fatalf("DeleteUserById at the current version: %v", err)
+	}
+	if err := s.DeleteUserById(ctx, user.Id, 2); !isNotFound(err) {
+		t.Fatalf("DeleteUserById of a deleted user error = %v; want ErrNotFound", err)
+	}
+}
+
+func testConcurrentConditionalUpdate(t *testing.T, s repo.Storer) {
+	ctx := context.Background()
+	const n = 10
+
+	author := mustCreateUser(t, s, "alice")
+	post := mustCreatePost(t, s, author.Id, "contended")
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.UpdatePostById(ctx, post.Id, post.Version, &models.PostCreateOrUpdateRequest{
+				Title:    fmt.Sprintf("title %d", i),
+				Content:  fmt.Sprintf("content %d", i),
+				AuthorId: author.Id,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, repo.ErrVersionMismatch):
+			t.Fatalf("concurrent conditional UpdatePostById #%d error = %v; want ErrVersionMismatch", i, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent updates from the same version succeeded; want exactly 1", succeeded)
+	}
+
+	got, err := s.GetPostById(ctx, post.Id)
+	if err != nil {
+		t.Fatalf("GetPostById: %v", err)
+	}
+	if got.Version != post.Version+1 {
+		t.Fatalf("post is at version %d; want %d", got.Version, post.Version+1)
+	}
+}
+
+func testReadYourWrites(t *testing.T, s repo.Storer) {
+	ctx := repo.WithSession(context.Background())
+
+	user, err := s.CreateUser(ctx, newUser("alice"))
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if !repo.HasWritten(ctx) {
+		t.Fatalf("CreateUser did not mark the session as written")
+	}
+	if _, err := s.GetUserById(ctx, user.Id); err != nil {
+		t.Fatalf("GetUserById right after CreateUser in the same session: %v", err)
+	}
+
+	post, err := s.CreatePost(ctx, newPost(user.Id, "fresh"))
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := s.GetPostById(ctx, post.Id); err != nil {
+		t.Fatalf("GetPostById right after CreatePost in the same session: %v", err)
+	}
+}
+
+// isNotFound reports whether err is the repo.ErrNotFound every Storer must return for missing rows.
+func isNotFound(err error) bool {
+	return errors.Is(err, repo.ErrNotFound)
+}
+
+func newUser(username string) *models.User {
+	return &models.User{
+		FullName: "Test " + username,
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "password",
+		Bio:      "bio of " + username,
+		JoinedAt: time.Now().UTC(),
+	}
+}
+
+func newPost(authorId int, title string) *models.Post {
+	now := time.Now().UTC()
+	return &models.Post{
+		Title:     title,
+		Content:   "content of " + title,
+		AuthorId:  authorId,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func mustCreateUser(t *testing.T, s repo.Storer, username string) *models.User {
+	ctx := context.Background()
+	t.Helper()
+	user, err := s.CreateUser(ctx, newUser(username))
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", username, err)
+	}
+	return user
+}
+
+func mustCreatePost(t *testing.T, s repo.Storer, authorId int, title string) *models.Post {
+	ctx := context.Background()
+	t.Helper()
+	post, err := s.CreatePost(ctx, newPost(authorId, title))
+	if err != nil {
+		t.Fatalf("CreatePost(%s): %v", title, err)
+	}
+	return post
+}
+
+// assertUserEqual compares users but their passwords, which reads without credentials may leave out.
+func assertUserEqual(t *testing.T, got, want *models.User) {
+	t.Helper()
+	if got.Id != want.Id || got.FullName != want.FullName || got.Username != want.Username ||
+		got.Email != want.Email || got.Bio != want.Bio || got.Version != want.Version {
+		t.Fatalf("user mismatch:\n got  %+v\n want %+v", got, want)
+	}
+	assertSameTime(t, "JoinedAt", got.JoinedAt, want.JoinedAt)
+	assertSameTime(t, "UpdatedAt", got.UpdatedAt, want.UpdatedAt)
+}
+
+func assertPostEqual(t *testing.T, got, want *models.Post) {
+	t.Helper()
+	if got.Id != want.Id || got.Title != want.Title || got.Content != want.Content || got.AuthorId != want.AuthorId ||
+		got.Version != want.Version {
+		t.Fatalf("post mismatch:\n got  %+v\n want %+v", got, want)
+	}
+	assertSameTime(t, "CreatedAt", got.CreatedAt, want.CreatedAt)
+	assertSameTime(t, "UpdatedAt", got.UpdatedAt, want.UpdatedAt)
+}
+
+func assertPostsOrdered(t *testing.T, method string, posts []*models.Post) {
+	t.Helper()
+	for i := 1; i < len(posts); i++ {
+		if posts[i-1].Id >= posts[i].Id {
+			t.Fatalf("%s is not ordered by id: %d before %d", method, posts[i-1].Id, posts[i].Id)
+		}
+	}
+}
+
+// assertSameTime compares timestamps with a tolerance, since backends store them at different precisions.
+func assertSameTime(t *testing.T, field string, got, want time.Time) {
+	t.Helper()
+	if d := got.Sub(want); d > time.Millisecond || d < -time.Millisecond {
+		t.Fatalf("%s = %v; want %v", field, got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package router
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+
+	"github.com/assaidy/goblog/graph"
+	"github.com/assaidy/goblog/handlers"
+	"github.com/assaidy/goblog/health"
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/openapi"
+	"github.com/assaidy/goblog/utils"
+	"github.com/gorilla/mux"
+)
+
+// Paths of the API description, its documentation page, the GraphQL endpoint, the probes and the metrics.
+const (
+	openAPIPath   = "/api/openapi.json"
+	docsPath      = "/api/docs"
+	graphQLPath   = "/api/graphql"
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+	metricsPath   = "/metrics"
+)
+
+var (
+	ifMatch = openapi.Parameter{
+		Name: "If-Match", In: "header",
+		Description: "ETag of the version the request applies to; the request fails with 412 if the resource is at another version",
+	}
+	ifNoneMatch = openapi.Parameter{
+		Name: "If-None-Match", In: "header",
+		Description: "ETags the client has cached; the response is 304 without a body if one of them is current",
+	}
+	ifModifiedSince = openapi.Parameter{
+		Name: "If-Modified-Since", In: "header",
+		Description: "HTTP date of the cached copy, ignored if If-None-Match is sent",
+	}
+	idempotencyKey = openapi.Parameter{
+		Name: utils.IdempotencyKeyHeader, In: "header",
+		Description: "unique key (at most 255 characters) making the request safe to retry; retries get the first response replayed",
+	}
+
+	validators = map[string]string{
+		"ETag":          "version of the returned resource",
+		"Last-Modified": "time of the last update of the returned resource",
+	}
+	rateLimited = openapi.Response{
+		Description: "the client exceeded its rate limit",
+		Headers: map[string]string{
+			"Retry-After":         "seconds to wait before retrying",
+			"RateLimit-Limit":     "requests allowed in a burst",
+			"RateLimit-Remaining": "requests left in the current burst",
+			"RateLimit-Reset":     "seconds until the full burst is allowed again",
+		},
+	}
+
+	patchBodies = func(model any) map[string]any {
+		return map[string]any{
+			utils.MergePatchMediaType: openapi.Partial(model),
+			utils.JSONPatchMediaType:  openapi.JSONPatch,
+		}
+	}
+	jsonBody = func(model any) map[string]any {
+		return map[string]any{"application/json": model}
+	}
+)
+
+// unversionedDocs documents the routes that are not versioned: those describing the API, GraphQL,
+// which evolves its schema instead, the probes and the metrics.
+var unversionedDocs = map[string]openapi.Operation{
+	"GET " + openAPIPath: {
+		ID: "getOpenAPI", Summary: "OpenAPI description of the API", Tags: []string{"meta"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Description: "this document", Body: map[string]any{}}},
+	},
+	"GET " + docsPath: {
+		ID: "getDocs", Summary: "Interactive API documentation", Tags: []string{"meta"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Description: "an HTML page"}},
+	},
+	"GET " + graphQLPath: {
+		ID: "getGraphQL", Summary: "Run a GraphQL query given as query parameters", Tags: []string{"graphql"},
+		Description: "Parameters are query, operationName and variables, a JSON object. " +
+			"Errors in the query are reported in the errors of a 200 response.",
+		Params: []openapi.Parameter{
+			{Name: "query", In: "query", Required: true, Description: "the GraphQL query"},
+			{Name: "operationName", In: "query", Description: "the operation to run if the query has several"},
+			{Name: "variables", In: "query", Description: "the variables of the operation, as a JSON object"},
+		},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:              {Description: "the result of the query", Body: graph.Response{}},
+			http.StatusTooManyRequests: rateLimited,
+		},
+	},
+	"POST " + graphQLPath: {
+		ID: "postGraphQL", Summary: "Run a GraphQL query", Tags: []string{"graphql"},
+		Description: "Users, their posts and the authors, comments and tags of posts can be queried together in one request. " +
+			"The bearer token is optional; the me query requires it. " +
+			"Errors in the query are reported in the errors of a 200 response.",
+		Request: jsonBody(graph.Request{}),
+		Responses: map[int]openapi.Response{
+			http.StatusOK:              {Description: "the result of the query", Body: graph.Response{}},
+			http.StatusUnauthorized:    {Description: "the bearer token is invalid"},
+			http.StatusTooManyRequests: rateLimited,
+		},
+	},
+	"GET " + livenessPath: {
+		ID: "getLiveness", Summary: "Liveness probe", Tags: []string{"health"},
+		Responses: map[int]openapi.Response{http.StatusOK: {Description: "the process is alive", Body: health.Report{}}},
+	},
+	"GET " + readinessPath: {
+		ID: "getReadiness", Summary: "Readiness probe", Tags: []string{"health"},
+		Description: "Checks the database, its migrations and the components of the server, each with a timeout. " +
+			"Fails as soon as a graceful shutdown starts.",
+		Responses: map[int]openapi.Response{
+			http.StatusOK:                 {Description: "every check passed", Body: health.Report{}},
+			http.StatusServiceUnavailable: {Description: "a check failed; the report tells which", Body: health.Report{}},
+		},
+	},
+	"GET " + metricsPath: {
+		ID: "getMetrics", Summary: "Prometheus metrics", Tags: []string{"health"},
+		Description: "Requests by route and status, store calls, database pools, logins, registrations and posts created, " +
+			"in the Prometheus text format.",
+		Responses: map[int]openapi.Response{http.StatusOK: {Description: "the metrics, as text"}},
+	},
+}
+
+// routeDocs documents the routes registered by registerRoutes for the version with the given
+// presenter, keyed by method and path template, relative to the version's prefix, as registered with mux.
+// Every route needs an entry, which TestRoutesAreDocumented checks.
+func routeDocs(present handlers.Presenter) map[string]openapi.Operation {
+	return map[string]openapi.Operation{
+		"POST /register": {
+			ID: "registerUser", Summary: "Register a user", Tags: []string{"users"},
+			Params:  []openapi.Parameter{idempotencyKey},
+			Request: jsonBody(models.UserRegisterOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusCreated:             {Description: "the new user", Body: present.User(&models.User{}), Headers: validators},
+				http.StatusConflict:            {Description: "a request with the same idempotency key is in flight"},
+				http.StatusUnprocessableEntity: {Description: "invalid fields, or a username or email that is taken"},
+			},
+		},
+		"POST /login": {
+			ID: "loginUser", Summary: "Log in and get a bearer token", Tags: []string{"users"},
+			Request: jsonBody(models.UserLoginRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                  {Description: "the user and a token", Body: present.Login(&models.UserLoginResponse{})},
+				http.StatusNotFound:            {Description: "unknown username or wrong password"},
+				http.StatusUnprocessableEntity: {Description: "invalid fields"},
+				http.StatusTooManyRequests:     {Description: "the client exceeded its rate limit, or the username is locked out after failed logins", Headers: rateLimited.Headers},
+			},
+		},
+		"GET /users": {
+			ID: "listUsers", Summary: "List users", Tags: []string{"users"},
+			Responses: map[int]openapi.Response{http.StatusOK: {Description: "all users", Body: present.Users(nil)}},
+		},
+		"GET /users/{id:[0-9]+}": {
+			ID: "getUser", Summary: "Get a user by id or username", Tags: []string{"users"},
+			Description: "Numeric values are looked up as ids, anything else as a username.",
+			Params: []openapi.Parameter{
+				{Name: "id", In: "path", Description: "id or username of the user", Schema: &openapi.Schema{Type: "string"}},
+				ifNoneMatch, ifModifiedSince,
+			},
+			Responses: map[int]openapi.Response{
+				http.StatusOK:          {Description: "the user", Body: present.User(&models.User{}), Headers: validators},
+				http.StatusNotModified: {Description: "the cached copy is current"},
+				http.StatusNotFound:    {},
+			},
+		},
+		// Documented by GET /api/users/{id}: OpenAPI treats both paths as the same.
+		"GET /users/{username}": {ID: "-"},
+		"PUT /users/{id:[0-9]+}": {
+			ID: "replaceUser", Summary: "Replace a user", Tags: []string{"users"}, Auth: true,
+			Params:  []openapi.Parameter{ifMatch},
+			Request: jsonBody(models.UserRegisterOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                  {Description: "the updated user", Body: present.User(&models.User{}), Headers: validators},
+				http.StatusForbidden:           {Description: "the user is not the client"},
+				http.StatusNotFound:            {},
+				http.StatusPreconditionFailed:  {Description: "the user is not at the version of If-Match"},
+				http.StatusUnprocessableEntity: {Description: "invalid fields"},
+			},
+		},
+		"PATCH /users/{id:[0-9]+}": {
+			ID: "patchUser", Summary: "Update a user with a merge patch or JSON patch", Tags: []string{"users"}, Auth: true,
+			Description: "The password can be set but is not part of the patched document.",
+			Params:      []openapi.Parameter{ifMatch},
+			Request:     patchBodies(models.UserRegisterOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                   {Description: "the updated user", Body: present.User(&models.User{}), Headers: validators},
+				http.StatusForbidden:            {Description: "the user is not the client"},
+				http.StatusNotFound:             {},
+				http.StatusConflict:             {Description: "a test operation failed, or the user changed while the patch was applied"},
+				http.StatusPreconditionFailed:   {Description: "the user is not at the version of If-Match"},
+				http.StatusUnsupportedMediaType: {Description: "the body is neither a merge patch nor a JSON patch"},
+				http.StatusUnprocessableEntity:  {Description: "an invalid patch, or invalid fields after applying it"},
+			},
+		},
+		"DELETE /users/{id:[0-9]+}": {
+			ID: "deleteUser", Summary: "Delete a user", Tags: []string{"users"}, Auth: true,
+			Params: []openapi.Parameter{ifMatch},
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                 {Description: "the user was deleted"},
+				http.StatusForbidden:          {Description: "the user is not the client"},
+				http.StatusNotFound:           {},
+				http.StatusPreconditionFailed: {Description: "the user is not at the version of If-Match"},
+			},
+		},
+
+		"GET /posts": {
+			ID: "listPosts", Summary: "List posts", Tags: []string{"posts"},
+			Responses: map[int]openapi.Response{http.StatusOK: {Description: "all posts", Body: present.Posts(nil)}},
+		},
+		"GET /users/{userId:[0-9]+}/posts": {
+			ID: "listUserPosts", Summary: "List the posts of a user", Tags: []string{"posts"},
+			Responses: map[int]openapi.Response{http.StatusOK: {Description: "the posts of the user", Body: present.Posts(nil)}},
+		},
+		"GET /posts/{id:[0-9]+}": {
+			ID: "getPost", Summary: "Get a post", Tags: []string{"posts"},
+			Params: []openapi.Parameter{ifNoneMatch, ifModifiedSince},
+			Responses: map[int]openapi.Response{
+				http.StatusOK:          {Description: "the post", Body: present.Post(&models.Post{}), Headers: validators},
+				http.StatusNotModified: {Description: "the cached copy is current"},
+				http.StatusNotFound:    {},
+			},
+		},
+		"POST /posts:batchGet": {
+			ID: "batchGetPosts", Summary: "Get several posts by id", Tags: []string{"posts"},
+			Description: fmt.Sprintf("Results are in the order of the ids; unknown ids get a 404 result. "+
+				"At most %d ids.", models.MaxPostBatch),
+			Request: jsonBody(models.PostBatchGetRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                  {Description: "the result of each id", Body: present.PostResults(nil)},
+				http.StatusUnprocessableEntity: {Description: "no ids, or too many"},
+			},
+		},
+		"POST /posts": {
+			ID: "createPost", Summary: "Create a post", Tags: []string{"posts"}, Auth: true,
+			Params:  []openapi.Parameter{idempotencyKey},
+			Request: jsonBody(models.PostCreateOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusCreated:             {Description: "the new post", Body: present.Post(&models.Post{}), Headers: validators},
+				http.StatusUnauthorized:        {Description: "a missing or invalid token, or authorId is not the authenticated user"},
+				http.StatusConflict:            {Description: "a request with the same idempotency key is in flight"},
+				http.StatusUnprocessableEntity: {Description: "invalid fields"},
+			},
+		},
+		"POST /posts:bulk": {
+			ID: "bulkPosts", Summary: "Create, update and delete several posts", Tags: []string{"posts"}, Auth: true,
+			Description: fmt.Sprintf("Operations are applied in order, with the rules of the single post routes, "+
+				"and get a result each: 201 for creates, 200 for updates, 204 for deletes, or an error. "+
+				"In transaction mode (the default) either all operations are applied, or none is: the failing one "+
+				"gets its error and the others a 424 bulk_aborted error. In bestEffort mode each operation "+
+				"is applied on its own. Versions work like If-Match, 0 meaning any. At most %d operations.",
+				models.MaxPostBatch),
+			Params:  []openapi.Parameter{idempotencyKey},
+			Request: jsonBody(models.PostBulkRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                  {Description: "the result of each operation", Body: present.PostResults(nil)},
+				http.StatusConflict:            {Description: "a request with the same idempotency key is in flight"},
+				http.StatusUnprocessableEntity: {Description: "no operations, too many, or an unknown mode"},
+			},
+		},
+		"PUT /posts/{id:[0-9]+}": {
+			ID: "replacePost", Summary: "Replace a post", Tags: []string{"posts"}, Auth: true,
+			Params:  []openapi.Parameter{ifMatch},
+			Request: jsonBody(models.PostCreateOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                  {Description: "the updated post", Body: present.Post(&models.Post{}), Headers: validators},
+				http.StatusUnauthorized:        {Description: "a missing or invalid token, or the post belongs to another user"},
+				http.StatusNotFound:            {},
+				http.StatusPreconditionFailed:  {Description: "the post is not at the version of If-Match"},
+				http.StatusUnprocessableEntity: {Description: "invalid fields"},
+			},
+		},
+		"PATCH /posts/{id:[0-9]+}": {
+			ID: "patchPost", Summary: "Update a post with a merge patch or JSON patch", Tags: []string{"posts"}, Auth: true,
+			Params:  []openapi.Parameter{ifMatch},
+			Request: patchBodies(models.PostCreateOrUpdateRequest{}),
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                   {Description: "the updated post", Body: present.Post(&models.Post{}), Headers: validators},
+				http.StatusUnauthorized:         {Description: "a missing or invalid token, or the post belongs to another user"},
+				http.StatusNotFound:             {},
+				http.StatusConflict:             {Description: "a test operation failed, or the post changed while the patch was applied"},
+				http.StatusPreconditionFailed:   {Description: "the post is not at the version of If-Match"},
+				http.StatusUnsupportedMediaType: {Description: "the body is neither a merge patch nor a JSON patch"},
+				http.StatusUnprocessableEntity:  {Description: "an invalid patch, or invalid fields after applying it"},
+			},
+		},
+		"DELETE /posts/{id:[0-9]+}": {
+			ID: "deletePost", Summary: "Delete a post", Tags: []string{"posts"}, Auth: true,
+			Params: []openapi.Parameter{ifMatch},
+			Responses: map[int]openapi.Response{
+				http.StatusOK:                 {Description: "the post was deleted"},
+				http.StatusNotFound:           {Description: "no such post of the authenticated user"},
+				http.StatusPreconditionFailed: {Description: "the post is not at the version of If-Match"},
+			},
+		},
+	}
+}
+
+// documentedRoutes returns the documentation of every route, keyed by method and full path template.
+// The operations of each version get ids prefixed with the version name, and may be rate limited.
+func documentedRoutes() map[string]openapi.Operation {
+	docs := maps.Clone(unversionedDocs)
+	for _, version := range apiVersions {
+		for key, op := range routeDocs(version.present) {
+			method, path, _ := strings.Cut(key, " ")
+			if op.ID != "-" {
+				op.ID = version.name + strings.ToUpper(op.ID[:1]) + op.ID[1:]
+				op.Deprecated = version.deprecated
+			}
+			if _, ok := op.Responses[http.StatusTooManyRequests]; !ok && op.Responses != nil {
+				op.Responses[http.StatusTooManyRequests] = rateLimited
+			}
+			docs[method+" /api/"+version.name+path] = op
+		}
+	}
+	return docs
+}
+
+// newAPIDocument returns the OpenAPI document of the API, without any routes yet.
+func newAPIDocument() *openapi.Document {
+	return openapi.New(openapi.Info{
+		Title:   "goblog API",
+		Version: apiVersions[len(apiVersions)-1].name,
+		Description: "A multi-user blog backend. Errors are RFC 7807 problem details. " +
+			"Deprecated versions answer with Deprecation and Sunset headers; " +
+			"unversioned /api paths are served by " + legacyVersion + ".",
+	}, utils.ApiError{})
+}
+
+// describeRoutes adds the routes registered with router to doc, as described by documentedRoutes.
+// It returns the routes lacking an entry, so callers decide how strict to be.
+func describeRoutes(doc *openapi.Document, router *mux.Router) (undocumented []string, err error) {
+	docs := documentedRoutes()
+
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Path prefixes of subrouters match no method of their own.
+			return nil
+		}
+
+		for _, method := range methods {
+			key := method + " " + template
+			op, ok := docs[key]
+			switch {
+			case !ok:
+				undocumented = append(undocumented, key)
+			case op.ID == "-":
+				// Covered by the entry of another route.
+			default:
+				if err := doc.Add(method, template, op); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing routes: %w", err)
+	}
+
+	return undocumented, nil
+}
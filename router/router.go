@@ -1,54 +1,265 @@
 package router
 
 import (
+	"log/slog"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
+	dtov1 "github.com/assaidy/goblog/dto/v1"
+	dtov2 "github.com/assaidy/goblog/dto/v2"
+	"github.com/assaidy/goblog/graph"
 	"github.com/assaidy/goblog/handlers"
+	"github.com/assaidy/goblog/health"
+	"github.com/assaidy/goblog/metrics"
+	"github.com/assaidy/goblog/openapi"
+	"github.com/assaidy/goblog/ratelimit"
 	"github.com/assaidy/goblog/repo"
 	"github.com/assaidy/goblog/utils"
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(store repo.Storer) http.Handler {
+// Options holds the dependencies of the router besides the store.
+type Options struct {
+	// Auth issues and verifies the tokens of users. It is required.
+	Auth *utils.Auth
+	// IdempotencyStore keeps the responses of POST requests sent with an Idempotency-Key header.
+	// Idempotency keys are ignored when it is nil.
+	IdempotencyStore utils.IdempotencyStore
+	IdempotencyTTL   time.Duration
+	// GraphQLLimits bound the queries served at /api/graphql.
+	GraphQLLimits graph.Limits
+	// Health runs the checks of /readyz. Without it, /readyz passes as long as the process answers.
+	Health *health.Checker
+	// RateLimitStore holds the token buckets of the rate limits. Requests are not limited when it is nil.
+	RateLimitStore ratelimit.Store
+	// RateLimitAPI limits the requests of each client to the API and GraphQL: of each user on
+	// routes requiring a token, of each address elsewhere.
+	RateLimitAPI ratelimit.Limit
+	// RateLimitAuth further limits the logins and registrations of each address.
+	RateLimitAuth ratelimit.Limit
+	// TrustedProxies are the reverse proxies whose Forwarded or X-Forwarded-* headers tell the
+	// addresses of clients, and whether they used HTTPS.
+	TrustedProxies utils.TrustedProxies
+	// CORS tells which browser clients of other origins may call the API. Without ExposedHeaders,
+	// their scripts may read the headers of the API: validators, rate limits, deprecations and request ids.
+	CORS            utils.CORSOptions
+	SecurityHeaders utils.SecurityHeaders
+}
+
+// exposedHeaders are the response headers of the API that browser clients of other origins may read by default.
+var exposedHeaders = []string{
+	"ETag", "Last-Modified", "Location", "Link", "Deprecation", "Sunset", "Retry-After",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", utils.RequestIDHeader,
+}
+
+// rateLimited returns a middleware applying policy, which does nothing without a store.
+func (o Options) rateLimited(policy utils.RateLimitPolicy) func(http.Handler) http.Handler {
+	if o.RateLimitStore == nil {
+		return func(h http.Handler) http.Handler { return h }
+	}
+	return utils.RateLimitMiddleware(o.RateLimitStore, policy)
+}
+
+// apiVersion is a version of the API, served under /api/<name>.
+type apiVersion struct {
+	name    string
+	present handlers.Presenter
+	// deprecated is set for versions that will be removed; their responses carry Deprecation and Sunset headers.
+	deprecated   bool
+	deprecatedAt time.Time
+	sunset       time.Time
+}
+
+// apiVersions lists the versions of the API, oldest first. The last one is current.
+var apiVersions = []apiVersion{
+	{
+		name:         "v1",
+		present:      dtov1.Presenter{},
+		deprecated:   true,
+		deprecatedAt: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		sunset:       time.Date(2027, 4, 19, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		name:    "v2",
+		present: dtov2.Presenter{},
+	},
+}
+
+// legacyVersion serves the unversioned /api paths that clients used before the API was versioned.
+const legacyVersion = "v1"
+
+func NewRouter(store repo.Storer, opts Options) http.Handler {
+	// Requests are identified, traced, logged and measured outside of mux, so unmatched routes are too.
+	// Panics are recovered within, so they are logged and counted as 500s.
+	// Preflight requests are answered before reaching mux, which has no OPTIONS routes.
+	cors := opts.CORS
+	if cors.ExposedHeaders == nil {
+		cors.ExposedHeaders = exposedHeaders
+	}
+	handler := utils.CORSMiddleware(cors)(legacyPaths(newMux(store, opts)))
+	handler = utils.SecurityHeadersMiddleware(opts.SecurityHeaders)(handler)
+	handler = utils.MetricsMiddleware(utils.RecoveryMiddleware(handler))
+	handler = utils.TracingMiddleware(utils.LoggingMiddleware(handler))
+	return utils.RequestIDMiddleware(utils.ClientIPMiddleware(opts.TrustedProxies)(handler))
+}
+
+// newMux registers the routes of every API version, the GraphQL endpoint, the probes and the metrics,
+// and documents them at /api/openapi.json.
+func newMux(store repo.Storer, opts Options) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+	router.NotFoundHandler = utils.NotFoundHandler()
+	router.MethodNotAllowedHandler = utils.MethodNotAllowedHandler()
+	router.Use(utils.RouteMiddleware)
+	router.Use(utils.ReadYourWritesMiddleware)
+
+	// Retried POSTs are answered with the first response instead of creating duplicates.
+	idempotent := func(h http.Handler) http.Handler { return h }
+	if opts.IdempotencyStore != nil {
+		idempotent = utils.IdempotencyMiddleware(opts.IdempotencyStore, opts.IdempotencyTTL)
+	}
 
-	// Create a protected subrouter with /api prefix
-	protected := router.PathPrefix("/api").Subrouter()
-	protected.Use(utils.JWTAuthMiddleware)
+	current := apiVersions[len(apiVersions)-1]
+	for _, version := range apiVersions {
+		versioned := func(h http.Handler) http.Handler { return h }
+		if version.deprecated {
+			versioned = utils.DeprecationMiddleware(version.deprecatedAt, version.sunset, "/api/"+current.name)
+		}
+		registerRoutes(router, "/api/"+version.name, store, version.present, opts, versioned, idempotent)
+	}
 
-	userHandler := handlers.NewUserHandler(store)
+	graphQLHandler, err := graph.NewHandler(store, opts.GraphQLLimits)
+	if err != nil {
+		panic(err)
+	}
+	limited := opts.rateLimited(utils.RateLimitPolicy{Name: "api", Limit: opts.RateLimitAPI, PerUser: true})
+	router.Handle(graphQLPath,
+		opts.Auth.OptionalJWTAuthMiddleware(limited(utils.MakeHandlerFunc(graphQLHandler.HandleQuery)))).Methods("GET", "POST")
 
-	router.HandleFunc("/api/register",
-		utils.MakeHandlerFunc(userHandler.HandleRegisterUser)).Methods("POST")
-	router.HandleFunc("/api/login",
-		utils.MakeHandlerFunc(userHandler.HandleLoginUser)).Methods("POST")
-	router.HandleFunc("/api/users",
+	checker := opts.Health
+	if checker == nil {
+		checker = health.NewChecker(0)
+	}
+	router.Handle(livenessPath, health.LivenessHandler()).Methods("GET")
+	router.Handle(readinessPath, checker.ReadinessHandler()).Methods("GET")
+	router.Handle(metricsPath, metrics.Handler()).Methods("GET")
+
+	// The document is encoded on its first request, once all routes are described.
+	doc := newAPIDocument()
+	router.Handle(openAPIPath, doc.Handler()).Methods("GET")
+	router.Handle(docsPath, openapi.DocsHandler(openAPIPath)).Methods("GET")
+
+	undocumented, err := describeRoutes(doc, router)
+	if err != nil {
+		panic(err)
+	}
+	for _, route := range undocumented {
+		slog.Warn("Route is missing from the OpenAPI document", "route", route)
+	}
+
+	return router
+}
+
+// registerRoutes registers the routes of one API version under prefix, with every handler wrapped by versioned.
+// The routes are added to router itself: routes of subrouters answer 404 rather than 405 for paths
+// that only exist with other methods.
+// Every version shares the same rate limits, so clients cannot get around them by switching versions.
+func registerRoutes(router *mux.Router, prefix string, store repo.Storer, present handlers.Presenter, opts Options,
+	versioned, idempotent func(http.Handler) http.Handler) {
+	limitedByIP := opts.rateLimited(utils.RateLimitPolicy{Name: "api", Limit: opts.RateLimitAPI})
+	limitedByUser := opts.rateLimited(utils.RateLimitPolicy{Name: "api", Limit: opts.RateLimitAPI, PerUser: true})
+	limitedAuth := opts.rateLimited(utils.RateLimitPolicy{Name: "auth", Limit: opts.RateLimitAuth})
+
+	api := &routes{router: router, prefix: prefix, wrap: func(h http.Handler) http.Handler {
+		return versioned(limitedByIP(h))
+	}}
+	// Routes requiring a token
+	protected := &routes{router: router, prefix: prefix, wrap: func(h http.Handler) http.Handler {
+		return versioned(opts.Auth.JWTAuthMiddleware(limitedByUser(h)))
+	}}
+
+	userHandler := handlers.NewUserHandler(store, present, opts.Auth)
+
+	api.Handle("/register",
+		limitedAuth(idempotent(utils.MakeHandlerFunc(userHandler.HandleRegisterUser)))).Methods("POST")
+	api.Handle("/login",
+		limitedAuth(utils.MakeHandlerFunc(userHandler.HandleLoginUser))).Methods("POST")
+	api.HandleFunc("/users",
 		utils.MakeHandlerFunc(userHandler.HandleGetAllUsers)).Methods("GET")
-	router.HandleFunc("/api/users/{id:[0-9]+}",
+	api.HandleFunc("/users/{id:[0-9]+}",
 		utils.MakeHandlerFunc(userHandler.HandleGetUserById)).Methods("GET")
-	router.HandleFunc("/api/users/{username}",
+	api.HandleFunc("/users/{username}",
 		utils.MakeHandlerFunc(userHandler.HandleGetUserByUsername)).Methods("GET")
 
-	protected.HandleFunc("/api/users/{id:[0-9]+}",
+	protected.HandleFunc("/users/{id:[0-9]+}",
 		utils.MakeHandlerFunc(userHandler.HandleUpdateUserById)).Methods("PUT")
-	protected.HandleFunc("/api/users/{id:[0-9]+}",
+	protected.HandleFunc("/users/{id:[0-9]+}",
+		utils.MakeHandlerFunc(userHandler.HandlePatchUserById)).Methods("PATCH")
+	protected.HandleFunc("/users/{id:[0-9]+}",
 		utils.MakeHandlerFunc(userHandler.HandleDeleteUserById)).Methods("DELETE")
 
-	postHandler := handlers.NewPostHandler(store)
+	postHandler := handlers.NewPostHandler(store, present)
 
-	router.HandleFunc("/api/posts",
+	api.HandleFunc("/posts",
 		utils.MakeHandlerFunc(postHandler.HandleGetAllPosts)).Methods("GET")
-    router.HandleFunc("/api/users/{userId:[0-9]+}/posts",
-        utils.MakeHandlerFunc(postHandler.HandleGetAllPostsByUser)).Methods("GET")
-	router.HandleFunc("/api/posts/{id:[0-9]+}",
+	api.HandleFunc("/users/{userId:[0-9]+}/posts",
+		utils.MakeHandlerFunc(postHandler.HandleGetAllPostsByUser)).Methods("GET")
+	api.HandleFunc("/posts/{id:[0-9]+}",
 		utils.MakeHandlerFunc(postHandler.HandleGetPostById)).Methods("GET")
+	api.HandleFunc("/posts:batchGet",
+		utils.MakeHandlerFunc(postHandler.HandleBatchGetPosts)).Methods("POST")
 
-	protected.HandleFunc("/posts",
-		utils.MakeHandlerFunc(postHandler.HandleCreatePost)).Methods("POST")
+	protected.Handle("/posts",
+		idempotent(utils.MakeHandlerFunc(postHandler.HandleCreatePost))).Methods("POST")
 	protected.HandleFunc("/posts/{id:[0-9]+}",
 		utils.MakeHandlerFunc(postHandler.HandleUpdatePostById)).Methods("PUT")
+	protected.HandleFunc("/posts/{id:[0-9]+}",
+		utils.MakeHandlerFunc(postHandler.HandlePatchPostById)).Methods("PATCH")
 	protected.HandleFunc("/posts/{id:[0-9]+}",
 		utils.MakeHandlerFunc(postHandler.HandleDeletePostById)).Methods("DELETE")
+	protected.Handle("/posts:bulk",
+		idempotent(utils.MakeHandlerFunc(postHandler.HandleBulkPosts))).Methods("POST")
+}
 
-	return router
+// routes registers routes under a path prefix, with their handlers wrapped by a middleware.
+type routes struct {
+	router *mux.Router
+	prefix string
+	wrap   func(http.Handler) http.Handler
+}
+
+func (r *routes) Handle(path string, handler http.Handler) *mux.Route {
+	return r.router.Handle(r.prefix+path, r.wrap(handler))
+}
+
+func (r *routes) HandleFunc(path string, f http.HandlerFunc) *mux.Route {
+	return r.Handle(path, f)
+}
+
+// unversionedPaths are the /api paths that legacyPaths leaves alone.
+var unversionedPaths = map[string]bool{openAPIPath: true, docsPath: true, graphQLPath: true}
+
+// versionedPath matches the part of a path after /api/ that starts with a version, e.g. "v2/posts".
+var versionedPath = regexp.MustCompile(`^v[0-9]+(/|$)`)
+
+// legacyPaths serves unversioned API paths such as /api/posts with the legacy version, as if
+// /api/v1/posts was requested, so clients written before versioning keep working.
+func legacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+		if !ok || versionedPath.MatchString(rest) || unversionedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/api/" + legacyVersion + "/" + rest
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
 }
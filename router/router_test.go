@@ -0,0 +1,550 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/ratelimit"
+	"github.com/assaidy/goblog/repo"
+	"github.com/assaidy/goblog/repo/cache_repo"
+	"github.com/assaidy/goblog/repo/sqlite_repo"
+	"github.com/assaidy/goblog/utils"
+	"github.com/gorilla/mux"
+)
+
+// TestRoutesAreDocumented fails when a route is registered without an entry in routeDocs or unversionedDocs,
+// or when they document a route that no longer exists.
+// testAuth signs the tokens of the tests.
+var testAuth = utils.NewAuth("router-test-secret", time.Hour, nil, nil)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	router := newMux(nil, Options{Auth: testAuth})
+	docs := documentedRoutes()
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			key := method + " " + template
+			registered[key] = true
+			if _, ok := docs[key]; !ok {
+				t.Errorf("route %s is not documented", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range docs {
+		if !registered[key] {
+			t.Errorf("%s is documented but not a registered route", key)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler := NewRouter(nil, Options{Auth: testAuth})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, openAPIPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", openAPIPath, w.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct{ Schemas map[string]any }      `json:"components"`
+	}
+	body := w.Body.Bytes()
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, want 3.1.0", doc.OpenAPI)
+	}
+
+	// Every reference resolves.
+	for _, m := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllSubmatch(body, -1) {
+		if _, ok := doc.Components.Schemas[string(m[1])]; !ok {
+			t.Errorf("unresolved reference to schema %s", m[1])
+		}
+	}
+
+	operationIds := map[string]string{}
+	for path, item := range doc.Paths {
+		// Colons are fine in paths such as /posts:bulk, but not in parameters such as {id:[0-9]+}.
+		if regexp.MustCompile(`\{[^}]*:`).MatchString(path) {
+			t.Errorf("path %s still contains a mux pattern", path)
+		}
+		for method, raw := range item {
+			var op struct {
+				OperationID string `json:"operationId"`
+				Parameters  []struct {
+					Name string `json:"name"`
+					In   string `json:"in"`
+				} `json:"parameters"`
+				Responses map[string]any `json:"responses"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Fatal(err)
+			}
+
+			if other, ok := operationIds[op.OperationID]; ok || op.OperationID == "" {
+				t.Errorf("%s %s: operationId %q is empty or also used by %s", method, path, op.OperationID, other)
+			}
+			operationIds[op.OperationID] = method + " " + path
+
+			// Every path parameter is declared.
+			for _, m := range regexp.MustCompile(`\{([^}]+)\}`).FindAllStringSubmatch(path, -1) {
+				declared := false
+				for _, p := range op.Parameters {
+					declared = declared || (p.In == "path" && p.Name == m[1])
+				}
+				if !declared {
+					t.Errorf("%s %s: path parameter %s is not declared", method, path, m[1])
+				}
+			}
+			if len(op.Responses) == 0 {
+				t.Errorf("%s %s: no responses", method, path)
+			}
+		}
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	handler := NewRouter(nil, Options{Auth: testAuth})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, docsPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", docsPath, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), `"`+openAPIPath+`"`) {
+		t.Errorf("the page does not load %s", openAPIPath)
+	}
+	// The page must work offline: no scripts or styles from elsewhere.
+	if regexp.MustCompile(`(src|href)="https?:`).MatchString(w.Body.String()) {
+		t.Error("the page loads external resources")
+	}
+}
+
+// newTestStore returns a migrated SQLite store in a temporary directory.
+func newTestStore(t *testing.T) repo.Storer {
+	t.Helper()
+	s, err := sqlite_repo.NewSqliteRepo(filepath.Join(t.TempDir(), "goblog.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteRepo: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := sqlite_repo.Migrate(s.DB); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return s
+}
+
+func TestVersions(t *testing.T) {
+	handler := NewRouter(newTestStore(t), Options{Auth: testAuth})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/register", strings.NewReader(
+		`{"fullName":"Jane Doe","username":"jane","email":"jane@example.com","password":"secret"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		path       string
+		deprecated bool
+		// list unwraps the users of a list response.
+		list func(body []byte) ([]map[string]any, error)
+		// password reports whether users have a password field.
+		password bool
+	}{
+		{"/api/v1/users", true, plainList, true},
+		{"/api/users", true, plainList, true},
+		{"/api/v2/users", false, dataList, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			users, err := tt.list(w.Body.Bytes())
+			if err != nil || len(users) != 1 {
+				t.Fatalf("got %s (%v), want a list of one user", w.Body, err)
+			}
+			if users[0]["username"] != "jane" {
+				t.Errorf("username = %v, want jane", users[0]["username"])
+			}
+			if _, ok := users[0]["password"]; ok != tt.password {
+				t.Errorf("password field present: %v, want %v", ok, tt.password)
+			}
+
+			deprecation, sunset := w.Header().Get("Deprecation"), w.Header().Get("Sunset")
+			if tt.deprecated && (!strings.HasPrefix(deprecation, "@") || sunset == "") {
+				t.Errorf("Deprecation = %q, Sunset = %q, want both set", deprecation, sunset)
+			}
+			if !tt.deprecated && (deprecation != "" || sunset != "") {
+				t.Errorf("Deprecation = %q, Sunset = %q, want neither", deprecation, sunset)
+			}
+		})
+	}
+}
+
+func plainList(body []byte) (users []map[string]any, err error) {
+	err = json.Unmarshal(body, &users)
+	return users, err
+}
+
+func dataList(body []byte) ([]map[string]any, error) {
+	var list struct {
+		Data []map[string]any `json:"data"`
+	}
+	err := json.Unmarshal(body, &list)
+	return list.Data, err
+}
+
+func TestUnmatchedRoutes(t *testing.T) {
+	handler := NewRouter(nil, Options{Auth: testAuth})
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/api/v2/users", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/posts/1", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/users", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v3/users", http.StatusNotFound},
+		{http.MethodGet, "/api/v2/nope", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+// registerAndLogin registers a user with the password "secret" and returns its token.
+func registerAndLogin(t *testing.T, handler http.Handler, username string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/register", strings.NewReader(
+		`{"username":"`+username+`","email":"`+username+`@example.com","password":"secret"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/login", strings.NewReader(
+		`{"username":"`+username+`","password":"secret"}`)))
+	var login struct{ Token string }
+	if err := json.Unmarshal(w.Body.Bytes(), &login); err != nil || login.Token == "" {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	return login.Token
+}
+
+func TestUsersOnlyChangeThemselves(t *testing.T) {
+	handler := NewRouter(newTestStore(t), Options{Auth: testAuth})
+	jane := registerAndLogin(t, handler, "jane")
+	registerAndLogin(t, handler, "john")
+	do := func(method, path, contentType, body string) int {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+jane)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// john is user 2.
+	for _, tt := range []struct{ method, contentType, body string }{
+		{http.MethodPut, "application/json", `{"username":"john","email":"taken@example.com","password":"taken"}`},
+		{http.MethodPatch, "application/merge-patch+json", `{"password":"taken"}`},
+		{http.MethodDelete, "", ""},
+	} {
+		if got := do(tt.method, "/api/v2/users/2", tt.contentType, tt.body); got != http.StatusForbidden {
+			t.Errorf("%s of another user: status %d, want 403", tt.method, got)
+		}
+	}
+	if got := do(http.MethodPatch, "/api/v2/users/1", "application/merge-patch+json", `{"bio":"mine"}`); got != http.StatusOK {
+		t.Errorf("PATCH of oneself: status %d, want 200", got)
+	}
+}
+
+func TestPostsOnlyChangedByTheirAuthor(t *testing.T) {
+	handler := NewRouter(newTestStore(t), Options{Auth: testAuth})
+	jane, john := registerAndLogin(t, handler, "jane"), registerAndLogin(t, handler, "john")
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/v2/posts", jane, `{"title":"jane's","content":"mine","authorId":1}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	// john claims to be the author of jane's post.
+	if w := do(http.MethodPut, "/api/v2/posts/1", john, `{"title":"john's","content":"taken","authorId":2}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("PUT of another user's post: status %d, want 401", w.Code)
+	}
+	// jane cannot hand her post over to john.
+	if w := do(http.MethodPut, "/api/v2/posts/1", jane, `{"title":"john's","content":"given","authorId":2}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("PUT handing the post over: status %d, want 401", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v2/posts/1", jane, ""); !strings.Contains(w.Body.String(), `"jane's"`) {
+		t.Errorf("post changed: %s", w.Body)
+	}
+	if w := do(http.MethodPut, "/api/v2/posts/1", jane, `{"title":"still jane's","content":"mine","authorId":1}`); w.Code != http.StatusOK {
+		t.Errorf("PUT by the author: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestPostBatches(t *testing.T) {
+	handler := NewRouter(newTestStore(t), Options{Auth: testAuth})
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tokens := []string{registerAndLogin(t, handler, "jane"), registerAndLogin(t, handler, "john")}
+
+	type result struct {
+		Status int
+		Post   struct{ Id, Version int }
+		Error  struct{ Code string }
+	}
+	bulk := func(token, body string) (results []result, failed int) {
+		t.Helper()
+		w := do(http.MethodPost, "/api/v2/posts:bulk", token, body)
+		var list struct {
+			Data   []result
+			Failed int
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("bulk: status %d: %s", w.Code, w.Body)
+		}
+		return list.Data, list.Failed
+	}
+	statuses := func(results []result) []int {
+		var out []int
+		for _, r := range results {
+			out = append(out, r.Status)
+		}
+		return out
+	}
+	posts := func() int {
+		t.Helper()
+		w := do(http.MethodGet, "/api/v1/posts", "", "")
+		var all []any
+		if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+			t.Fatalf("list posts: status %d: %s", w.Code, w.Body)
+		}
+		return len(all)
+	}
+
+	created, failed := bulk(tokens[0], `{"operations":[
+		{"op":"create","post":{"title":"a","content":"c","authorId":1}},
+		{"op":"create","post":{"title":"b","content":"c","authorId":1}},
+		{"op":"create","post":{"title":"c","content":"c","authorId":1}}]}`)
+	if got := statuses(created); failed != 0 || !reflect.DeepEqual(got, []int{201, 201, 201}) {
+		t.Fatalf("creates: statuses %v, %d failed", got, failed)
+	}
+	if do(http.MethodPost, "/api/v2/posts", tokens[1], `{"title":"d","content":"c","authorId":2}`).Code != http.StatusCreated {
+		t.Fatalf("create the post of john")
+	}
+
+	// In a transaction, one failure leaves everything as it was.
+	results, failed := bulk(tokens[0], `{"operations":[
+		{"op":"update","id":1,"post":{"title":"new","content":"c","authorId":1}},
+		{"op":"create","post":{"title":"e","content":"c","authorId":1}},
+		{"op":"delete","id":4},
+		{"op":"delete","id":2}]}`)
+	if got := statuses(results); failed != 4 || !reflect.DeepEqual(got, []int{424, 424, 401, 424}) {
+		t.Fatalf("failed transaction: statuses %v, %d failed", got, failed)
+	}
+	if results[0].Error.Code != "bulk_aborted" || posts() != 4 {
+		t.Fatalf("failed transaction was applied: %+v, %d posts", results, posts())
+	}
+
+	// Invalid operations fail the transaction before anything is applied.
+	results, _ = bulk(tokens[0], `{"operations":[{"op":"delete","id":2},{"op":"delete"},{"op":"move","id":1}]}`)
+	if got := statuses(results); !reflect.DeepEqual(got, []int{424, 422, 422}) {
+		t.Fatalf("invalid operations: statuses %v", got)
+	}
+
+	// In best effort mode, the other operations are applied.
+	results, failed = bulk(tokens[0], `{"mode":"bestEffort","operations":[
+		{"op":"update","id":1,"version":1,"post":{"title":"new","content":"c","authorId":1}},
+		{"op":"update","id":2,"version":7,"post":{"title":"new","content":"c","authorId":1}},
+		{"op":"create","post":{"title":"e","content":"c","authorId":1}},
+		{"op":"delete","id":4},
+		{"op":"delete","id":3}]}`)
+	if got := statuses(results); failed != 2 || !reflect.DeepEqual(got, []int{200, 412, 201, 401, 204}) {
+		t.Fatalf("best effort: statuses %v, %d failed", got, failed)
+	}
+	if results[0].Post.Version != 2 || posts() != 4 {
+		t.Fatalf("best effort: %+v, %d posts", results, posts())
+	}
+
+	w := do(http.MethodPost, "/api/posts:batchGet", "", `{"ids":[4,3,1,4]}`)
+	var got []result
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("batchGet: status %d: %s", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(statuses(got), []int{200, 404, 200, 200}) || got[0].Post.Id != 4 || got[2].Post.Id != 1 {
+		t.Fatalf("batchGet: %s", w.Body)
+	}
+	if w := do(http.MethodPost, "/api/v2/posts:batchGet", "", `{"ids":[]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("batchGet without ids: status %d", w.Code)
+	}
+}
+
+func TestLoginLimits(t *testing.T) {
+	handler := NewRouter(newTestStore(t), Options{
+		RateLimitStore: ratelimit.NewMemoryStore(),
+		RateLimitAuth:  ratelimit.Limit{Burst: 4, Period: time.Minute},
+		Auth: utils.NewAuth("router-test-secret", time.Hour, ratelimit.NewLockout(cache_repo.NewExpiringCache(),
+			ratelimit.LockoutPolicy{MaxFailures: 2, Duration: time.Minute, MaxDuration: time.Hour}), nil),
+	})
+	login := func(remoteAddr, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/login", strings.NewReader(
+			`{"username":"jane","password":"`+password+`"}`))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/register", strings.NewReader(
+		`{"fullName":"Jane Doe","username":"jane","email":"jane@example.com","password":"secret"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+
+	// The second failure locks jane out at that address, even with the right password.
+	for _, want := range []int{http.StatusNotFound, http.StatusNotFound} {
+		if w := login("203.0.113.1:1234", "wrong"); w.Code != want {
+			t.Fatalf("failed login: status %d, want %d", w.Code, want)
+		}
+	}
+	w = login("203.0.113.1:1234", "secret")
+	var problem struct{ Code string }
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	if w.Code != http.StatusTooManyRequests || problem.Code != "login_locked" || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locked out login: status %d, Retry-After %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+
+	// Failures at one address do not lock jane out at the others.
+	if w := login("203.0.113.2:1234", "secret"); w.Code != http.StatusOK {
+		t.Fatalf("login from another address: status %d: %s", w.Code, w.Body)
+	}
+
+	// The address that sent 4 logins is limited, the other one is not.
+	login("203.0.113.1:1234", "secret")
+	if w := login("203.0.113.1:1234", "secret"); w.Code != http.StatusTooManyRequests || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("fifth login: status %d, RateLimit-Remaining %q", w.Code, w.Header().Get("RateLimit-Remaining"))
+	}
+	if w := login("203.0.113.2:1234", "secret"); w.Header().Get("RateLimit-Remaining") != "2" {
+		t.Fatalf("login from another address: RateLimit-Remaining %q, want 2", w.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+// TestLoginAccountLockout checks that failed logins from many addresses lock the account out everywhere.
+func TestLoginAccountLockout(t *testing.T) {
+	lockouts := cache_repo.NewExpiringCache()
+	handler := NewRouter(newTestStore(t), Options{
+		Auth: utils.NewAuth("router-test-secret", time.Hour,
+			ratelimit.NewLockout(lockouts, ratelimit.LockoutPolicy{MaxFailures: 2, Duration: time.Minute, MaxDuration: time.Hour}),
+			ratelimit.NewLockout(lockouts, ratelimit.LockoutPolicy{MaxFailures: 3, Duration: time.Minute, MaxDuration: time.Hour})),
+	})
+	login := func(remoteAddr, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/login", strings.NewReader(
+			`{"username":"jane","password":"`+password+`"}`))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/register", strings.NewReader(
+		`{"fullName":"Jane Doe","username":"jane","email":"jane@example.com","password":"secret"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+
+	// One failure per address never locks an address out, but the third one locks the account out.
+	for i := 1; i <= 3; i++ {
+		if w := login(fmt.Sprintf("203.0.113.%d:1234", i), "wrong"); w.Code != http.StatusNotFound {
+			t.Fatalf("failed login %d: status %d, want %d", i, w.Code, http.StatusNotFound)
+		}
+	}
+	w = login("203.0.113.4:1234", "secret")
+	var problem struct{ Code string }
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	if w.Code != http.StatusTooManyRequests || problem.Code != "login_locked" {
+		t.Fatalf("login from a new address: status %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestCORSPreflight checks that preflight requests are answered before mux, which would answer 405.
+func TestCORSPreflight(t *testing.T) {
+	handler := NewRouter(nil, Options{Auth: testAuth, CORS: utils.CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+	}})
+
+	r := httptest.NewRequest(http.MethodOptions, "/api/v2/posts/1", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET, PUT" {
+		t.Fatalf("preflight: status %d, headers %v", w.Code, w.Header())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("preflight: X-Content-Type-Options = %q, want nosniff", w.Header().Get("X-Content-Type-Options"))
+	}
+}
@@ -0,0 +1,99 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate from files, and reloads it when they change, so renewed
+// certificates are used without a restart.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// loaded identifies the versions of the files cert was loaded from.
+	loaded [2]fileVersion
+}
+
+// fileVersion tells versions of a file apart.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertReloader loads the certificate and key in PEM files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is the GetCertificate of a tls.Config.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the files again if either changed since they were loaded, and reports whether it did.
+// If they fail to load, e.g. as they are being written, the current certificate is kept.
+func (r *CertReloader) Reload() (bool, error) {
+	versions, err := statFiles(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && versions == r.loaded
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading the TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert, r.loaded = &cert, versions
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the files every interval until ctx is done.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Error("Failed to reload the TLS certificate", "err", err.Error())
+			} else if reloaded {
+				slog.Info("Reloaded the TLS certificate", "certFile", r.certFile)
+			}
+		}
+	}
+}
+
+func statFiles(certFile, keyFile string) ([2]fileVersion, error) {
+	var versions [2]fileVersion
+	for i, name := range []string{certFile, keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return versions, fmt.Errorf("loading the TLS certificate: %w", err)
+		}
+		versions[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return versions, nil
+}
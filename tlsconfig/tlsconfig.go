@@ -0,0 +1,194 @@
+// Package tlsconfig builds the TLS configuration of the servers: from certificate files, which
+// are reloaded when they change, or from an ACME certificate authority such as Let's Encrypt.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// LetsEncrypt is the directory of the production ACME server of Let's Encrypt.
+const LetsEncrypt = acme.LetsEncryptURL
+
+// Options configures TLS. Certificates come from CertFile and KeyFile, or from ACME if ACME.Domains is set.
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is the lowest TLS version accepted, 1.2 or 1.3. It defaults to 1.2.
+	MinVersion string
+	// CipherSuites are the names of the cipher suites of TLS 1.2, such as
+	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, in order of preference. Go picks secure ones when empty.
+	// TLS 1.3 suites are not configurable.
+	CipherSuites []string
+	ACME         ACMEOptions
+}
+
+// ACMEOptions configures certificates obtained from an ACME certificate authority.
+type ACMEOptions struct {
+	// Domains are the host names to get certificates for. ACME is disabled when it is empty.
+	Domains []string
+	Email   string
+	// DirectoryURL is the directory of the ACME server. It defaults to LetsEncrypt.
+	DirectoryURL string
+	// CacheDir keeps the account key and the certificates across restarts.
+	CacheDir string
+	// CARootFile is a PEM file of the root certificates the ACME server is verified with, besides
+	// the system ones, e.g. of a test server like Pebble.
+	CARootFile string
+}
+
+// Enabled reports whether opts configures TLS at all.
+func (opts Options) Enabled() bool {
+	return opts.CertFile != "" || opts.KeyFile != "" || len(opts.ACME.Domains) > 0
+}
+
+// Config is the TLS configuration built by New.
+type Config struct {
+	// TLS configures the servers. Its certificates change as Reloader or ACME renew them.
+	TLS *tls.Config
+	// Reloader reloads the certificate files; it is nil with ACME. Watch it for files to be reloaded.
+	Reloader *CertReloader
+	// ACME is the manager of ACME certificates, or nil. Its HTTPHandler answers the HTTP-01
+	// challenges of the ACME server, which must reach it on port 80.
+	ACME *autocert.Manager
+}
+
+// New builds the TLS configuration described by opts, loading the certificate files right away
+// so mistakes fail the start.
+func New(opts Options) (*Config, error) {
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if len(opts.ACME.Domains) > 0 {
+		if config.ACME, err = newACMEManager(opts.ACME); err != nil {
+			return nil, err
+		}
+		config.TLS = config.ACME.TLSConfig()
+	} else {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("both a certificate and a key file are needed")
+		}
+		if config.Reloader, err = NewCertReloader(opts.CertFile, opts.KeyFile); err != nil {
+			return nil, err
+		}
+		config.TLS = &tls.Config{GetCertificate: config.Reloader.GetCertificate}
+	}
+	config.TLS.MinVersion = minVersion
+	config.TLS.CipherSuites = cipherSuites
+	return config, nil
+}
+
+// versions maps the accepted names of TLS versions to their ids. Older versions are insecure.
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion returns the id of a TLS version, 1.2 or 1.3; "" is 1.2.
+func ParseVersion(name string) (uint16, error) {
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := versions[strings.TrimPrefix(strings.ToLower(name), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", name)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites returns the ids of the named cipher suites, rejecting the ones known to be insecure.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			if slices.ContainsFunc(tls.InsecureCipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name }) {
+				return nil, fmt.Errorf("cipher suite %s is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+func newACMEManager(opts ACMEOptions) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: opts.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = LetsEncrypt
+	}
+	if opts.CARootFile != "" {
+		pem, err := os.ReadFile(opts.CARootFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the ACME CA roots: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.CARootFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Domains...),
+		Email:      opts.Email,
+		Client:     client,
+	}
+	if opts.CacheDir != "" {
+		m.Cache = autocert.DirCache(opts.CacheDir)
+	}
+	return m, nil
+}
+
+// HTTPHandler returns the handler of the plain HTTP listener: it answers the HTTP-01 challenges of
+// the ACME server, if any, and redirects every other request to the same URL on HTTPS, at httpsAddr.
+func (c *Config) HTTPHandler(httpsAddr string) http.Handler {
+	redirect := RedirectHandler(httpsAddr)
+	if c.ACME != nil {
+		return c.ACME.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// RedirectHandler permanently redirects requests to the same URL on HTTPS, at the port of httpsAddr,
+// such as ":8443", or the default port if it is 443.
+func RedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,207 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for commonName and its key to certFile and keyFile.
+func writeCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commonName returns the common name of the certificate r serves.
+func commonName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "old.example.com")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Fatalf("Reload of unchanged files = %v, %v; want nothing done", reloaded, err)
+	}
+
+	// A half-written certificate keeps the current one.
+	os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600)
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("Reload of a broken certificate succeeded")
+	}
+	if name := commonName(t, r); name != "old.example.com" {
+		t.Fatalf("serving %s after a failed reload, want old.example.com", name)
+	}
+
+	writeCert(t, certFile, keyFile, "new.example.com")
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Fatalf("Reload of new files = %v, %v; want reloaded", reloaded, err)
+	}
+	if name := commonName(t, r); name != "new.example.com" {
+		t.Fatalf("serving %s, want new.example.com", name)
+	}
+}
+
+func TestNewServesTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "localhost")
+
+	config, err := New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = config.TLS
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	}}}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("a TLS 1.2 client was served with a minimum version of 1.3")
+	}
+	client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = 0
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("TLS 1.3 client: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("served with version %x, want TLS 1.3", resp.TLS.Version)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := ParseVersion("1.1"); err == nil {
+		t.Error("ParseVersion(1.1) succeeded")
+	}
+	if v, err := ParseVersion("TLS1.3"); v != tls.VersionTLS13 || err != nil {
+		t.Errorf("ParseVersion(TLS1.3) = %x, %v", v, err)
+	}
+
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("ParseCipherSuites = %v, %v", ids, err)
+	}
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_NOPE"} {
+		if _, err := ParseCipherSuites([]string{name}); err == nil {
+			t.Errorf("ParseCipherSuites(%s) succeeded", name)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddr, host, target, want string
+	}{
+		{":443", "example.com", "/posts?page=2", "https://example.com/posts?page=2"},
+		{":443", "example.com:80", "/", "https://example.com/"},
+		{":8443", "example.com:8080", "/posts", "https://example.com:8443/posts"},
+		{":8443", "[::1]:8080", "/", "https://[::1]:8443/"},
+		{":443", "[::1]", "/", "https://[::1]/"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		RedirectHandler(tt.httpsAddr).ServeHTTP(w, r)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s%s to %s: %d %s, want 308 %s", tt.host, tt.target, tt.httpsAddr,
+				w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+// TestACME gets a certificate from a Pebble server, e.g. started with
+//
+//	PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+//
+// and GOBLOG_TEST_ACME_DIRECTORY=https://localhost:14000/dir, GOBLOG_TEST_ACME_CA_ROOT=test/certs/pebble.minica.pem.
+func TestACME(t *testing.T) {
+	directory := os.Getenv("GOBLOG_TEST_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("GOBLOG_TEST_ACME_DIRECTORY is not set")
+	}
+
+	config, err := New(Options{ACME: ACMEOptions{
+		Domains:      []string{"goblog.test"},
+		DirectoryURL: directory,
+		CacheDir:     t.TempDir(),
+		CARootFile:   os.Getenv("GOBLOG_TEST_ACME_CA_ROOT"),
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	cert, err := config.TLS.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        "goblog.test",
+		CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedVersions: []uint16{tls.VersionTLS13},
+	})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.VerifyHostname("goblog.test") != nil || !strings.Contains(leaf.Issuer.CommonName, "Pebble") {
+		t.Fatalf("got a certificate for %v issued by %q", leaf.DNSNames, leaf.Issuer.CommonName)
+	}
+
+	if _, err := config.TLS.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"}); err == nil {
+		t.Error("got a certificate for a domain that is not configured")
+	}
+}
@@ -0,0 +1,101 @@
+// Package tracing sets up OpenTelemetry tracing: where spans are exported, how traces are sampled,
+// and the W3C trace context propagation that lets a trace continue across services.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName names the application in the traces.
+const ServiceName = "goblog"
+
+// Exporters accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Options configures tracing.
+type Options struct {
+	// Exporter is where spans go: nowhere (none), to stdout or to File, one JSON object per span,
+	// or to an OpenTelemetry collector (otlp).
+	Exporter string
+	File     string
+	// Endpoint is the URL the otlp exporter sends spans to over HTTP, such as
+	// http://collector:4318/v1/traces. When empty, the OTEL_EXPORTER_OTLP_* variables apply.
+	Endpoint string
+	// SampleRatio is the share of the traces starting here that are recorded, from 0 to 1.
+	// Traces continued from a caller are recorded if the caller records them.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned
+// function exports the spans still buffered and releases the exporter; call it on shutdown.
+// With the none exporter no span is recorded, but the trace ids of callers still propagate.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio %v is not between 0 and 1", opts.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	release := func() error { return nil }
+	switch opts.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		release = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		var otlpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, otlpOpts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s, %s or %s",
+			opts.Exporter, ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	res, err := resource.New(ctx, resource.WithFromEnv(), resource.WithAttributes(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), release())
+	}, nil
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterFile, File: path, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "GET /api/v2/posts")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, want := range []string{`"Name":"GET /api/v2/posts"`, ServiceName} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("exported spans lack %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestSetupRejectsInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Exporter: "jaeger", SampleRatio: 1},
+		{Exporter: ExporterStdout, SampleRatio: 2},
+	} {
+		if _, err := Setup(context.Background(), opts); err == nil {
+			t.Errorf("Setup(%+v) succeeded", opts)
+		}
+	}
+}
@@ -2,11 +2,18 @@ package utils
 
 import (
 	"encoding/json"
-	"github.com/assaidy/goblog/models"
-	"github.com/gorilla/mux"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/repo"
+	"github.com/gorilla/mux"
 )
 
 // ApiFunc is a custom type that defines a function signature returning an error.
@@ -17,23 +24,38 @@ type ApiFunc func(http.ResponseWriter, *http.Request) error
 func MakeHandlerFunc(f ApiFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := f(w, r); err != nil {
-			// Check if the error is an ApiError
-			if apiErr, ok := err.(ApiError); ok {
-				WriteJSON(w, apiErr.StatusCode, apiErr)
-			} else {
-				// If not, return a generic internal server error response
-				resp := map[string]string{
-					"statusCode": "500",
-					"msg":        "internal server error",
-				}
-				WriteJSON(w, http.StatusInternalServerError, resp)
-			}
+			WriteProblem(w, r, ToApiError(err))
 			// Log the error with additional context
-			slog.Error("HTTP API error", "err", err.Error(), "path", r.URL.Path)
+			Logger(r.Context()).Error("HTTP API error", "err", err.Error(), "path", r.URL.Path)
 		}
 	}
 }
 
+// ToApiError is the single place where errors returned by handlers are translated into API errors.
+// ApiErrors are kept as they are, repo error kinds are mapped to their HTTP status codes,
+// and anything else becomes a generic 500 so internal details never reach the client.
+func ToApiError(err error) ApiError {
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		return NotFound(err)
+	case errors.Is(err, repo.ErrConflict):
+		return Conflict(err)
+	case errors.Is(err, repo.ErrForeignKey):
+		return NewProblem(http.StatusUnprocessableEntity, CodeInvalidReference, err.Error())
+	case errors.Is(err, repo.ErrInvalid):
+		return NewProblem(http.StatusUnprocessableEntity, CodeConstraintViolation, err.Error())
+	case errors.Is(err, repo.ErrVersionMismatch):
+		return PreconditionFailed(err)
+	default:
+		return InternalServerError()
+	}
+}
+
 // WriteJSON sends a JSON response with a given status code.
 func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -48,22 +70,137 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	return nil
 }
 
-// TODO: apply to the code
-// DecodeAndValidateJSON decodes JSON from the request body and validates the request.
-func DecodeAndValidateJSON(r *http.Request, req models.Request) error {
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		r.Body.Close()
-		return InvalidJSON()
+// WriteProblem sends apiErr as an application/problem+json response,
+// filling in the instance (request path), the request id and the trace id.
+func WriteProblem(w http.ResponseWriter, r *http.Request, apiErr ApiError) error {
+	apiErr.Instance = r.URL.Path
+	apiErr.RequestId = RequestIDFromContext(r.Context())
+	apiErr.TraceId = TraceIDFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(apiErr.RetryAfter)))
 	}
+	w.WriteHeader(apiErr.Status)
+
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		Logger(r.Context()).Error("Failed to encode problem response", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// NotFoundHandler renders unknown routes as problem responses.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, CodeRouteNotFound, fmt.Sprintf("no route for %s", r.URL.Path)))
+	})
+}
+
+// MethodNotAllowedHandler renders requests with an unsupported method as problem responses.
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, NewProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+			fmt.Sprintf("method %s is not allowed on %s", r.Method, r.URL.Path)))
+	})
+}
+
+// ReadYourWritesMiddleware gives every request its own repo session, so reads that follow
+// a write within the same request are served from the primary database.
+func ReadYourWritesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(repo.WithSession(r.Context())))
+	})
+}
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// DecodeAndValidateJSON strictly decodes the JSON request body into dst, a pointer to a request struct,
+// and validates it. The body must hold exactly one JSON value without unknown fields.
+// Validation runs the `validate` struct tags (see ValidateStruct) and then, if dst implements
+// models.Request, its Validate method. Failures are returned as ApiErrors.
+func DecodeAndValidateJSON(r *http.Request, dst any) error {
 	defer r.Body.Close()
 
-	if validationErrors := req.Validate(); len(validationErrors) > 0 {
-		return InvalidRequestData(validationErrors)
+	if err := decodeStrict(http.MaxBytesReader(nil, r.Body, maxBodyBytes), dst); err != nil {
+		return err
+	}
+
+	return ValidateRequest(dst)
+}
+
+// ValidateRequest validates dst, a pointer to a request struct, with its `validate` struct tags
+// and then, if it implements models.Request, its Validate method.
+// The failures are returned together as a single ApiError.
+func ValidateRequest(dst any) error {
+	fieldErrors := ValidateStruct(dst)
+	if req, ok := dst.(models.Request); ok {
+		fieldErrors = append(fieldErrors, sortedFieldErrors(req.Validate())...)
+	}
+	if len(fieldErrors) > 0 {
+		return InvalidFields(fieldErrors)
 	}
 
 	return nil
 }
 
+// decodeStrict decodes exactly one JSON value without unknown fields from body into dst.
+func decodeStrict(body io.Reader, dst any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return InvalidJSONError(fmt.Errorf("request body must contain a single JSON value"))
+	}
+
+	return nil
+}
+
+// decodeError turns a json.Decoder error into a client-facing ApiError.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return InvalidJSONError(fmt.Errorf("request body is empty"))
+	case errors.As(err, &syntaxErr):
+		return InvalidJSONError(fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return InvalidJSONError(fmt.Errorf("malformed JSON"))
+	case errors.As(err, &typeErr):
+		return InvalidJSONError(fmt.Errorf("field %q must be of type %s", typeErr.Field, typeErr.Type))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return InvalidJSONError(fmt.Errorf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field ")))
+	case errors.As(err, &maxBytesErr):
+		return NewProblem(http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit))
+	default:
+		return InvalidJSON()
+	}
+}
+
+// sortedFieldErrors converts the errors of models.Request.Validate, ordered by field for stable output.
+func sortedFieldErrors(errs map[string]string) []FieldError {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	fieldErrors := make([]FieldError, 0, len(errs))
+	for _, field := range fields {
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Message: errs[field]})
+	}
+	return fieldErrors
+}
+
 // TODO: apply to the code
 // parseIDFromRequest parses the ID from the request URL.
 func ParseIDFromRequest(r *http.Request) (int, error) {
@@ -3,47 +3,169 @@ package utils
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
-// ApiError represents a structured API error with an HTTP status code and a message
+// Stable, machine-readable error codes. Clients branch on these, so never change an existing value.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidJSON         = "invalid_json"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeRouteNotFound       = "route_not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeIdempotencyInFlight = "idempotency_in_flight"
+	CodeIdempotencyReused   = "idempotency_key_reused"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeInvalidPatch        = "invalid_patch"
+	CodePatchTestFailed     = "patch_test_failed"
+	CodeInvalidReference    = "invalid_reference"
+	CodeConstraintViolation = "constraint_violation"
+	CodeBulkAborted         = "bulk_aborted"
+	CodeRateLimited         = "rate_limited"
+	CodeLoginLocked         = "login_locked"
+	CodeInternal            = "internal_error"
+)
+
+// problemTypeBase prefixes the code to form the problem "type" URI reference.
+const problemTypeBase = "/problems/"
+
+// ApiError represents a structured API error, rendered as an RFC 7807 problem details object
+// with the media type application/problem+json.
 type ApiError struct {
-	StatusCode int `json:"statusCode"`
-	Msg        any `json:"msg"` // Can be a string or a slice of error messages
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Code      string       `json:"code"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestId string       `json:"requestId,omitempty"`
+	TraceId   string       `json:"traceId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// RetryAfter, if set, is sent in a Retry-After header: how long the client should wait before retrying.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldError describes a single invalid input. Field is empty for errors not tied to one field.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
 }
 
 // Error implements the error interface for ApiError
 func (e ApiError) Error() string {
-	return fmt.Sprintf("api error: %d - %v", e.StatusCode, e.Msg)
+	return fmt.Sprintf("api error: %d %s - %s", e.Status, e.Code, e.Detail)
 }
 
-// NewApiError creates a new ApiError with the given status code and error message
-func NewApiError(statusCode int, err error) ApiError {
+// NewProblem creates a new ApiError with the given status code, error code and detail message
+func NewProblem(status int, code, detail string) ApiError {
 	return ApiError{
-		StatusCode: statusCode,
-		Msg:        err.Error(),
+		Type:   problemTypeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// NewApiError creates a new ApiError with the given status code and error message.
+// The error code is derived from the status code.
+func NewApiError(statusCode int, err error) ApiError {
+	return NewProblem(statusCode, codeForStatus(statusCode), err.Error())
+}
+
+// codeForStatus returns the generic error code of an HTTP status.
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	default:
+		return CodeInternal
 	}
 }
 
 // InvalidRequestData returns an ApiError for invalid request data with a 422 status code
 func InvalidRequestData(errors []string) ApiError {
-	return ApiError{
-		StatusCode: http.StatusUnprocessableEntity, // 422
-		Msg:        errors,
+	fieldErrors := make([]FieldError, 0, len(errors))
+	for _, msg := range errors {
+		fieldErrors = append(fieldErrors, FieldError{Message: msg})
 	}
+	return InvalidFields(fieldErrors)
+}
+
+// InvalidFields returns an ApiError listing per-field validation errors with a 422 status code
+func InvalidFields(errors []FieldError) ApiError {
+	apiErr := NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "request data is invalid")
+	apiErr.Errors = errors
+	return apiErr
 }
 
 // InvalidJSON returns an ApiError for invalid JSON request data with a 400 status code
 func InvalidJSON() ApiError {
-	return NewApiError(http.StatusBadRequest, fmt.Errorf("invalid JSON request data"))
+	return NewProblem(http.StatusBadRequest, CodeInvalidJSON, "invalid JSON request data")
+}
+
+// InvalidJSONError returns an ApiError for an unusable JSON request body, explaining why, with a 400 status code
+func InvalidJSONError(err error) ApiError {
+	return NewProblem(http.StatusBadRequest, CodeInvalidJSON, err.Error())
 }
 
 // NotFound returns an ApiError for resource not found with a 404 status code
 func NotFound(err error) ApiError {
-	return NewApiError(http.StatusNotFound, err)
+	return NewProblem(http.StatusNotFound, CodeNotFound, err.Error())
 }
 
 // UnAuthorized returns an ApiError for unauthorized access with a 401 status code
 func UnAuthorized(err error) ApiError {
-	return NewApiError(http.StatusUnauthorized, err)
+	return NewProblem(http.StatusUnauthorized, CodeUnauthorized, err.Error())
 }
 
+// Forbidden returns an ApiError for an authenticated client acting on what it does not own, with a 403 status code
+func Forbidden(err error) ApiError {
+	return NewProblem(http.StatusForbidden, CodeForbidden, err.Error())
+}
+
+// Conflict returns an ApiError for a conflicting resource state with a 409 status code
+func Conflict(err error) ApiError {
+	return NewProblem(http.StatusConflict, CodeConflict, err.Error())
+}
+
+// PreconditionFailed returns an ApiError for a failed If-Match precondition with a 412 status code
+func PreconditionFailed(err error) ApiError {
+	return NewProblem(http.StatusPreconditionFailed, CodePreconditionFailed, err.Error())
+}
+
+// TooManyRequests returns an ApiError telling the client to retry after retryAfter, with a 429 status code
+func TooManyRequests(code, detail string, retryAfter time.Duration) ApiError {
+	apiErr := NewProblem(http.StatusTooManyRequests, code, detail)
+	apiErr.RetryAfter = retryAfter
+	return apiErr
+}
+
+// InternalServerError returns a generic ApiError with a 500 status code, hiding the actual cause
+func InternalServerError() ApiError {
+	return NewProblem(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/assaidy/goblog/repo"
+)
+
+func TestToApiError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{UnAuthorized(errors.New("nope")), http.StatusUnauthorized, CodeUnauthorized},
+		{fmt.Errorf("wrapped: %w", InvalidJSON()), http.StatusBadRequest, CodeInvalidJSON},
+		{repo.NotFoundf("no user with id %d", 1), http.StatusNotFound, CodeNotFound},
+		{repo.NewError(repo.ErrConflict, "username already exists", nil), http.StatusConflict, CodeConflict},
+		{repo.NewError(repo.ErrForeignKey, "bad author", nil), http.StatusUnprocessableEntity, CodeInvalidReference},
+		{repo.NewError(repo.ErrInvalid, "title is required", nil), http.StatusUnprocessableEntity, CodeConstraintViolation},
+		{repo.VersionMismatchf("post 1 is at version 3, not 2"), http.StatusPreconditionFailed, CodePreconditionFailed},
+		{errors.New("pq: connection refused"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		apiErr := ToApiError(tt.err)
+		if apiErr.Status != tt.status || apiErr.Code != tt.code {
+			t.Errorf("ToApiError(%v) = %d %s; want %d %s", tt.err, apiErr.Status, apiErr.Code, tt.status, tt.code)
+		}
+		if apiErr.Type != "/problems/"+tt.code || apiErr.Title != http.StatusText(tt.status) {
+			t.Errorf("ToApiError(%v) has type %q and title %q", tt.err, apiErr.Type, apiErr.Title)
+		}
+	}
+
+	if detail := ToApiError(errors.New("pq: secret details")).Detail; detail != "internal server error" {
+		t.Errorf("internal error detail leaked: %q", detail)
+	}
+}
+
+func TestMakeHandlerFuncWritesProblem(t *testing.T) {
+	handler := RequestIDMiddleware(MakeHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return InvalidRequestData([]string{"title is required"})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q; want application/problem+json", ct)
+	}
+	if id := rec.Header().Get(RequestIDHeader); id != "req-123" {
+		t.Fatalf("%s = %q; want the id sent by the client", RequestIDHeader, id)
+	}
+
+	var problem ApiError
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	if rec.Code != http.StatusUnprocessableEntity || problem.Status != rec.Code || problem.Code != CodeValidationFailed {
+		t.Fatalf("got %d %+v", rec.Code, problem)
+	}
+	if problem.Instance != "/api/posts" || problem.RequestId != "req-123" {
+		t.Fatalf("instance/requestId = %q/%q", problem.Instance, problem.RequestId)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Message != "title is required" {
+		t.Fatalf("errors = %+v", problem.Errors)
+	}
+}
+
+func TestRequestIDMiddlewareGeneratesIds(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\r\nwith newline")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen == "" || seen == req.Header.Get(RequestIDHeader) {
+		t.Fatalf("invalid client id was not replaced, got %q", seen)
+	}
+	if rec.Header().Get(RequestIDHeader) != seen {
+		t.Fatalf("response id %q does not match context id %q", rec.Header().Get(RequestIDHeader), seen)
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the networks of the reverse proxies in front of the server. The requests they
+// forward tell the address of the client, and the scheme it used, in their Forwarded or X-Forwarded-For
+// and X-Forwarded-Proto headers, which anyone else could forge.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses networks in CIDR notation, such as 10.0.0.0/8, or single addresses.
+func ParseTrustedProxies(networks []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			addr, err := netip.ParseAddr(network)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", network, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", network, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// trusts reports whether addr is one of the proxies.
+func (p TrustedProxies) trusts(addr netip.Addr) bool {
+	for _, prefix := range p {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of r. Starting from the peer of the connection, it
+// walks the forwarded addresses from the end for as long as the addresses are trusted proxies,
+// as each proxy appends the address of its own peer; the first address that is not is the client's.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	ip, _ := p.client(r)
+	return ip
+}
+
+// client returns the address of the client of r, as ClientIP does, and the scheme of its request:
+// the one a trusted proxy received it with, or else the one of the connection.
+func (p TrustedProxies) client(r *http.Request) (ip, scheme string) {
+	scheme = "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host, scheme
+	}
+
+	hops := forwardedHops(r.Header)
+	for i := len(hops) - 1; i >= 0 && p.trusts(addr); i-- {
+		if hops[i].proto != "" {
+			scheme = hops[i].proto
+		}
+		hop, err := netip.ParseAddr(hops[i].addr)
+		if err != nil {
+			break
+		}
+		addr = hop
+	}
+	return addr.Unmap().String(), scheme
+}
+
+// forwardedHop is what a proxy tells of the request it forwarded: the address of its peer, and
+// the scheme the request was received with, if known.
+type forwardedHop struct {
+	addr  string
+	proto string
+}
+
+// forwardedHops returns the hops told by the Forwarded headers of h, in order, or else by its
+// X-Forwarded-For headers. Proxies either replace or append to X-Forwarded-Proto, so only its last
+// value, which the nearest proxy set, is trusted: it is the scheme of the last hop.
+func forwardedHops(h http.Header) []forwardedHop {
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		return parseForwarded(values)
+	}
+
+	var hops []forwardedHop
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			hops = append(hops, forwardedHop{addr: strings.TrimSpace(addr)})
+		}
+	}
+	if len(hops) > 0 {
+		protos := strings.Split(strings.Join(h.Values("X-Forwarded-Proto"), ","), ",")
+		hops[len(hops)-1].proto = strings.ToLower(strings.TrimSpace(protos[len(protos)-1]))
+	}
+	return hops
+}
+
+// parseForwarded parses the elements of Forwarded headers (RFC 7239), such as
+// `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"`. Addresses are stripped of their port;
+// obfuscated identifiers, such as "_hidden" or "unknown", are kept and fail to parse as addresses.
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				name, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				v = strings.Trim(v, `"`)
+				switch strings.ToLower(name) {
+				case "for":
+					if host, _, err := net.SplitHostPort(v); err == nil {
+						v = host
+					}
+					hop.addr = strings.Trim(v, "[]")
+				case "proto":
+					hop.proto = strings.ToLower(v)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// client is what ClientIPMiddleware stores in the request context.
+type client struct {
+	ip     string
+	scheme string
+}
+
+type clientKey struct{}
+
+// ClientIPMiddleware stores the address of the client and the scheme of its request, as found
+// by proxies, in the request context.
+func ClientIPMiddleware(proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, scheme := proxies.client(r)
+			ctx := context.WithValue(r.Context(), clientKey{}, client{ip: ip, scheme: scheme})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ContextWithClientIP returns a copy of ctx carrying ip as the address of the client, for servers
+// other than the HTTP one, such as the gRPC server, which know the client from elsewhere.
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{ip: ip})
+}
+
+// clientIP returns the address of the client stored in ctx, or "" if there is none.
+func clientIP(ctx context.Context) string {
+	c, _ := ctx.Value(clientKey{}).(client)
+	return c.ip
+}
+
+// ClientIP returns the address of the client of r, as stored by ClientIPMiddleware, or the peer
+// of the connection outside of it.
+func ClientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.ip
+	}
+	return TrustedProxies(nil).ClientIP(r)
+}
+
+// IsHTTPS reports whether the client sent r over HTTPS, to the server or to a trusted proxy.
+func IsHTTPS(r *http.Request) bool {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.scheme == "https"
+	}
+	return r.TLS != nil
+}
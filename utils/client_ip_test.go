@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		forwarded    []string
+		want         string
+	}{
+		{"direct", "203.0.113.7:4321", nil, nil, "203.0.113.7"},
+		{"forged by a client", "203.0.113.7:4321", []string{"198.51.100.1"}, nil, "203.0.113.7"},
+		{"through a proxy", "10.0.0.2:4321", []string{"198.51.100.1"}, nil, "198.51.100.1"},
+		{"through proxies", "10.0.0.2:4321", []string{"198.51.100.1, 192.0.2.1", "10.1.1.1"}, nil, "198.51.100.1"},
+		{"forged before a proxy", "10.0.0.2:4321", []string{"1.1.1.1, 198.51.100.1"}, nil, "198.51.100.1"},
+		{"only proxies", "10.0.0.2:4321", []string{"10.0.0.3"}, nil, "10.0.0.3"},
+		{"garbage", "10.0.0.2:4321", []string{"nonsense"}, nil, "10.0.0.2"},
+		{"ipv6", "[2001:db8::1]:4321", nil, nil, "2001:db8::1"},
+		{"forwarded", "10.0.0.2:4321", nil, []string{`for=198.51.100.1;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded through proxies", "10.0.0.2:4321", nil, []string{`for=198.51.100.1`, `For="10.1.1.1:80";by=10.0.0.2`}, "198.51.100.1"},
+		{"forwarded obfuscated", "10.0.0.2:4321", nil, []string{`for=_hidden`}, "10.0.0.2"},
+		{"forwarded over x-forwarded-for", "10.0.0.2:4321", []string{"1.1.1.1"}, []string{`for=198.51.100.1`}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			for _, value := range tt.forwarded {
+				r.Header.Add("Forwarded", value)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHTTPS(t *testing.T) {
+	proxies := TrustedProxies{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       bool
+	}{
+		{"direct", "203.0.113.7:4321", nil, false},
+		{"forged by a client", "203.0.113.7:4321", http.Header{"X-Forwarded-Proto": {"https"}}, false},
+		{"x-forwarded-proto", "10.0.0.2:4321", http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}}, true},
+		{"appended to a forged one", "10.0.0.2:4321", http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https, http"}}, false},
+		{"forwarded", "10.0.0.2:4321", http.Header{"Forwarded": {"for=198.51.100.1;proto=https"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header = tt.header
+			var got bool
+			ClientIPMiddleware(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = IsHTTPS(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("IsHTTPS = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	for _, network := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := ParseTrustedProxies([]string{network}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", network)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assaidy/goblog/repo"
+)
+
+// ETag returns the strong entity tag of a user or post at the given version.
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// SetValidators sets the ETag and Last-Modified headers of a response carrying a user or post.
+func SetValidators(w http.ResponseWriter, version int, modified time.Time) {
+	w.Header().Set("ETag", ETag(version))
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CheckNotModified sets the validators of a user or post (see SetValidators) and reports whether
+// the request shows the client already holds this version, through If-None-Match or, when that is
+// absent, If-Modified-Since. If so it writes a 304 Not Modified response and the caller must not
+// write anything else.
+func CheckNotModified(w http.ResponseWriter, r *http.Request, version int, modified time.Time) bool {
+	SetValidators(w, version, modified)
+
+	notModified := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// If-None-Match uses the weak comparison: W/"3" matches "3".
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == ETag(version) {
+				notModified = true
+				break
+			}
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		// Last-Modified has a one second resolution.
+		notModified = !modified.Truncate(time.Second).After(ims)
+	}
+
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return notModified
+}
+
+// IfMatchVersion returns the version the If-Match header of the request requires the resource to be at,
+// to be passed on to the Storer, or repo.AnyVersion when the header is absent or "*".
+// Entity tags that cannot match any version, such as weak ones, yield a 412 ApiError.
+func IfMatchVersion(r *http.Request) (int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return repo.AnyVersion, nil
+	}
+	if strings.Contains(ifMatch, ",") {
+		return 0, NewProblem(http.StatusBadRequest, CodeBadRequest, "If-Match must hold a single entity tag")
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(ifMatch, `"`), `"`))
+	if err != nil || version <= 0 || ifMatch != ETag(version) {
+		return 0, PreconditionFailed(fmt.Errorf("entity tag %s does not match", ifMatch))
+	}
+	return version, nil
+}
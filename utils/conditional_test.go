@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/repo"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no conditions", nil, false},
+		{"matching tag", map[string]string{"If-None-Match": `"3"`}, true},
+		{"weak matching tag", map[string]string{"If-None-Match": `W/"3"`}, true},
+		{"tag in list", map[string]string{"If-None-Match": `"1", "3"`}, true},
+		{"star", map[string]string{"If-None-Match": `*`}, true},
+		{"other tag", map[string]string{"If-None-Match": `"2"`}, false},
+		{"not modified since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"modified since", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"tag takes precedence", map[string]string{"If-None-Match": `"2"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			if got := CheckNotModified(w, r, 3, modified); got != tt.want {
+				t.Fatalf("CheckNotModified = %v; want %v", got, tt.want)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Fatalf("status = %d; want 304", w.Code)
+			}
+			if w.Header().Get("ETag") != `"3"` || w.Header().Get("Last-Modified") != "Wed, 01 May 2024 12:00:00 GMT" {
+				t.Fatalf("validators = %q, %q", w.Header().Get("ETag"), w.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		want    int
+		status  int
+	}{
+		{"", repo.AnyVersion, 0},
+		{"*", repo.AnyVersion, 0},
+		{`"7"`, 7, 0},
+		{`W/"7"`, 0, http.StatusPreconditionFailed},
+		{`"abc"`, 0, http.StatusPreconditionFailed},
+		{`7`, 0, http.StatusPreconditionFailed},
+		{`"0"`, 0, http.StatusPreconditionFailed},
+		{`"1", "2"`, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/", nil)
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		got, err := IfMatchVersion(r)
+		if tt.status != 0 {
+			var apiErr ApiError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Errorf("IfMatchVersion(%s) error = %v; want status %d", tt.ifMatch, err, tt.status)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("IfMatchVersion(%s) = %d, %v; want %d", tt.ifMatch, got, err, tt.want)
+		}
+	}
+}
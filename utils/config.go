@@ -1,63 +1,556 @@
 package utils
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
+	"github.com/assaidy/goblog/ratelimit"
+	"github.com/assaidy/goblog/tlsconfig"
+	"github.com/assaidy/goblog/tracing"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-// Config holds the configuration values for the application
+// Config holds the configuration values for the application.
+// Each value is named by its env tag in the environment, by the same name in lower case in config
+// files, where db_driver can also be written as driver in a db table, and by a flag such as -db-driver.
+// Lists are separated by their sep tag, "," by default, and secret values are redacted when printed.
 type Config struct {
-	Port               string
-	DBHost             string
-	DBPort             int
-	DBUser             string
-	DBPassword         string
-	DBName             string
-	JWTSecret          string
-	JWTExpirationHours int
-}
-
-// LoadConfig loads environment variables into a Config struct
-// It returns an error if loading the .env file fails
-func LoadConfig() (*Config, error) {
+	Environment        string        `env:"ENVIRONMENT"`
+	Port               string        `env:"PORT"`
+	GRPCPort           string        `env:"GRPC_PORT"`
+	HTTPRedirectPort   string        `env:"HTTP_REDIRECT_PORT"`
+	TLSCertFile        string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile         string        `env:"TLS_KEY_FILE"`
+	TLSMinVersion      string        `env:"TLS_MIN_VERSION"`
+	TLSCipherSuites    []string      `env:"TLS_CIPHER_SUITES"`
+	TLSReloadInterval  time.Duration `env:"TLS_RELOAD_INTERVAL"`
+	ACMEDomains        []string      `env:"ACME_DOMAINS"`
+	ACMEEmail          string        `env:"ACME_EMAIL"`
+	ACMEDirectory      string        `env:"ACME_DIRECTORY_URL"`
+	ACMECacheDir       string        `env:"ACME_CACHE_DIR"`
+	ACMECARoot         string        `env:"ACME_CA_ROOT"`
+	ReadTimeout        time.Duration `env:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout  time.Duration `env:"HTTP_READ_HEADER_TIMEOUT"`
+	WriteTimeout       time.Duration `env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout        time.Duration `env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	ShutdownDelay      time.Duration `env:"SHUTDOWN_DELAY"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+	LogFormat          string        `env:"LOG_FORMAT"`
+	LogLevel           string        `env:"LOG_LEVEL"`
+	TraceExporter      string        `env:"TRACE_EXPORTER"`
+	TraceFile          string        `env:"TRACE_FILE"`
+	TraceEndpoint      string        `env:"TRACE_OTLP_ENDPOINT"`
+	TraceSampleRatio   float64       `env:"TRACE_SAMPLE_RATIO"`
+	DBDriver           string        `env:"DB_DRIVER"`
+	DBHost             string        `env:"DB_HOST"`
+	DBPort             int           `env:"DB_PORT"`
+	DBUser             string        `env:"DB_USER"`
+	DBPassword         string        `env:"DB_PASSWORD" secret:"true"`
+	DBName             string        `env:"DB_NAME"`
+	DBPath             string        `env:"DB_PATH"`
+	DBMaxOpenConns     int           `env:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns     int           `env:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime  time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+	DBReplicaDSNs      []string      `env:"DB_REPLICA_DSNS" sep:";" secret:"true"`
+	DBReplicaCheck     time.Duration `env:"DB_REPLICA_CHECK_INTERVAL"`
+	JWTSecret          string        `env:"JWT_SECRET" secret:"true"`
+	JWTExpirationHours int           `env:"JWT_EXPIRATION_HOURS"`
+	CacheBackend       string        `env:"CACHE_BACKEND"`
+	CacheTTL           time.Duration `env:"CACHE_TTL"`
+	CacheSize          int           `env:"CACHE_SIZE"`
+	RedisAddr          string        `env:"REDIS_ADDR"`
+	RedisPassword      string        `env:"REDIS_PASSWORD" secret:"true"`
+	RedisDB            int           `env:"REDIS_DB"`
+	IdempotencyBackend string        `env:"IDEMPOTENCY_BACKEND"`
+	IdempotencyTTL     time.Duration `env:"IDEMPOTENCY_TTL"`
+	GraphQLMaxDepth    int           `env:"GRAPHQL_MAX_DEPTH"`
+	GraphQLMaxCost     int           `env:"GRAPHQL_MAX_COMPLEXITY"`
+	RateLimitBackend   string        `env:"RATE_LIMIT_BACKEND"`
+	RateLimitAPI       string        `env:"RATE_LIMIT_API"`
+	RateLimitAuth      string        `env:"RATE_LIMIT_AUTH"`
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES"`
+	AccountMaxFailures int           `env:"LOGIN_MAX_ACCOUNT_FAILURES"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT"`
+	LoginMaxLockout    time.Duration `env:"LOGIN_MAX_LOCKOUT"`
+	TrustedProxies     []string      `env:"TRUSTED_PROXIES"`
+	CORSOrigins        []string      `env:"CORS_ALLOWED_ORIGINS"`
+	CORSMethods        []string      `env:"CORS_ALLOWED_METHODS"`
+	CORSHeaders        []string      `env:"CORS_ALLOWED_HEADERS"`
+	CORSCredentials    bool          `env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge         time.Duration `env:"CORS_MAX_AGE"`
+	HSTSMaxAge         time.Duration `env:"HSTS_MAX_AGE"`
+	HSTSSubdomains     bool          `env:"HSTS_INCLUDE_SUBDOMAINS"`
+	FrameOptions       string        `env:"FRAME_OPTIONS"`
+	ContentSecPolicy   string        `env:"CONTENT_SECURITY_POLICY"`
+
+	// sources tells where the values that are not defaults come from, by env name.
+	sources map[string]string
+}
+
+// Environments accepted by Config.Environment. Production refuses insecure settings.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Off is the value of FRAME_OPTIONS and CONTENT_SECURITY_POLICY that disables the header, as an
+// empty value in the environment keeps the default instead.
+const Off = "off"
+
+// Default values refused in production.
+const (
+	defaultJWTSecret  = "mysecret"
+	defaultDBPassword = "goblog"
+	// minJWTSecretLength is the length of the shortest JWT secret accepted in production, the
+	// size of the SHA-256 hashes the tokens are signed with.
+	minJWTSecretLength = 32
+)
+
+// corsHeaders are the request headers of the API that browser clients of other origins may send by default.
+var corsHeaders = []string{
+	"Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Modified-Since",
+	IdempotencyKeyHeader, RequestIDHeader,
+}
+
+// defaultConfig returns the configuration used where nothing else is set.
+func defaultConfig() *Config {
+	return &Config{
+		Environment:        EnvDevelopment,
+		Port:               "8080",
+		GRPCPort:           "9090",
+		TLSMinVersion:      "1.2",
+		TLSReloadInterval:  10 * time.Second,
+		ACMECacheDir:       "acme-cache",
+		ReadTimeout:        15 * time.Second,
+		ReadHeaderTimeout:  5 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        2 * time.Minute,
+		ShutdownTimeout:    30 * time.Second,
+		ShutdownDelay:      5 * time.Second,
+		HealthCheckTimeout: 2 * time.Second,
+		LogFormat:          LogFormatText,
+		LogLevel:           "info",
+		TraceExporter:      "none",
+		TraceFile:          "traces.json",
+		TraceSampleRatio:   1,
+		DBDriver:           "postgres",
+		DBHost:             "localhost",
+		DBPort:             5432,
+		DBUser:             "postgres",
+		DBPassword:         defaultDBPassword,
+		DBName:             "goblog",
+		DBPath:             "goblog.db",
+		DBMaxOpenConns:     25,
+		DBMaxIdleConns:     25,
+		DBConnMaxLifetime:  30 * time.Minute,
+		DBReplicaCheck:     5 * time.Second,
+		JWTSecret:          defaultJWTSecret,
+		JWTExpirationHours: 72,
+		CacheBackend:       "none",
+		CacheTTL:           time.Minute,
+		CacheSize:          10000,
+		RedisAddr:          "localhost:6379",
+		IdempotencyBackend: "memory",
+		IdempotencyTTL:     24 * time.Hour,
+		GraphQLMaxDepth:    10,
+		GraphQLMaxCost:     1000,
+		RateLimitBackend:   "memory",
+		RateLimitAPI:       "300/1m",
+		RateLimitAuth:      "10/1m",
+		LoginMaxFailures:   5,
+		AccountMaxFailures: 50,
+		LoginLockout:       time.Minute,
+		LoginMaxLockout:    time.Hour,
+		CORSMethods:        []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		CORSHeaders:        corsHeaders,
+		CORSMaxAge:         10 * time.Minute,
+		HSTSMaxAge:         180 * 24 * time.Hour,
+		FrameOptions:       "DENY",
+		ContentSecPolicy:   DefaultContentSecurityPolicy,
+	}
+}
+
+// LoadConfig loads the configuration, once at startup. Each value is taken from the first of:
+//   - the flags in args, such as -db-driver sqlite;
+//   - the environment, where a .env file in the working directory adds the variables not already set;
+//   - the YAML or TOML config file named by the -config flag or the CONFIG_FILE variable, if any;
+//   - defaultConfig.
+//
+// Malformed values and unknown names in the config file are errors; empty values in the environment
+// are ignored, so variables left empty in a .env file keep the values of the layers below. The values
+// are not validated: see Validate.
+func LoadConfig(args []string) (*Config, error) {
 	// Load .env file if it exists, ignore if it doesn't
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using default values or environment variables.")
+	godotenv.Load()
+
+	config := defaultConfig()
+	config.sources = map[string]string{}
+	fields := configFields()
+
+	flags := flag.NewFlagSet("goblog", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML `file` to load the configuration from")
+	flagValues := map[string]string{}
+	defaults := reflect.ValueOf(config).Elem()
+	for _, f := range fields {
+		usage := fmt.Sprintf("%s, default %s", f.env, f.format(defaults.Field(f.index)))
+		flags.Func(f.flagName(), usage, func(value string) error {
+			flagValues[f.env] = value
+			return nil
+		})
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: goblog [config print] [flags]\n\nFlags override the environment, which overrides the config file.\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
 	}
 
-	config := &Config{
-		Port:               ":" + getEnv("PORT", "8080"),
-		DBHost:             getEnv("DB_HOST", "localhost"),
-		DBPort:             getEnvAsInt("DB_PORT", 5432),
-		DBUser:             getEnv("DB_USER", "postgres"),
-		DBPassword:         getEnv("DB_PASSWORD", "goblog"),
-		DBName:             getEnv("DB_NAME", "goblog"),
-		JWTSecret:          getEnv("JWT_SECRET", "mysecret"),
-		JWTExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 72),
+	if *configFile != "" {
+		values, err := readConfigFile(*configFile, fields)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.set(fields, values, "file "+*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	envValues := map[string]string{}
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			envValues[f.env] = value
+		}
+	}
+	if err := config.set(fields, envValues, "env"); err != nil {
+		return nil, err
 	}
 
+	if err := config.set(fields, flagValues, "flag"); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
-// getEnv retrieves the value of the environment variable named by the key.
-// If the variable is not present, it returns the defaultValue.
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// configField describes a field of Config by its tags.
+type configField struct {
+	index  int
+	env    string
+	sep    string
+	secret bool
+}
+
+// configFields returns the fields of Config, in order.
+func configFields() []configField {
+	t := reflect.TypeOf(Config{})
+	var fields []configField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		env := field.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		sep := field.Tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+		fields = append(fields, configField{index: i, env: env, sep: sep, secret: field.Tag.Get("secret") == "true"})
+	}
+	return fields
+}
+
+// flagName returns the name of the flag setting the field, like db-driver for DB_DRIVER.
+func (f configField) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(f.env), "_", "-")
+}
+
+// set parses the values, by env name, into the fields of c, and records that they come from source.
+func (c *Config) set(fields []configField, values map[string]string, source string) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range fields {
+		value, ok := values[f.env]
+		if !ok {
+			continue
+		}
+		if err := f.parse(v.Field(f.index), value); err != nil {
+			return fmt.Errorf("invalid %s %q from %s: %w", f.env, value, source, err)
+		}
+		c.sources[f.env] = source
 	}
-	return defaultValue
+	return nil
 }
 
-// getEnvAsInt retrieves the value of the environment variable named by the key as an integer.
-// If the variable is not present or cannot be converted to an integer, it returns the defaultValue.
-func getEnvAsInt(key string, defaultValue int) int {
-	if valueStr, exists := os.LookupEnv(key); exists {
-		if value, err := strconv.Atoi(valueStr); err == nil {
-			return value
+// parse sets field, of the type of f, to value.
+func (f configField) parse(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 30s")
 		}
+		field.SetInt(int64(d))
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		field.SetInt(int64(n))
+	case float64:
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		field.SetFloat(x)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+	case string:
+		field.SetString(value)
+	case []string:
+		// Empty items are dropped, so an empty value yields an empty list.
+		var items []string
+		for _, item := range strings.Split(value, f.sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// readConfigFile reads the values of a YAML or TOML file, told apart by its extension, by env name.
+func readConfigFile(name string, fields []configField) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading the config file: %w", err)
+	}
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s is neither .yaml, .yml nor .toml", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+
+	byEnv := map[string]configField{}
+	for _, f := range fields {
+		byEnv[f.env] = f
+	}
+	values := map[string]string{}
+	var flatten func(prefix string, doc map[string]any) error
+	flatten = func(prefix string, doc map[string]any) error {
+		for key, value := range doc {
+			key = prefix + strings.ReplaceAll(key, "-", "_")
+			if table, ok := value.(map[string]any); ok {
+				if err := flatten(key+"_", table); err != nil {
+					return err
+				}
+				continue
+			}
+			f, ok := byEnv[strings.ToUpper(key)]
+			if !ok {
+				return fmt.Errorf("%s: unknown setting %s", name, key)
+			}
+			s, err := fileValue(value, f.sep)
+			if err != nil {
+				return fmt.Errorf("%s: invalid %s: %w", name, key, err)
+			}
+			values[f.env] = s
+		}
+		return nil
+	}
+	if err := flatten("", doc); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// fileValue returns a value of a config file as it would be written in the environment,
+// joining the items of lists with sep.
+func fileValue(value any, sep string) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			s, err := fileValue(item, sep)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(s, sep) {
+				return "", fmt.Errorf("list item %q contains the separator %q", s, sep)
+			}
+			items[i] = s
+		}
+		return strings.Join(items, sep), nil
+	case map[string]any:
+		return "", fmt.Errorf("expected a value, got a table")
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// Print writes the configuration to w as YAML, which LoadConfig accepts, one value per line commented
+// with where it comes from. Secret values are redacted.
+func (c *Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range configFields() {
+		source := c.sources[f.env]
+		if source == "" {
+			source = "default"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s # %s\n", strings.ToLower(f.env), f.format(v.Field(f.index)), source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// format returns the value of field, of the type of f, as YAML, or "[redacted]" if it is a secret.
+func (f configField) format(field reflect.Value) string {
+	if f.secret && !field.IsZero() {
+		return `"[redacted]"`
+	}
+	switch value := field.Interface().(type) {
+	case string:
+		return strconv.Quote(value)
+	case time.Duration:
+		return strconv.Quote(value.String())
+	case []string:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Validate reports every invalid value of the configuration, and in production, the insecure ones.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(name, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			errs = append(errs, fmt.Errorf("%s is %q, expected one of %s", name, value, strings.Join(allowed, ", ")))
+		}
+	}
+	port := func(name, value string) {
+		n, err := strconv.Atoi(value)
+		check(err == nil && n >= 0 && n <= 65535, "%s is %q, expected a port number", name, value)
+	}
+
+	oneOf("ENVIRONMENT", c.Environment, EnvDevelopment, EnvProduction)
+	port("PORT", c.Port)
+	port("GRPC_PORT", c.GRPCPort)
+	if c.HTTPRedirectPort != "" {
+		port("HTTP_REDIRECT_PORT", c.HTTPRedirectPort)
+		check(c.TLSCertFile != "" || len(c.ACMEDomains) > 0, "HTTP_REDIRECT_PORT is set without TLS")
+	}
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	if _, err := tlsconfig.ParseVersion(c.TLSMinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_MIN_VERSION: %w", err))
+	}
+	if _, err := tlsconfig.ParseCipherSuites(c.TLSCipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_CIPHER_SUITES: %w", err))
+	}
+
+	if _, err := NewLogger(io.Discard, c.LogFormat, c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	oneOf("TRACE_EXPORTER", c.TraceExporter, tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile, tracing.ExporterOTLP)
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "TRACE_SAMPLE_RATIO is %v, expected 0 to 1", c.TraceSampleRatio)
+
+	oneOf("DB_DRIVER", c.DBDriver, "postgres", "sqlite")
+	oneOf("CACHE_BACKEND", c.CacheBackend, "none", "memory", "redis")
+	oneOf("IDEMPOTENCY_BACKEND", c.IdempotencyBackend, "memory", "redis")
+	oneOf("RATE_LIMIT_BACKEND", c.RateLimitBackend, "none", "memory", "redis")
+
+	check(c.JWTSecret != "", "JWT_SECRET is empty")
+	check(c.JWTExpirationHours > 0, "JWT_EXPIRATION_HOURS is %d, expected at least 1", c.JWTExpirationHours)
+	if _, err := ratelimit.ParseLimit(c.RateLimitAPI); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_API: %w", err))
+	}
+	if _, err := ratelimit.ParseLimit(c.RateLimitAuth); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_AUTH: %w", err))
+	}
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+	check(slices.ContainsFunc([]string{"DENY", "SAMEORIGIN", Off}, func(v string) bool { return strings.EqualFold(v, c.FrameOptions) }),
+		"FRAME_OPTIONS is %q, expected DENY, SAMEORIGIN or %s", c.FrameOptions, Off)
+
+	if c.Environment == EnvProduction {
+		for _, problem := range c.InsecureSettings() {
+			errs = append(errs, fmt.Errorf("%s, which production refuses", problem))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SecurityHeaders returns the security headers of the configuration, without those set to Off.
+func (c *Config) SecurityHeaders() SecurityHeaders {
+	headers := SecurityHeaders{
+		HSTSMaxAge:            c.HSTSMaxAge,
+		HSTSIncludeSubdomains: c.HSTSSubdomains,
+		FrameOptions:          c.FrameOptions,
+		ContentSecurityPolicy: c.ContentSecPolicy,
+	}
+	if strings.EqualFold(headers.FrameOptions, Off) {
+		headers.FrameOptions = ""
+	}
+	if strings.EqualFold(headers.ContentSecurityPolicy, Off) {
+		headers.ContentSecurityPolicy = ""
+	}
+	return headers
+}
+
+// InsecureSettings describes the settings that production refuses, which development only warns about.
+func (c *Config) InsecureSettings() []string {
+	var problems []string
+	if c.JWTSecret == defaultJWTSecret {
+		problems = append(problems, "JWT_SECRET is the default one")
+	} else if len(c.JWTSecret) < minJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("JWT_SECRET is shorter than %d bytes", minJWTSecretLength))
+	}
+	if c.DBDriver == "postgres" && c.DBPassword == defaultDBPassword {
+		problems = append(problems, "DB_PASSWORD is the default one")
+	}
+	if c.CORSCredentials && slices.Contains(c.CORSOrigins, "*") {
+		problems = append(problems, "CORS_ALLOW_CREDENTIALS lets any origin of CORS_ALLOWED_ORIGINS send credentials")
 	}
-	return defaultValue
+	return problems
 }
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// writeConfigFile writes a config file named name in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfigFile(t, "goblog.yaml", `
+db_driver: sqlite
+log_level: debug
+graphql_max_depth: 3
+cors_allowed_origins: [https://a.example.com, https://b.example.com]
+cache:
+  backend: memory
+  ttl: 5m
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("GRAPHQL_MAX_DEPTH", "4")
+	t.Setenv("CACHE_SIZE", "")
+
+	config, err := LoadConfig([]string{"-config", file, "-graphql-max-depth", "5"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config.DBPort != 5432 || config.JWTExpirationHours != 72 || config.CacheSize != 10000 {
+		t.Errorf("defaults: DBPort %d, JWTExpirationHours %d, CacheSize %d", config.DBPort, config.JWTExpirationHours, config.CacheSize)
+	}
+	if config.DBDriver != "sqlite" || config.CacheBackend != "memory" || config.CacheTTL != 5*time.Minute {
+		t.Errorf("file: DBDriver %q, CacheBackend %q, CacheTTL %v", config.DBDriver, config.CacheBackend, config.CacheTTL)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(config.CORSOrigins, want) {
+		t.Errorf("file: CORSOrigins %q, want %q", config.CORSOrigins, want)
+	}
+	if config.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q, want warn from the environment", config.LogLevel)
+	}
+	if config.GraphQLMaxDepth != 5 {
+		t.Errorf("GraphQLMaxDepth = %d, want 5 from the flag", config.GraphQLMaxDepth)
+	}
+}
+
+// TestTemplateKeepsDefaults checks that a .env file copied from .env_template, with every variable
+// empty, loads the defaults.
+func TestTemplateKeepsDefaults(t *testing.T) {
+	values, err := godotenv.Read("../.env_template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range values {
+		t.Setenv(key, value)
+	}
+
+	config, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	config.sources = nil
+	want := defaultConfig()
+	want.sources = nil
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("template loaded as %+v, want the defaults %+v", config, want)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestSecurityHeadersOff(t *testing.T) {
+	t.Setenv("FRAME_OPTIONS", "off")
+	t.Setenv("CONTENT_SECURITY_POLICY", "OFF")
+	config, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	headers := config.SecurityHeaders()
+	if headers.FrameOptions != "" || headers.ContentSecurityPolicy != "" || headers.HSTSMaxAge != 180*24*time.Hour {
+		t.Errorf("SecurityHeaders = %+v, want the frame options and policy disabled", headers)
+	}
+	if headers := defaultConfig().SecurityHeaders(); headers.FrameOptions != "DENY" || headers.ContentSecurityPolicy != DefaultContentSecurityPolicy {
+		t.Errorf("default SecurityHeaders = %+v", headers)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	file := writeConfigFile(t, "goblog.toml", `
+environment = "production"
+trace_sample_ratio = 0.25
+
+[db]
+driver = "sqlite"
+replica_dsns = ["host=replica1 dbname=goblog", "host=replica2 dbname=goblog"]
+`)
+	config, err := LoadConfig([]string{"-config", file})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config.Environment != EnvProduction || config.TraceSampleRatio != 0.25 || config.DBDriver != "sqlite" {
+		t.Errorf("Environment %q, TraceSampleRatio %v, DBDriver %q", config.Environment, config.TraceSampleRatio, config.DBDriver)
+	}
+	if want := []string{"host=replica1 dbname=goblog", "host=replica2 dbname=goblog"}; !reflect.DeepEqual(config.DBReplicaDSNs, want) {
+		t.Errorf("DBReplicaDSNs = %q, want %q", config.DBReplicaDSNs, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown setting", file: "db_drvier: sqlite", want: "unknown setting db_drvier"},
+		{name: "unknown table setting", file: "db:\n  drvier: sqlite", want: "unknown setting db_drvier"},
+		{name: "malformed file value", file: "db_port: five", want: "invalid DB_PORT"},
+		{name: "malformed env int", env: map[string]string{"DB_PORT": "54x2"}, want: `invalid DB_PORT "54x2" from env`},
+		{name: "malformed env bool", env: map[string]string{"CORS_ALLOW_CREDENTIALS": "yes"}, want: "invalid CORS_ALLOW_CREDENTIALS"},
+		{name: "malformed flag", args: []string{"-cache-ttl", "5"}, want: `invalid CACHE_TTL "5" from flag`},
+		{name: "unknown flag", args: []string{"-db-drvier", "sqlite"}, want: "db-drvier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, "goblog.yml", tt.file)}, args...)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := defaultConfig().Validate(); err != nil {
+		t.Errorf("default configuration: %v", err)
+	}
+
+	config := defaultConfig()
+	config.Environment = EnvProduction
+	err := config.Validate()
+	for _, want := range []string{"JWT_SECRET is the default one", "DB_PASSWORD is the default one"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("production with defaults: %v, want %q", err, want)
+		}
+	}
+	config.JWTSecret = "short"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "shorter than 32 bytes") {
+		t.Errorf("production with a short secret: %v", err)
+	}
+	config.JWTSecret = strings.Repeat("s", 32)
+	config.DBDriver = "sqlite"
+	if err := config.Validate(); err != nil {
+		t.Errorf("production with a long secret: %v", err)
+	}
+
+	for _, frameOptions := range []string{"DENY", "sameorigin", "Off"} {
+		config := defaultConfig()
+		config.FrameOptions = frameOptions
+		if err := config.Validate(); err != nil {
+			t.Errorf("FRAME_OPTIONS %q: %v", frameOptions, err)
+		}
+	}
+
+	config = defaultConfig()
+	config.DBDriver = "mysql"
+	config.Port = "http"
+	config.TraceSampleRatio = 2
+	config.TLSCertFile = "cert.pem"
+	config.RateLimitAPI = "300"
+	config.FrameOptions = "SAMEORGIN"
+	err = config.Validate()
+	for _, want := range []string{"DB_DRIVER", "PORT", "TRACE_SAMPLE_RATIO", "TLS_KEY_FILE", "RATE_LIMIT_API", "FRAME_OPTIONS"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate = %v, want an error about %s", err, want)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	t.Setenv("JWT_SECRET", "a secret never to be printed")
+	t.Setenv("LOG_LEVEL", "debug")
+	config, err := LoadConfig([]string{"-redis-password", "another secret", "-cors-allowed-origins", "https://a.example.com"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	var b strings.Builder
+	if err := config.Print(&b); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	out := b.String()
+	if strings.Contains(out, "never to be printed") || strings.Contains(out, "another secret") {
+		t.Errorf("secrets printed:\n%s", out)
+	}
+	for _, want := range []string{
+		`jwt_secret: "[redacted]" # env`,
+		`redis_password: "[redacted]" # flag`,
+		`log_level: "debug" # env`,
+		`db_port: 5432 # default`,
+		`cache_ttl: "1m0s" # default`,
+		`cors_allowed_origins: ["https://a.example.com"] # flag`,
+		`db_replica_dsns: [] # default`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+
+	// The output is a config file.
+	file := writeConfigFile(t, "printed.yaml", out)
+	printed, err := LoadConfig([]string{"-config", file})
+	if err != nil {
+		t.Fatalf("loading the printed configuration: %v", err)
+	}
+	if printed.LogLevel != "debug" || printed.CacheTTL != time.Minute || !reflect.DeepEqual(printed.CORSOrigins, config.CORSOrigins) {
+		t.Errorf("printed configuration loaded as %+v", printed)
+	}
+}
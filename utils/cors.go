@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions tells which browser clients of other origins may call the API, and how.
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed, such as https://app.example.com, or "*" for any.
+	// CORS is disabled when it is empty.
+	AllowedOrigins []string
+	// AllowedMethods are the methods preflight requests may ask for.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers preflight requests may ask for, or "*" for any.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read, besides the CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets requests carry cookies and Authorization headers.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answers to preflight requests.
+	MaxAge time.Duration
+}
+
+// CORSMiddleware answers preflight requests from the allowed origins, and lets their scripts read the
+// responses to the others. Requests from other origins are served without CORS headers, so browsers
+// hide the responses from their scripts. It must wrap the mux router, which would answer preflight
+// requests with 405s.
+func CORSMiddleware(opts CORSOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(opts.AllowedOrigins) == 0 {
+			return next
+		}
+		anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+		anyHeader := slices.Contains(opts.AllowedHeaders, "*")
+		methods := strings.Join(opts.AllowedMethods, ", ")
+		headers := strings.Join(opts.AllowedHeaders, ", ")
+		exposed := strings.Join(opts.ExposedHeaders, ", ")
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" || !(anyOrigin || slices.Contains(opts.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Credentials are only sent to origins named in the response.
+			if anyOrigin && !opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Methods", methods)
+			allowedHeaders := headers
+			if anyHeader {
+				allowedHeaders = r.Header.Get("Access-Control-Request-Headers")
+			}
+			if allowedHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	var served bool
+	handler := CORSMiddleware(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = true }))
+	do := func(method, origin string, header http.Header) *httptest.ResponseRecorder {
+		served = false
+		r := httptest.NewRequest(method, "/api/v2/posts", nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	preflight := http.Header{"Access-Control-Request-Method": {"POST"}}
+
+	w := do(http.MethodOptions, "https://app.example.com", preflight)
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+		"Access-Control-Max-Age":           "600",
+	}
+	if w.Code != http.StatusNoContent || served {
+		t.Fatalf("preflight: status %d, served %v; want 204 without reaching the handler", w.Code, served)
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("preflight: %s = %q, want %q", name, got, value)
+		}
+	}
+
+	w = do(http.MethodGet, "https://app.example.com", nil)
+	if !served || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("request: served %v, headers %v", served, w.Header())
+	}
+
+	// Other origins, and requests of the same origin, get no CORS headers.
+	for _, origin := range []string{"https://evil.example.com", ""} {
+		w = do(http.MethodGet, origin, nil)
+		if !served || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("origin %q: served %v, headers %v", origin, served, w.Header())
+		}
+		if w.Header().Get("Vary") != "Origin" {
+			t.Errorf("origin %q: Vary = %q, want Origin", origin, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCORSMiddlewareAnyOrigin(t *testing.T) {
+	handler := CORSMiddleware(CORSOptions{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodOptions, "/api/v2/posts", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "if-match, x-custom")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "if-match, x-custom" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want the requested headers", got)
+	}
+}
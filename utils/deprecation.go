@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeprecationMiddleware marks responses of a deprecated API version with a Deprecation header (RFC 9745)
+// holding the date of deprecation, a Sunset header (RFC 8594) holding the date after which the version
+// may stop working, and a Link to the successor version. A zero sunset omits the Sunset header.
+func DeprecationMiddleware(deprecatedAt, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	var sunsetValue string
+	if !sunset.IsZero() {
+		sunsetValue = sunset.UTC().Format(http.TimeFormat)
+	}
+	link := "<" + successor + `>; rel="successor-version"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			if sunsetValue != "" {
+				w.Header().Set("Sunset", sunsetValue)
+			}
+			w.Header().Add("Link", link)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
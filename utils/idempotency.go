@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a POST safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyLockTTL bounds how long a request that never completes (e.g. the server died)
+// keeps its key locked.
+const idempotencyLockTTL = time.Minute
+
+// IdempotencyStore holds the responses of idempotent requests. cache_repo.ExpiringCache implements it
+// for a single instance and cache_repo.RedisCache for instances sharing a Redis server. The store must
+// not evict entries before their TTL, or requests in flight or already answered would run again.
+type IdempotencyStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	// Add stores value only if key holds no entry yet, and reports whether it did.
+	Add(key string, value []byte, ttl time.Duration) (bool, error)
+	Delete(keys ...string) error
+}
+
+// idempotencyRecord is what the store holds per key: the request fingerprint,
+// and once the request completed, its response.
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key header safe to retry.
+// The first response to a key, apart from 5xx errors, is stored for ttl and replayed to later requests
+// with the same key, with an Idempotent-Replayed header. Keys are scoped to the authenticated user,
+// or to the address of anonymous clients, and to the route, so it must run after JWTAuthMiddleware.
+//
+// Reusing a key with a different request body is rejected with 422, and a retry arriving while the
+// first request is still being processed is rejected with 409 and a Retry-After header.
+// Requests without the header are passed through untouched.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeBadRequest,
+					fmt.Sprintf("%s must not be longer than 255 characters", IdempotencyKeyHeader)))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			r.Body.Close()
+			if err != nil {
+				WriteProblem(w, r, ToApiError(decodeError(err)))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := idempotencyStoreKey(r, key)
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+			pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+
+			added, err := store.Add(storeKey, pending, idempotencyLockTTL)
+			if err != nil {
+				Logger(r.Context()).Error("Idempotency store failed", "err", err.Error())
+				WriteProblem(w, r, InternalServerError())
+				return
+			}
+			if !added {
+				replayIdempotent(w, r, store, storeKey, fingerprint)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// 5xx responses and panics leave nothing behind, so the request can be retried.
+				if !completed || rec.status >= http.StatusInternalServerError {
+					store.Delete(storeKey)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+			completed = true
+
+			if rec.status < http.StatusInternalServerError {
+				header := rec.header.Clone()
+				header.Del(RequestIDHeader)
+				done, _ := json.Marshal(idempotencyRecord{
+					Fingerprint: fingerprint,
+					Done:        true,
+					Status:      rec.status,
+					Header:      header,
+					Body:        rec.body.Bytes(),
+				})
+				if err := store.Set(storeKey, done, ttl); err != nil {
+					Logger(r.Context()).Error("Failed to store idempotent response", "err", err.Error())
+				}
+			}
+		})
+	}
+}
+
+// replayIdempotent answers a request whose key is already taken: with the stored response,
+// or with an error if the first request is still running or had another body.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, store IdempotencyStore, storeKey, fingerprint string) {
+	raw, ok, err := store.Get(storeKey)
+	if err != nil {
+		Logger(r.Context()).Error("Idempotency store failed", "err", err.Error())
+		WriteProblem(w, r, InternalServerError())
+		return
+	}
+
+	var stored idempotencyRecord
+	if ok {
+		if err := json.Unmarshal(raw, &stored); err != nil {
+			Logger(r.Context()).Error("Corrupt idempotency record", "err", err.Error())
+			WriteProblem(w, r, InternalServerError())
+			return
+		}
+	}
+
+	switch {
+	case !ok || !stored.Done:
+		// A missing record means the first request failed and released the key in the meantime,
+		// so retrying shortly will go ahead as well.
+		w.Header().Set("Retry-After", "1")
+		WriteProblem(w, r, NewProblem(http.StatusConflict, CodeIdempotencyInFlight,
+			"a request with this idempotency key is still being processed"))
+	case stored.Fingerprint != fingerprint:
+		WriteProblem(w, r, NewProblem(http.StatusUnprocessableEntity, CodeIdempotencyReused,
+			"the idempotency key was already used for a request with another body"))
+	default:
+		for name, values := range stored.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// idempotencyStoreKey scopes key to the authenticated user, or to the address of an anonymous client,
+// and to the route, so no client is replayed the response to another.
+func idempotencyStoreKey(r *http.Request, key string) string {
+	scope := "anonymous:" + ClientIP(r)
+	if userId, ok := r.Context().Value("userId").(int); ok {
+		scope = "user:" + strconv.Itoa(userId)
+	}
+	sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + key))
+	return "idempotency:" + scope + ":" + hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes a response through to the client while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/repo/cache_repo"
+)
+
+// idempotencyTestHandler creates a resource per call, answering with its sequence number.
+type idempotencyTestHandler struct {
+	calls   atomic.Int64
+	status  int
+	release chan struct{}
+}
+
+func (h *idempotencyTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := h.calls.Add(1)
+	if h.release != nil {
+		<-h.release
+	}
+	status := h.status
+	if status == 0 {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/posts/%d", n))
+	WriteJSON(w, status, map[string]int64{"id": n})
+}
+
+func postWithKey(handler http.Handler, key, body string, userId int) *httptest.ResponseRecorder {
+	return postWithKeyFrom(handler, key, body, userId, "192.0.2.1:1234")
+}
+
+// postWithKeyFrom is postWithKey for a client at remoteAddr.
+func postWithKeyFrom(handler http.Handler, key, body string, userId int, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if userId != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), "userId", userId))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	h := &idempotencyTestHandler{}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	first := postWithKey(handler, "key-1", `{"title":"t"}`, 1)
+	second := postWithKey(handler, "key-1", `{"title":"t"}`, 1)
+
+	if h.calls.Load() != 1 {
+		t.Fatalf("handler called %d times; want 1", h.calls.Load())
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Location") != first.Header().Get("Location") {
+		t.Fatalf("replay differs:\n first  %d %v %s\n second %d %v %s",
+			first.Code, first.Header(), first.Body, second.Code, second.Header(), second.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("only the replay must carry Idempotent-Replayed")
+	}
+
+	// Without a key, or with another one, requests go through.
+	postWithKey(handler, "", `{"title":"t"}`, 1)
+	postWithKey(handler, "key-2", `{"title":"t"}`, 1)
+	if h.calls.Load() != 3 {
+		t.Fatalf("handler called %d times; want 3", h.calls.Load())
+	}
+}
+
+func TestIdempotencyKeysAreScopedToUsers(t *testing.T) {
+	h := &idempotencyTestHandler{}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	postWithKey(handler, "key-1", `{}`, 1)
+	if w := postWithKey(handler, "key-1", `{}`, 2); w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("another user got a replayed response")
+	}
+	if h.calls.Load() != 2 {
+		t.Fatalf("handler called %d times; want 2", h.calls.Load())
+	}
+}
+
+func TestIdempotencyKeysOfAnonymousClientsAreScopedToAddresses(t *testing.T) {
+	h := &idempotencyTestHandler{}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	postWithKeyFrom(handler, "key-1", `{}`, 0, "192.0.2.1:1234")
+	if w := postWithKeyFrom(handler, "key-1", `{}`, 0, "192.0.2.1:5678"); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("the same client was not replayed its response")
+	}
+	if w := postWithKeyFrom(handler, "key-1", `{}`, 0, "198.51.100.1:1234"); w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("another anonymous client got a replayed response")
+	}
+	if h.calls.Load() != 2 {
+		t.Fatalf("handler called %d times; want 2", h.calls.Load())
+	}
+}
+
+func TestIdempotencyRejectsKeyReuseWithAnotherBody(t *testing.T) {
+	h := &idempotencyTestHandler{}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	postWithKey(handler, "key-1", `{"title":"a"}`, 1)
+	w := postWithKey(handler, "key-1", `{"title":"b"}`, 1)
+
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), CodeIdempotencyReused) {
+		t.Fatalf("got %d %s; want 422 %s", w.Code, w.Body, CodeIdempotencyReused)
+	}
+	if h.calls.Load() != 1 {
+		t.Fatalf("handler called %d times; want 1", h.calls.Load())
+	}
+}
+
+func TestIdempotencyRejectsConcurrentDuplicates(t *testing.T) {
+	h := &idempotencyTestHandler{release: make(chan struct{})}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postWithKey(handler, "key-1", `{}`, 1) }()
+	for h.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := postWithKey(handler, "key-1", `{}`, 1)
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("in-flight duplicate got %d (Retry-After %q); want 409 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	close(h.release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first request got %d; want 201", first.Code)
+	}
+	if w := postWithKey(handler, "key-1", `{}`, 1); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry after completion was not replayed")
+	}
+	if h.calls.Load() != 1 {
+		t.Fatalf("handler called %d times; want 1", h.calls.Load())
+	}
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	h := &idempotencyTestHandler{status: http.StatusInternalServerError}
+	handler := IdempotencyMiddleware(cache_repo.NewExpiringCache(), time.Hour)(h)
+
+	postWithKey(handler, "key-1", `{}`, 1)
+	h.status = http.StatusCreated
+	if w := postWithKey(handler, "key-1", `{}`, 1); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry of a failed request got %d, replayed %q; want a fresh 201", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if h.calls.Load() != 2 {
+		t.Fatalf("handler called %d times; want 2", h.calls.Load())
+	}
+}
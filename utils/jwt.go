@@ -2,52 +2,100 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/assaidy/goblog/metrics"
 	"github.com/assaidy/goblog/models"
+	"github.com/assaidy/goblog/ratelimit"
 	"github.com/assaidy/goblog/repo"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Auth issues the JWTs of logged in users and verifies them. It is built once, from the configuration.
+type Auth struct {
+	secret         []byte
+	expiration     time.Duration
+	lockout        *ratelimit.Lockout
+	accountLockout *ratelimit.Lockout
+}
+
+// NewAuth returns an Auth signing tokens with secret, valid for expiration. With a lockout,
+// usernames are locked out at a client address after repeated failed logins from it; with an
+// accountLockout, they are locked out everywhere after failed logins from any address, which
+// should take more of them. A nil lockout disables it.
+func NewAuth(secret string, expiration time.Duration, lockout, accountLockout *ratelimit.Lockout) *Auth {
+	return &Auth{secret: []byte(secret), expiration: expiration, lockout: lockout, accountLockout: accountLockout}
+}
+
 // JWTAuthMiddleware checks if the request contains a valid JWT token and adds the user ID to the request context.
-func JWTAuthMiddleware(next http.Handler) http.Handler {
+func (a *Auth) JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get the token from the Authorization header
 		tokenString := r.Header.Get("Authorization")
 		if tokenString == "" {
-			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+			WriteProblem(w, r, UnAuthorized(fmt.Errorf("missing Authorization header")))
 			return
 		}
 
-		// Remove the "Bearer " prefix from the token string
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+		a.authenticate(w, r, tokenString, next)
+	})
+}
 
-		// Verify the token
-		userId, err := verifyTokenAndGetUserID(tokenString)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Unauthorized: %v", err), http.StatusUnauthorized)
+// OptionalJWTAuthMiddleware is JWTAuthMiddleware for routes that also serve anonymous clients:
+// requests without an Authorization header are passed on without a user ID in the context.
+// Invalid tokens are still rejected.
+func (a *Auth) OptionalJWTAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Add the user ID to the request context
-		ctx := context.WithValue(r.Context(), "userId", userId)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		a.authenticate(w, r, tokenString, next)
 	})
 }
 
-// verifyTokenAndGetUserID verifies the JWT token and extracts the user ID from it.
-func verifyTokenAndGetUserID(tokenString string) (int, error) {
-	config, err := LoadConfig()
+// authenticate verifies the token of an Authorization header and serves the request with the user ID
+// in its context, or rejects it.
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request, tokenString string, next http.Handler) {
+	// Verify the token
+	userId, err := a.VerifyToken(tokenString)
 	if err != nil {
-		return 0, fmt.Errorf("failed to load config")
+		WriteProblem(w, r, ToApiError(err))
+		return
+	}
+
+	// Add the user ID to the request context
+	next.ServeHTTP(w, r.WithContext(ContextWithUserID(r.Context(), userId)))
+}
+
+// VerifyToken verifies a token issued by AuthenticateUser, with or without a "Bearer " prefix,
+// and returns the ID of its user. Invalid tokens yield a 401 ApiError.
+func (a *Auth) VerifyToken(tokenString string) (int, error) {
+	// Remove the "Bearer " prefix from the token string
+	return a.verifyTokenAndGetUserID(strings.TrimPrefix(tokenString, "Bearer "))
+}
+
+// ContextWithUserID returns a copy of ctx carrying the ID of the authenticated user,
+// where handlers look it up, and a logger that adds it to the records.
+func ContextWithUserID(ctx context.Context, userId int) context.Context {
+	if state, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		state.userId = userId
 	}
+	ctx = ContextWithLogger(ctx, Logger(ctx).With("userId", userId))
+	return context.WithValue(ctx, "userId", userId)
+}
 
+// verifyTokenAndGetUserID verifies the JWT token and extracts the user ID from it.
+func (a *Auth) verifyTokenAndGetUserID(tokenString string) (int, error) {
 	// Parse the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecret), nil
+		return a.secret, nil
 	})
 
 	// Check if there was an error during parsing or if the token is invalid
@@ -70,43 +118,105 @@ func verifyTokenAndGetUserID(tokenString string) (int, error) {
 	return int(userID), nil
 }
 
-// AuthenticateUser returns user data along with a JWT token
-func AuthenticateUser(loginReq models.UserLoginRequest, s repo.Storer) (map[string]any, error) {
-	user, err := s.GetUserByUsername(loginReq.Username)
+// AuthenticateUser returns user data along with a JWT token.
+// With a lockout, a username is locked out at a client address after repeated failed logins from
+// it, for longer after each further failure: its logins from there fail with 429 until the lockout
+// ends, even with the right password. Keying lockouts by address too means nobody can lock users
+// out of their account from elsewhere with a few failures. Clients sharing an address, such as
+// behind a NAT, share their lockouts. So that attackers with many addresses cannot make unlimited guesses, the account lockout counts
+// the failed logins of a username from all addresses, and locks it out everywhere once there are
+// more of them than a user mistyping their password could make.
+func (a *Auth) AuthenticateUser(ctx context.Context, loginReq models.UserLoginRequest, s repo.Storer) (*models.UserLoginResponse, error) {
+	lockouts := a.loginLockouts(ctx, loginReq.Username)
+	if locked := loginLocked(ctx, lockouts); locked > 0 {
+		metrics.LockedLogins.Inc()
+		return nil, TooManyRequests(CodeLoginLocked, "too many failed logins, retry later", locked)
+	}
+
+	user, err := s.GetUserByUsername(repo.WithCredentials(ctx), loginReq.Username)
 	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			loginFailed(ctx, lockouts)
+		}
 		return nil, err
 	}
 
 	// Check if the password matches
 	if user.Password != loginReq.Password {
+		loginFailed(ctx, lockouts)
 		return nil, NotFound(fmt.Errorf("password is not correct"))
 	}
 
 	// Create a JWT token for the authenticated user
-	token, err := createToken(user.Id)
+	token, err := a.createToken(user.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	metrics.Logins.Inc()
+	loginSucceeded(ctx, lockouts)
 	// Remove the password before returning the user data
 	user.Password = ""
-	resp := map[string]any{
-		"user":  user,
-		"token": token,
+	return &models.UserLoginResponse{User: user, Token: token}, nil
+}
+
+// loginLockout is a lockout a login is subject to, with the key it has there.
+type loginLockout struct {
+	lockout *ratelimit.Lockout
+	key     string
+}
+
+// loginLockouts returns the lockouts a login of username from the client address in ctx is subject to.
+func (a *Auth) loginLockouts(ctx context.Context, username string) []loginLockout {
+	var lockouts []loginLockout
+	if a.lockout != nil {
+		lockouts = append(lockouts, loginLockout{a.lockout, "login:" + clientIP(ctx) + ":" + username})
+	}
+	if a.accountLockout != nil {
+		lockouts = append(lockouts, loginLockout{a.accountLockout, "login:account:" + username})
+	}
+	return lockouts
+}
+
+// loginLocked returns how long the longest of the lockouts lasts, or 0 if none is locked out.
+// Lockouts whose store fails are skipped.
+func loginLocked(ctx context.Context, lockouts []loginLockout) time.Duration {
+	var locked time.Duration
+	for _, l := range lockouts {
+		d, err := l.lockout.Locked(l.key)
+		if err != nil {
+			Logger(ctx).Error("Login lockout store failed", "err", err.Error())
+			continue
+		}
+		locked = max(locked, d)
 	}
+	return locked
+}
 
-	return resp, nil
+// loginFailed counts a failed login, and records it with the lockouts.
+// Unknown usernames count too, so lockouts do not tell which usernames exist.
+func loginFailed(ctx context.Context, lockouts []loginLockout) {
+	metrics.FailedLogins.Inc()
+	for _, l := range lockouts {
+		if _, err := l.lockout.Fail(l.key); err != nil {
+			Logger(ctx).Error("Login lockout store failed", "err", err.Error())
+		}
+	}
 }
 
-// createToken generates a JWT token for a given user ID
-func createToken(id int) (string, error) {
-	config, err := LoadConfig()
-	if err != nil {
-		return "", fmt.Errorf("failed to load config")
+// loginSucceeded forgets the failed logins recorded with the lockouts.
+func loginSucceeded(ctx context.Context, lockouts []loginLockout) {
+	for _, l := range lockouts {
+		if err := l.lockout.Succeed(l.key); err != nil {
+			Logger(ctx).Error("Login lockout store failed", "err", err.Error())
+		}
 	}
+}
 
-	// Set expiration time based on the configured JWT expiration hours
-	expirationTime := time.Now().Add(time.Hour * time.Duration(config.JWTExpirationHours)).Unix()
+// createToken generates a JWT token for a given user ID
+func (a *Auth) createToken(id int) (string, error) {
+	// Set expiration time based on the configured JWT expiration
+	expirationTime := time.Now().Add(a.expiration).Unix()
 
 	// Create a new JWT token with the user ID and expiration time
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -115,7 +225,7 @@ func createToken(id int) (string, error) {
 	})
 
 	// Sign the token using the configured JWT secret
-	tokenString, err := token.SignedString([]byte(config.JWTSecret))
+	tokenString, err := token.SignedString(a.secret)
 	if err != nil {
 		return "", err
 	}
@@ -123,8 +233,7 @@ func createToken(id int) (string, error) {
 	return tokenString, nil
 }
 
-// TODO: apply to the code
-// getUserIDFromContext retrieves the user ID from the request context.
+// GetUserIDFromContext retrieves the user ID from the request context.
 func GetUserIDFromContext(r *http.Request) (int, error) {
 	userId, ok := r.Context().Value("userId").(int)
 	if !ok {
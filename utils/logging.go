@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Log formats accepted by NewLogger.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger returns a logger writing to w in format, text or json, the records at level
+// (debug, info, warn or error) and above.
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// loggerKey is the context key under which the logger of the request is stored.
+type loggerKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying logger, which Logger returns.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger of the request ctx belongs to, which adds its request id, trace id,
+// route and user id to the records, or the default logger outside of LoggingMiddleware.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// LoggingMiddleware puts a logger carrying the request and trace ids in the request context, and logs
+// a line for every request once it is served. It must run inside RequestIDMiddleware,
+// ClientIPMiddleware and TracingMiddleware, and wraps the mux router so requests matching no route are logged too;
+// the router must use RouteMiddleware.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		state, r := withRequestState(r)
+		logger := slog.Default().With("requestId", RequestIDFromContext(r.Context()))
+		if traceId := TraceIDFromContext(r.Context()); traceId != "" {
+			logger = logger.With("traceId", traceId)
+		}
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r.WithContext(ContextWithLogger(r.Context(), logger)))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", state.route,
+			"clientIp", ClientIP(r),
+			"status", sw.statusOrOK(),
+			"bytes", sw.bytes,
+			"duration", time.Since(start),
+		}
+		if state.userId != 0 {
+			attrs = append(attrs, "userId", state.userId)
+		}
+		logger.Info("Served request", attrs...)
+	})
+}
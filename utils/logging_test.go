@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestNewLogger(t *testing.T) {
+	if _, err := NewLogger(io.Discard, "JSON", "warn"); err != nil {
+		t.Errorf("json at warn: %v", err)
+	}
+	if _, err := NewLogger(io.Discard, "xml", "info"); err == nil {
+		t.Errorf("xml format accepted")
+	}
+	if _, err := NewLogger(io.Discard, "text", "loud"); err == nil {
+		t.Errorf("level loud accepted")
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewLogger(&buf, LogFormatJSON, "info")
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	router := mux.NewRouter()
+	router.Use(RouteMiddleware)
+	router.HandleFunc("/posts/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := ContextWithUserID(r.Context(), 7)
+		Logger(ctx).Info("Handling")
+		io.WriteString(w, "hello")
+	})
+	handler := RequestIDMiddleware(LoggingMiddleware(router))
+
+	req := httptest.NewRequest(http.MethodGet, "/posts/3", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want the handler's and the access log:\n%s", len(lines), buf.String())
+	}
+	var handling, access map[string]any
+	json.Unmarshal([]byte(lines[0]), &handling)
+	json.Unmarshal([]byte(lines[1]), &access)
+
+	// The handler's records carry the request id, the route and the user.
+	for key, want := range map[string]any{"requestId": "req-1", "route": "/posts/{id:[0-9]+}", "userId": 7.0} {
+		if handling[key] != want {
+			t.Errorf("handler record %s = %v, want %v", key, handling[key], want)
+		}
+	}
+	for key, want := range map[string]any{
+		"msg": "Served request", "requestId": "req-1", "method": "GET", "path": "/posts/3",
+		"route": "/posts/{id:[0-9]+}", "status": 200.0, "bytes": 5.0, "userId": 7.0,
+	} {
+		if access[key] != want {
+			t.Errorf("access log %s = %v, want %v", key, access[key], want)
+		}
+	}
+	if _, ok := access["duration"]; !ok {
+		t.Errorf("access log lacks the duration")
+	}
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// unmatchedRoute is the route template of requests that matched no route.
+const unmatchedRoute = "unmatched"
+
+// requestState is what the middlewares wrapping the mux router learn about a request once it is served.
+// They only see the request from before the route was matched and the user authenticated, so
+// RouteMiddleware and ContextWithUserID fill it in.
+type requestState struct {
+	route  string
+	userId int
+}
+
+type requestStateKey struct{}
+
+// withRequestState returns the state of r, adding one to its context if it has none yet.
+func withRequestState(r *http.Request) (*requestState, *http.Request) {
+	if state, ok := r.Context().Value(requestStateKey{}).(*requestState); ok {
+		return state, r
+	}
+	state := &requestState{route: unmatchedRoute}
+	return state, r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state))
+}
+
+// MetricsMiddleware counts and times requests by method, route template and status. It wraps the
+// mux router, so requests matching no route are counted too; the router must use RouteMiddleware.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		state, r := withRequestState(r)
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		labels := []string{r.Method, state.route, strconv.Itoa(sw.statusOrOK())}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RouteMiddleware records the template of the route mux matched, for MetricsMiddleware and
+// LoggingMiddleware, and adds it to the logger and the span of the request.
+func RouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, err := mux.CurrentRoute(r).GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if state, ok := r.Context().Value(requestStateKey{}).(*requestState); ok {
+			state.route = template
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + template)
+		span.SetAttributes(semconv.HTTPRoute(template))
+		ctx := ContextWithLogger(r.Context(), Logger(r.Context()).With("route", template))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// statusWriter remembers the status and the size of the response written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusOrOK returns the status written, or 200 if the handler wrote nothing, as net/http then sends.
+func (w *statusWriter) statusOrOK() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
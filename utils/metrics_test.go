@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RouteMiddleware)
+	router.HandleFunc("/api/v2/posts/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods("GET")
+	handler := MetricsMiddleware(router)
+
+	tests := []struct {
+		path   string
+		route  string
+		status string
+	}{
+		{"/api/v2/posts/1", "/api/v2/posts/{id:[0-9]+}", "418"},
+		{"/api/v2/posts/2", "/api/v2/posts/{id:[0-9]+}", "418"},
+		// Unmatched paths share one series, whatever clients request.
+		{"/api/v2/nowhere", unmatchedRoute, "404"},
+	}
+
+	for _, tt := range tests {
+		before := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", tt.route, tt.status))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", tt.route, tt.status)) - before; got != 1 {
+			t.Errorf("%s: requests counted for route %q and status %s = %v, want 1", tt.path, tt.route, tt.status, got)
+		}
+	}
+}
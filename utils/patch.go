@@ -0,0 +1,365 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the PATCH request bodies understood by DecodePatch.
+const (
+	MergePatchMediaType = "application/merge-patch+json" // RFC 7396
+	JSONPatchMediaType  = "application/json-patch+json"  // RFC 6902
+)
+
+// AcceptPatch is the value of the Accept-Patch header, listing the supported patch formats.
+const AcceptPatch = MergePatchMediaType + ", " + JSONPatchMediaType
+
+// DecodePatch applies the patch in the request body to dst, a pointer to a request struct
+// holding the current state of the resource, and strictly decodes the result back into dst.
+// The format of the patch is chosen by the Content-Type header, see MergePatchMediaType and
+// JSONPatchMediaType. The patch is applied entirely or not at all, and dst is left untouched
+// when it fails. The result is not validated: callers run ValidateRequest once they are done
+// with it. Failures are returned as ApiErrors.
+func DecodePatch(r *http.Request, dst any) error {
+	defer r.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != MergePatchMediaType && mediaType != JSONPatchMediaType {
+		return NewProblem(http.StatusUnsupportedMediaType, CodeUnsupportedMedia,
+			fmt.Sprintf("PATCH requests must be sent as %s or %s", MergePatchMediaType, JSONPatchMediaType))
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err != nil {
+		return decodeError(err)
+	}
+
+	current, err := json.Marshal(dst)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+
+	if mediaType == MergePatchMediaType {
+		var patch map[string]any
+		if err := decodeStrict(bytes.NewReader(body), &patch); err != nil {
+			return err
+		}
+		if patch == nil {
+			return invalidPatch("a merge patch must be a JSON object")
+		}
+		doc = mergePatch(doc, patch)
+	} else {
+		var ops []patchOperation
+		if err := decodeStrict(bytes.NewReader(body), &ops); err != nil {
+			return err
+		}
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return err
+		}
+	}
+
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	// Decode into a zero value, so that removed members end up empty rather than unchanged.
+	result := reflect.New(reflect.TypeOf(dst).Elem())
+	if err := decodeStrict(bytes.NewReader(patched), result.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(dst).Elem().Set(result.Elem())
+
+	return nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396) to doc and returns the result.
+// Members set to null in the patch are removed, objects are merged recursively,
+// and any other value replaces the target as a whole.
+func mergePatch(doc, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	docObj, ok := doc.(map[string]any)
+	if !ok {
+		docObj = map[string]any{}
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(docObj, name)
+		} else {
+			docObj[name] = mergePatch(docObj[name], value)
+		}
+	}
+
+	return docObj
+}
+
+// patchOperation is a single operation of a JSON patch (RFC 6902).
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"` // nil when absent, "null" when set to null
+}
+
+// applyJSONPatch applies the operations in order to doc and returns the result.
+// doc is modified in place, so it must be discarded when an error is returned.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		var err error
+		if doc, err = applyOperation(doc, op); err != nil {
+			var apiErr ApiError
+			if errors.As(err, &apiErr) {
+				apiErr.Detail = fmt.Sprintf("operation %d (%s %s): %s", i, op.Op, op.Path, apiErr.Detail)
+				return nil, apiErr
+			}
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc any, op patchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, invalidPatch("missing value")
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, invalidPatch("malformed value")
+		}
+
+		switch op.Op {
+		case "add":
+			return addValue(doc, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, _, err = removeValue(doc, path); err != nil {
+				return nil, err
+			}
+			return addValue(doc, path, value)
+		default:
+			current, err := getValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, NewProblem(http.StatusConflict, CodePatchTestFailed, "value does not match")
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = removeValue(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if op.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, invalidPatch("cannot move a value into one of its children")
+			}
+			if doc, value, err = removeValue(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = getValue(doc, from); err != nil {
+				return nil, err
+			}
+			value = deepCopy(value)
+		}
+		return addValue(doc, path, value)
+	default:
+		return nil, invalidPatch(fmt.Sprintf("unknown operation %q", op.Op))
+	}
+}
+
+func invalidPatch(detail string) ApiError {
+	return NewProblem(http.StatusUnprocessableEntity, CodeInvalidPatch, detail)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, invalidPatch(fmt.Sprintf("invalid JSON pointer %q", pointer))
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// getValue returns the value at path.
+func getValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		var err error
+		if doc, err = child(doc, token); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// addValue adds value at path, replacing an object member or inserting into an array.
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch parent := parent.(type) {
+		case map[string]any:
+			parent[token] = value
+			return parent, nil
+		case []any:
+			if token == "-" {
+				return append(parent, value), nil
+			}
+			i, err := arrayIndex(token, len(parent)+1)
+			if err != nil {
+				return nil, err
+			}
+			parent = append(parent, nil)
+			copy(parent[i+1:], parent[i:])
+			parent[i] = value
+			return parent, nil
+		default:
+			return nil, invalidPatch(fmt.Sprintf("cannot add %q to a scalar", token))
+		}
+	})
+}
+
+// removeValue removes the value at path and returns it along with the new document.
+func removeValue(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, invalidPatch("cannot remove the whole document")
+	}
+
+	var removed any
+	doc, err := updateParent(doc, path, func(parent any, token string) (any, error) {
+		var err error
+		if removed, err = child(parent, token); err != nil {
+			return nil, err
+		}
+
+		switch parent := parent.(type) {
+		case map[string]any:
+			delete(parent, token)
+			return parent, nil
+		default:
+			i, _ := strconv.Atoi(token)
+			s := parent.([]any)
+			return append(s[:i], s[i+1:]...), nil
+		}
+	})
+	return doc, removed, err
+}
+
+// updateParent walks down to the parent of the value at path and replaces it
+// with the result of fn, which receives the parent and the last token of path.
+func updateParent(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	next, err := child(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if next, err = updateParent(next, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch doc := doc.(type) {
+	case map[string]any:
+		doc[path[0]] = next
+	case []any:
+		i, _ := strconv.Atoi(path[0])
+		doc[i] = next
+	}
+	return doc, nil
+}
+
+// child returns the member or element of node named by token, which must exist.
+func child(node any, token string) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[token]
+		if !ok {
+			return nil, invalidPatch(fmt.Sprintf("member %q does not exist", token))
+		}
+		return value, nil
+	case []any:
+		i, err := arrayIndex(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		return node[i], nil
+	default:
+		return nil, invalidPatch(fmt.Sprintf("%q does not exist", token))
+	}
+}
+
+// arrayIndex parses token as an array index lower than n.
+// Leading zeros are not allowed by RFC 6901.
+func arrayIndex(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, invalidPatch(fmt.Sprintf("invalid array index %q", token))
+	}
+	if i >= n {
+		return 0, invalidPatch(fmt.Sprintf("array index %d is out of bounds", i))
+	}
+	return i, nil
+}
+
+// deepCopy copies a decoded JSON value, so that later operations cannot change both copies.
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(value))
+		for k, v := range value {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []any:
+		s := make([]any, len(value))
+		for i, v := range value {
+			s[i] = deepCopy(v)
+		}
+		return s
+	default:
+		return value
+	}
+}
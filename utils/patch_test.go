@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/assaidy/goblog/models"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A.
+	tests := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got := mergePatch(decode(t, tt.doc), decode(t, tt.patch))
+		if !reflect.DeepEqual(got, decode(t, tt.want)) {
+			t.Errorf("mergePatch(%s, %s) = %v; want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Mostly examples from RFC 6902, appendix A.
+	tests := []struct {
+		name, doc, patch, want string
+		code                   string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, ""},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, ""},
+		{"append element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`, ""},
+		{"add null", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":null}]`, `{"baz":null,"foo":"bar"}`, ""},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, ""},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, ""},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, ""},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, ""},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, ""},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, ""},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, ""},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, ""},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", CodePatchTestFailed},
+		{"missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", CodeInvalidPatch},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", CodeInvalidPatch},
+		{"index out of bounds", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, "", CodeInvalidPatch},
+		{"leading zero", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", CodeInvalidPatch},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "", CodeInvalidPatch},
+		{"unknown op", `{"foo":"bar"}`, `[{"op":"frobnicate","path":"/foo"}]`, "", CodeInvalidPatch},
+		{"move into child", `{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, "", CodeInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []patchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatalf("bad patch: %v", err)
+			}
+
+			got, err := applyJSONPatch(decode(t, tt.doc), ops)
+			if tt.code != "" {
+				var apiErr ApiError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.code {
+					t.Fatalf("error = %v; want code %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, decode(t, tt.want)) {
+				t.Fatalf("got %v; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePatch(t *testing.T) {
+	current := models.PostCreateOrUpdateRequest{Title: "title", Content: "content", AuthorId: 1}
+
+	tests := []struct {
+		name, contentType, body string
+		want                    models.PostCreateOrUpdateRequest
+		status                  int
+	}{
+		{"merge patch", MergePatchMediaType, `{"title":"new"}`,
+			models.PostCreateOrUpdateRequest{Title: "new", Content: "content", AuthorId: 1}, 0},
+		{"merge patch removes", MergePatchMediaType + "; charset=utf-8", `{"content":null}`,
+			models.PostCreateOrUpdateRequest{Title: "title", AuthorId: 1}, 0},
+		{"json patch", JSONPatchMediaType, `[{"op":"replace","path":"/content","value":"new"}]`,
+			models.PostCreateOrUpdateRequest{Title: "title", Content: "new", AuthorId: 1}, 0},
+		{"plain json", "application/json", `{"title":"new"}`, current, http.StatusUnsupportedMediaType},
+		{"unknown field", MergePatchMediaType, `{"extra":1}`, current, http.StatusBadRequest},
+		{"wrong type", JSONPatchMediaType, `[{"op":"replace","path":"/authorId","value":"2"}]`, current, http.StatusBadRequest},
+		{"not an object", MergePatchMediaType, `null`, current, http.StatusUnprocessableEntity},
+		{"failed patch", JSONPatchMediaType, `[{"op":"replace","path":"/title","value":"x"},{"op":"remove","path":"/nope"}]`,
+			current, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			got := current
+			err := DecodePatch(r, &got)
+			if tt.status != 0 {
+				var apiErr ApiError
+				if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+					t.Fatalf("error = %v; want status %d", err, tt.status)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("bad JSON %s: %v", s, err)
+	}
+	return v
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/assaidy/goblog/ratelimit"
+)
+
+// RateLimitPolicy limits the requests each client makes to a group of routes.
+type RateLimitPolicy struct {
+	// Name tells policies apart, so each has its own buckets.
+	Name  string
+	Limit ratelimit.Limit
+	// PerUser gives each authenticated user a bucket, rather than each client address.
+	// The middleware must then run after the authentication.
+	PerUser bool
+}
+
+// RateLimitMiddleware rejects the requests of clients that exceeded the limit of policy with
+// 429 problems carrying a Retry-After header. Every response tells the state of the bucket
+// of its client in RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers; when several policies apply, the innermost one sets them.
+// Requests are let through if store fails, so its failure does not take the API down.
+func RateLimitMiddleware(store ratelimit.Store, policy RateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !policy.Limit.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := store.Take(rateLimitKey(r, policy), policy.Limit, time.Now())
+			if err != nil {
+				Logger(r.Context()).Error("Rate limit store failed", "policy", policy.Name, "err", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(policy.Limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit.Burst, seconds(policy.Limit.Period)))
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+				WriteProblem(w, r, TooManyRequests(CodeRateLimited, "too many requests, retry later", result.RetryAfter))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey returns the key of the bucket of the client of r.
+func rateLimitKey(r *http.Request, policy RateLimitPolicy) string {
+	if policy.PerUser {
+		if userId, err := GetUserIDFromContext(r); err == nil {
+			return fmt.Sprintf("ratelimit:%s:user:%d", policy.Name, userId)
+		}
+	}
+	return fmt.Sprintf("ratelimit:%s:ip:%s", policy.Name, ClientIP(r))
+}
+
+// seconds rounds d up to whole seconds, as rate limit headers count.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
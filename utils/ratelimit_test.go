@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/assaidy/goblog/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Limit: ratelimit.Limit{Burst: 2, Period: time.Minute}, PerUser: true}
+	handler := RateLimitMiddleware(ratelimit.NewMemoryStore(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(userId int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		if userId != 0 {
+			r = r.WithContext(ContextWithUserID(r.Context(), userId))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		w := do(1)
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("status %d, remaining %q; want 200 with %s remaining", w.Code, w.Header().Get("RateLimit-Remaining"), remaining)
+		}
+	}
+	w := do(1)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("status %d, Retry-After %q; want 429 retrying after 30s", w.Code, w.Header().Get("Retry-After"))
+	}
+	if got := w.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %q, want 2;w=60", got)
+	}
+
+	// Other users, and anonymous clients, have buckets of their own.
+	if w := do(2); w.Code != http.StatusOK {
+		t.Errorf("another user: status %d, want 200", w.Code)
+	}
+	if w := do(0); w.Code != http.StatusOK {
+		t.Errorf("anonymous client: status %d, want 200", w.Code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("unreachable")
+}
+
+func TestRateLimitMiddlewareFailsOpen(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Limit: ratelimit.Limit{Burst: 1, Period: time.Minute}}
+	handler := RateLimitMiddleware(failingStore{}, policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200 when the store fails", w.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/assaidy/goblog/metrics"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware turns a panic in a handler into a 500 problem response, logs it with its stack
+// and the context of the request, and counts it. It wraps the mux router inside LoggingMiddleware
+// and MetricsMiddleware, which then see the 500.
+//
+// http.ErrAbortHandler is passed on, so handlers can still abort a response silently. A handler that
+// panics after it started its response is aborted too: the client sees a broken response rather
+// than one that looks complete.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, r := withRequestState(r)
+		sw := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			metrics.HTTPPanics.WithLabelValues(state.route).Inc()
+			attrs := []any{"panic", fmt.Sprint(recovered), "route", state.route, "stack", string(debug.Stack())}
+			if state.userId != 0 {
+				attrs = append(attrs, "userId", state.userId)
+			}
+			Logger(r.Context()).Error("Recovered from a panic", attrs...)
+
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(fmt.Errorf("panic: %v", recovered))
+			span.SetStatus(codes.Error, "panic")
+
+			if sw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			WriteProblem(sw, r, InternalServerError())
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/assaidy/goblog/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var user *struct{ Name string }
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, user.Name)
+	}))
+	before := testutil.ToFloat64(metrics.HTTPPanics.WithLabelValues(unmatchedRoute))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("response = %d %s, want a 500 problem", w.Code, w.Header().Get("Content-Type"))
+	}
+	var problem ApiError
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Code != CodeInternal {
+		t.Fatalf("problem = %+v, %v; want code %s", problem, err, CodeInternal)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPPanics.WithLabelValues(unmatchedRoute)) - before; got != 1 {
+		t.Errorf("panics counted = %v, want 1", got)
+	}
+}
+
+// TestRecoveryMiddlewareAborts checks that the response is aborted, rather than completed, when
+// the handler aborts it or already started it.
+func TestRecoveryMiddlewareAborts(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"ErrAbortHandler", func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}},
+		{"after writing", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("halfway")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, http.ErrAbortHandler) {
+					t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+				}
+			}()
+			RecoveryMiddleware(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// SecurityHeaders are the headers SecurityHeadersMiddleware adds to responses.
+type SecurityHeaders struct {
+	// HSTSMaxAge is how long browsers must only use HTTPS for the host, sent to clients on HTTPS.
+	// HSTS is disabled when it is 0.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	// FrameOptions is the X-Frame-Options header, DENY or SAMEORIGIN. It is not sent when empty.
+	FrameOptions string
+	// ContentSecurityPolicy is the policy of HTML pages. It is not sent when empty.
+	ContentSecurityPolicy string
+}
+
+// DefaultContentSecurityPolicy lets HTML pages run their own inline scripts and styles, and call
+// the API, but load nothing else and not be framed.
+const DefaultContentSecurityPolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; " +
+	"connect-src 'self'; img-src 'self' data:; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// SecurityHeadersMiddleware adds headers hardening browsers against misuse of the responses: every
+// response gets X-Content-Type-Options nosniff and the frame options, responses to HTTPS requests
+// get Strict-Transport-Security, and HTML pages get the Content-Security-Policy. It must run inside
+// ClientIPMiddleware to tell requests forwarded by proxies over HTTPS.
+func SecurityHeadersMiddleware(headers SecurityHeaders) func(http.Handler) http.Handler {
+	hsts := ""
+	if headers.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(headers.HSTSMaxAge.Seconds()))
+		if headers.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			if headers.FrameOptions != "" {
+				h.Set("X-Frame-Options", headers.FrameOptions)
+			}
+			if hsts != "" && IsHTTPS(r) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if headers.ContentSecurityPolicy != "" {
+				w = &cspWriter{ResponseWriter: w, policy: headers.ContentSecurityPolicy}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cspWriter adds a Content-Security-Policy header to HTML responses, once their type is known.
+type cspWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cspWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mediaType == "text/html" {
+			h.Set("Content-Security-Policy", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cspWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (w *cspWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
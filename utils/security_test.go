@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	headers := SecurityHeaders{
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		ContentSecurityPolicy: DefaultContentSecurityPolicy,
+	}
+	page := SecurityHeadersMiddleware(headers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<!doctype html><title>docs</title>")
+	}))
+	api := SecurityHeadersMiddleware(headers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{})
+	}))
+
+	w := httptest.NewRecorder()
+	page.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != DefaultContentSecurityPolicy {
+		t.Errorf("HTML page: Content-Security-Policy = %q", got)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("HTML page: headers %v", w.Header())
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HTTP request: Strict-Transport-Security = %q, want none", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/posts", nil)
+	r.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("JSON response: Content-Security-Policy = %q, want none", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("HTTPS request: Strict-Transport-Security = %q", got)
+	}
+}
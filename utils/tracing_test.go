@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := mux.NewRouter()
+	router.Use(RouteMiddleware)
+	router.HandleFunc("/posts/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, NotFound(fmt.Errorf("no post with id 3")))
+	})
+	handler := TracingMiddleware(router)
+
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/posts/3", nil)
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var problem ApiError
+	json.NewDecoder(w.Body).Decode(&problem)
+	if problem.TraceId != traceId {
+		t.Errorf("problem traceId = %q, want the trace of the caller %q", problem.TraceId, traceId)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /posts/{id:[0-9]+}" {
+		t.Errorf("span name = %q", span.Name())
+	}
+	if got := span.Parent().TraceID().String(); got != traceId {
+		t.Errorf("span continues trace %s, want %s", got, traceId)
+	}
+	attrs := map[string]any{}
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attrs[string(semconv.HTTPRouteKey)] != "/posts/{id:[0-9]+}" || attrs[string(semconv.HTTPResponseStatusCodeKey)] != int64(404) {
+		t.Errorf("span attributes = %v, want the route and the status", attrs)
+	}
+}
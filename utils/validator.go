@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidateStruct checks the fields of the struct pointed to by v against their `validate` tags
+// and returns one FieldError per failing rule, keyed by the field's JSON name.
+//
+// A tag is a comma separated list of rules, applied in order:
+//
+//	trim         trims surrounding white space (modifies the field)
+//	required     the value must not be empty (zero)
+//	min=N, max=N length in characters for strings, value for numbers
+//	email        a bare email address such as "jane@example.com"
+//	oneof=a b c  one of the space separated values
+//	regex=EXPR   must match EXPR; since EXPR may contain commas it has to be the last rule
+//
+// Rules other than trim and required are skipped for empty optional fields.
+func ValidateStruct(v any) []FieldError {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("ValidateStruct: expected a pointer to a struct, got %T", v))
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var errs []FieldError
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		if msg := validateField(rv.Field(i), tag); msg != "" {
+			name := jsonName(field)
+			errs = append(errs, FieldError{Field: name, Message: name + " " + msg})
+		}
+	}
+
+	return errs
+}
+
+// validateField applies the rules of tag to value and returns the message of the first failing rule.
+func validateField(value reflect.Value, tag string) string {
+	for _, rule := range splitRules(tag) {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "trim":
+			if value.Kind() == reflect.String {
+				value.SetString(strings.TrimSpace(value.String()))
+			}
+			continue
+		case "required":
+			if value.IsZero() {
+				return "is required"
+			}
+			continue
+		}
+
+		if value.IsZero() {
+			// Optional and empty: nothing else to check.
+			return ""
+		}
+
+		if msg := applyRule(value, name, arg); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+// applyRule checks a single non-modifying rule.
+func applyRule(value reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %s argument %q", name, arg))
+		}
+
+		n, unit := 0, ""
+		switch value.Kind() {
+		case reflect.String:
+			n, unit = utf8.RuneCountInString(value.String()), " characters"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = int(value.Int())
+		default:
+			panic(fmt.Sprintf("validate: %s does not apply to %s", name, value.Kind()))
+		}
+
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "email":
+		addr, err := mail.ParseAddress(value.String())
+		if err != nil || addr.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", ")
+	case "regex":
+		if !compileRegex(arg).MatchString(value.String()) {
+			return "has an invalid format"
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", name))
+	}
+
+	return ""
+}
+
+// splitRules splits a tag on commas, keeping everything after "regex=" as a single rule.
+func splitRules(tag string) []string {
+	var rules []string
+	for tag != "" {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(rules, tag)
+		}
+		rule, rest, _ := strings.Cut(tag, ",")
+		rules = append(rules, strings.TrimSpace(rule))
+		tag = rest
+	}
+	return rules
+}
+
+// regexCache holds compiled patterns of regex rules, keyed by their source.
+var regexCache sync.Map
+
+func compileRegex(expr string) *regexp.Regexp {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(expr)
+	regexCache.Store(expr, re)
+	return re
+}
+
+// jsonName returns the name a field has in JSON documents.
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
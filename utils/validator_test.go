@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/assaidy/goblog/models"
+)
+
+type sampleRequest struct {
+	Name  string `json:"name" validate:"trim,required,min=3,max=5"`
+	Email string `json:"email" validate:"trim,email"`
+	Role  string `json:"role" validate:"oneof=admin user"`
+	Code  string `json:"code" validate:"regex=^[a-z]{2,3}$"`
+	Age   int    `json:"age" validate:"min=18"`
+	Note  string `json:"note"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	tests := []struct {
+		name string
+		req  sampleRequest
+		want map[string]string
+	}{
+		{"valid", sampleRequest{Name: " bob ", Email: "bob@example.com", Role: "user", Code: "ab", Age: 20}, nil},
+		{"optional fields may be empty", sampleRequest{Name: "bob"}, nil},
+		{"required after trim", sampleRequest{Name: "   "}, map[string]string{"name": "name is required"}},
+		{"too short", sampleRequest{Name: "bo"}, map[string]string{"name": "name must be at least 3 characters"}},
+		{"too long", sampleRequest{Name: "bobbybob"}, map[string]string{"name": "name must be at most 5 characters"}},
+		{"email", sampleRequest{Name: "bob", Email: "Bob <bob@example.com>"}, map[string]string{"email": "email must be a valid email address"}},
+		{"oneof", sampleRequest{Name: "bob", Role: "root"}, map[string]string{"role": "role must be one of: admin, user"}},
+		{"regex", sampleRequest{Name: "bob", Code: "a,b"}, map[string]string{"code": "code has an invalid format"}},
+		{"number", sampleRequest{Name: "bob", Age: 17}, map[string]string{"age": "age must be at least 18"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			got := map[string]string{}
+			for _, fe := range ValidateStruct(&req) {
+				got[fe.Field] = fe.Message
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v; want %v", got, tt.want)
+			}
+			for field, msg := range tt.want {
+				if got[field] != msg {
+					t.Fatalf("got %v; want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	req := sampleRequest{Name: "  bob  "}
+	ValidateStruct(&req)
+	if req.Name != "bob" {
+		t.Fatalf("trim did not modify the field, got %q", req.Name)
+	}
+}
+
+func TestDecodeAndValidateJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		detail string
+	}{
+		{"valid", `{"title":" t ","content":"c","authorId":1}`, 0, "", ""},
+		{"empty body", ``, http.StatusBadRequest, CodeInvalidJSON, "request body is empty"},
+		{"malformed", `{"title":`, http.StatusBadRequest, CodeInvalidJSON, "malformed JSON"},
+		{"unknown field", `{"title":"t","content":"c","authorId":1,"extra":true}`, http.StatusBadRequest, CodeInvalidJSON, `unknown field "extra"`},
+		{"trailing data", `{"title":"t","content":"c","authorId":1} {}`, http.StatusBadRequest, CodeInvalidJSON, "request body must contain a single JSON value"},
+		{"wrong type", `{"title":"t","content":"c","authorId":"1"}`, http.StatusBadRequest, CodeInvalidJSON, `field "authorId" must be of type int`},
+		{"invalid fields", `{"title":"  ","content":"c"}`, http.StatusUnprocessableEntity, CodeValidationFailed, "request data is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			var req models.PostCreateOrUpdateRequest
+			err := DecodeAndValidateJSON(r, &req)
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if req.Title != "t" {
+					t.Fatalf("title was not trimmed: %q", req.Title)
+				}
+				return
+			}
+
+			var apiErr ApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v; want an ApiError", err)
+			}
+			if apiErr.Status != tt.status || apiErr.Code != tt.code || !strings.HasPrefix(apiErr.Detail, tt.detail) {
+				t.Fatalf("got %d %s %q; want %d %s %q", apiErr.Status, apiErr.Code, apiErr.Detail, tt.status, tt.code, tt.detail)
+			}
+		})
+	}
+}
+
+func TestDecodeAndValidateJSONRunsRequestHook(t *testing.T) {
+	body := `{"username":"1alice","email":"not-an-email","password":"pw"}`
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+
+	var req models.UserRegisterOrUpdateRequest
+	err := DecodeAndValidateJSON(r, &req)
+
+	var apiErr ApiError
+	if !errors.As(err, &apiErr) || len(apiErr.Errors) != 2 {
+		t.Fatalf("error = %#v; want two field errors", err)
+	}
+	if apiErr.Errors[0].Field != "email" || apiErr.Errors[1].Field != "username" {
+		t.Fatalf("field errors = %+v; want email (tag) then username (hook)", apiErr.Errors)
+	}
+}